@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/egorovdmi/financify/business/core/account"
+	"github.com/egorovdmi/financify/business/sys/validate"
+	"github.com/egorovdmi/financify/foundation/web"
+	"github.com/pkg/errors"
+)
+
+type accountGroup struct {
+	core account.Core
+}
+
+func (ag accountGroup) signup(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var ns account.NewSignup
+	if err := web.Decode(r, &ns); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+	if err := validate.Check(ns); err != nil {
+		return err
+	}
+
+	usr, err := ag.core.Signup(ctx, v.TraceID, ns, v.Now)
+	if err != nil {
+		return errors.Wrap(err, "signing up")
+	}
+
+	return web.Respond(ctx, rw, &usr, http.StatusCreated)
+}
+
+func (ag accountGroup) verify(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	usr, err := ag.core.Verify(ctx, v.TraceID, web.Param(r, "token"), v.Now)
+	if err != nil {
+		return errors.Wrap(err, "verifying email")
+	}
+
+	return web.Respond(ctx, rw, &usr, http.StatusOK)
+}
+
+func (ag accountGroup) resendVerification(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var req struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+	if err := web.Decode(r, &req); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+	if err := validate.Check(req); err != nil {
+		return err
+	}
+
+	if err := ag.core.ResendVerification(ctx, v.TraceID, req.Email, v.Now); err != nil {
+		return errors.Wrap(err, "resending verification")
+	}
+
+	return web.Respond(ctx, rw, nil, http.StatusNoContent)
+}
+
+func (ag accountGroup) forgotPassword(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var req struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+	if err := web.Decode(r, &req); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+	if err := validate.Check(req); err != nil {
+		return err
+	}
+
+	if err := ag.core.ForgotPassword(ctx, v.TraceID, req.Email, v.Now); err != nil {
+		return errors.Wrap(err, "requesting password reset")
+	}
+
+	return web.Respond(ctx, rw, nil, http.StatusNoContent)
+}
+
+func (ag accountGroup) resetPassword(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var rp account.ResetPassword
+	if err := web.Decode(r, &rp); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+	if err := validate.Check(rp); err != nil {
+		return err
+	}
+
+	if err := ag.core.ResetPassword(ctx, v.TraceID, rp, v.Now); err != nil {
+		return errors.Wrap(err, "resetting password")
+	}
+
+	return web.Respond(ctx, rw, nil, http.StatusNoContent)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/apikey"
+	"github.com/egorovdmi/financify/business/sys/validate"
+	"github.com/egorovdmi/financify/foundation/web"
+	"github.com/pkg/errors"
+)
+
+type apiKeyGroup struct {
+	repo apikey.APIKeyRepository
+}
+
+func (kg apiKeyGroup) query(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	keys, err := kg.repo.Query(ctx, v.TraceID, claims)
+	if err != nil {
+		return errors.Wrap(err, "unable to query for api keys")
+	}
+
+	return web.Respond(ctx, rw, keys, http.StatusOK)
+}
+
+func (kg apiKeyGroup) create(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var nk apikey.NewAPIKey
+	if err := web.Decode(r, &nk); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+	if err := validate.Check(nk); err != nil {
+		return err
+	}
+
+	k, key, err := kg.repo.Create(ctx, v.TraceID, claims, nk, v.Now)
+	if err != nil {
+		return errors.Wrapf(err, "APIKey: %+v", &nk)
+	}
+
+	resp := struct {
+		apikey.APIKey
+		Key string `json:"key"`
+	}{
+		APIKey: k,
+		Key:    key,
+	}
+
+	return web.Respond(ctx, rw, resp, http.StatusCreated)
+}
+
+func (kg apiKeyGroup) delete(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	if err := kg.repo.Delete(ctx, v.TraceID, claims, web.Param(r, "id"), v.Now); err != nil {
+		return errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
+	}
+
+	return web.Respond(ctx, rw, nil, http.StatusNoContent)
+}
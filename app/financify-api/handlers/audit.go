@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/egorovdmi/financify/business/data/audit"
+	"github.com/egorovdmi/financify/foundation/web"
+	"github.com/pkg/errors"
+)
+
+type auditGroup struct {
+	repo audit.AuditRepository
+}
+
+func (ag auditGroup) query(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	q := r.URL.Query()
+	f := audit.Filter{
+		ActorID:  q.Get("actor"),
+		Entity:   q.Get("entity"),
+		EntityID: q.Get("entity_id"),
+	}
+
+	var err error
+	if f.Since, err = parseTime(q.Get("since")); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "since"), http.StatusBadRequest)
+	}
+	if f.Until, err = parseTime(q.Get("until")); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "until"), http.StatusBadRequest)
+	}
+	if s := q.Get("limit"); s != "" {
+		if f.Limit, err = strconv.Atoi(s); err != nil || f.Limit < 0 {
+			return web.NewRequestError(errors.New("limit must be a positive number"), http.StatusBadRequest)
+		}
+	}
+
+	events, err := ag.repo.Query(ctx, v.TraceID, f)
+	if err != nil {
+		return errors.Wrap(err, "unable to query for audit events")
+	}
+
+	return web.Respond(ctx, rw, events, http.StatusOK)
+}
+
+// parseTime reads an optional RFC 3339 timestamp from a query parameter.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
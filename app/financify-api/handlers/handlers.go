@@ -1,38 +1,177 @@
 package handlers
 
 import (
-	"log"
 	"net/http"
 	"os"
 
 	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/core/account"
+	"github.com/egorovdmi/financify/business/core/session"
+	"github.com/egorovdmi/financify/business/core/sso"
+	"github.com/egorovdmi/financify/business/data/apikey"
+	"github.com/egorovdmi/financify/business/data/audit"
+	"github.com/egorovdmi/financify/business/data/grant"
+	"github.com/egorovdmi/financify/business/data/idempotency"
+	"github.com/egorovdmi/financify/business/data/payment"
+	"github.com/egorovdmi/financify/business/data/scope"
 	"github.com/egorovdmi/financify/business/data/user"
+	"github.com/egorovdmi/financify/business/data/wallet"
 	"github.com/egorovdmi/financify/business/mid"
+	"github.com/egorovdmi/financify/foundation/logger"
+	"github.com/egorovdmi/financify/foundation/mail"
+	"github.com/egorovdmi/financify/foundation/oidc"
 	"github.com/egorovdmi/financify/foundation/web"
 	"github.com/jmoiron/sqlx"
 )
 
-func API(build string, shutdown chan os.Signal, log *log.Logger, a *auth.Auth, db *sqlx.DB) *web.App {
-	app := web.NewApp(shutdown, mid.Logger(log), mid.Errors(log), mid.Metrics(), mid.Panics(log))
+// APIConfig contains all the mandatory systems required by handlers.
+type APIConfig struct {
+	Build     string
+	Shutdown  chan os.Signal
+	Log       *logger.Logger
+	Auth      *auth.Auth
+	DB        *sqlx.DB
+	Mailer    mail.Mailer
+	PublicURL string
+	Lockout   session.Lockout
+
+	// OIDC enables logging in with an external provider issuing tokens
+	// signed with OIDCKeyID. It's disabled when nil.
+	OIDC      *oidc.Provider
+	OIDCKeyID string
+
+	// OIDCAutoLink links unknown identities to the regular user with the
+	// same verified email. Anyone controlling that email at the provider
+	// gets into the account, so only enable it for a trusted provider.
+	OIDCAutoLink bool
+
+	// TrustRequestID uses the X-Request-ID header of incoming requests as
+	// their ID. Enable it only behind a proxy that sets or strips it.
+	TrustRequestID bool
+}
+
+// API constructs an http.Handler with all application routes defined.
+func API(cfg APIConfig) *web.App {
+	log, a, db := cfg.Log, cfg.Auth, cfg.DB
+
+	app := web.NewApp(cfg.Shutdown, mid.Logger(log), mid.Metrics(), mid.Errors(log), mid.Panics(log))
+	if cfg.TrustRequestID {
+		app.TrustRequestID()
+	}
 
 	check := checkGroup{
-		build: build,
+		build: cfg.Build,
 		db:    db,
 	}
 	app.Handle(http.MethodGet, "/readiness", check.readiness)
 	app.Handle(http.MethodGet, "/liveness", check.liveness)
 
+	sess := session.NewCore(log, db, a, cfg.Lockout)
+	authen := mid.Authenticate(sess)
+	noKey := mid.DenyAPIKey()
+	idem := mid.Idempotent(log, idempotency.NewIdempotencyRepository(log, db))
+
+	acc := account.NewCore(log, db, cfg.Mailer, cfg.PublicURL)
+
 	ug := userGroup{
-		repo: user.NewUserRepository(log, db),
-		auth: a,
+		repo:    user.NewUserRepository(log, db),
+		account: acc,
+		session: sess,
 	}
 
 	app.Handle(http.MethodGet, "/v1/token/:kid", ug.token)
-	app.Handle(http.MethodGet, "/v1/users", ug.query, mid.Authenticate(a))
-	app.Handle(http.MethodGet, "/v1/users/:id", ug.queryByID, mid.Authenticate(a))
-	app.Handle(http.MethodPost, "/v1/users", ug.create, mid.Authenticate(a))
-	app.Handle(http.MethodPut, "/v1/users/:id", ug.update, mid.Authenticate(a))
-	app.Handle(http.MethodDelete, "/v1/users/:id", ug.delete, mid.Authenticate(a))
+
+	mg := mfaGroup{
+		session: sess,
+	}
+
+	app.Handle(http.MethodPost, "/v1/token/:kid/mfa", mg.verify)
+
+	if cfg.OIDC != nil {
+		og := oidcGroup{
+			core: sso.NewCore(log, db, sess, cfg.OIDC, cfg.OIDCAutoLink),
+			kid:  cfg.OIDCKeyID,
+		}
+
+		app.Handle(http.MethodGet, "/v1/oidc/login", og.login)
+		app.Handle(http.MethodGet, "/v1/oidc/callback", og.callback)
+	}
+	app.Handle(http.MethodPost, "/v1/mfa/totp", mg.enroll, authen, noKey)
+	app.Handle(http.MethodPost, "/v1/mfa/totp/confirm", mg.confirm, authen, noKey)
+	app.Handle(http.MethodPost, "/v1/mfa/totp/disable", mg.disable, authen, noKey)
+
+	ag := accountGroup{
+		core: acc,
+	}
+
+	app.Handle(http.MethodPost, "/v1/signup", ag.signup)
+	app.Handle(http.MethodGet, "/v1/signup/verify/:token", ag.verify)
+	app.Handle(http.MethodPost, "/v1/signup/resend", ag.resendVerification)
+	app.Handle(http.MethodPost, "/v1/password/forgot", ag.forgotPassword)
+	app.Handle(http.MethodPost, "/v1/password/reset", ag.resetPassword)
+
+	app.Handle(http.MethodGet, "/v1/users", ug.query, authen, mid.Authorize(auth.RoleAdmin))
+	app.Handle(http.MethodGet, "/v1/users/:id", ug.queryByID, authen, noKey)
+	app.Handle(http.MethodPost, "/v1/users", ug.create, authen, mid.Authorize(auth.RoleAdmin), idem)
+	app.Handle(http.MethodPut, "/v1/users/:id", ug.update, authen, noKey)
+	app.Handle(http.MethodPatch, "/v1/users/:id", ug.patch, authen, noKey)
+	app.Handle(http.MethodDelete, "/v1/users/:id", ug.delete, authen, noKey)
+	app.Handle(http.MethodPost, "/v1/users/:id/unlock", ug.unlock, authen, mid.Authorize(auth.RoleAdmin))
+	app.Handle(http.MethodPost, "/v1/users/:id/restore", ug.restore, authen, mid.Authorize(auth.RoleAdmin))
+
+	adg := auditGroup{
+		repo: audit.NewAuditRepository(log, db),
+	}
+
+	app.Handle(http.MethodGet, "/v1/audit", adg.query, authen, mid.Authorize(auth.RoleAdmin))
+
+	kg := apiKeyGroup{
+		repo: apikey.NewAPIKeyRepository(log, db),
+	}
+
+	app.Handle(http.MethodGet, "/v1/apikeys", kg.query, authen, noKey)
+	app.Handle(http.MethodPost, "/v1/apikeys", kg.create, authen, noKey)
+	app.Handle(http.MethodDelete, "/v1/apikeys/:id", kg.delete, authen, noKey)
+
+	gr := grant.NewGrantRepository(log, db)
+
+	sg := scopeGroup{
+		repo: scope.NewScopeRepository(log, db),
+	}
+
+	app.Handle(http.MethodGet, "/v1/scopes", sg.query, authen)
+	app.Handle(http.MethodPost, "/v1/scopes", sg.create, authen, idem)
+	app.Handle(http.MethodGet, "/v1/scopes/:id", sg.queryByID, authen, mid.Require(gr, auth.PermScopeRead, "id"))
+	app.Handle(http.MethodPut, "/v1/scopes/:id", sg.update, authen, mid.Require(gr, auth.PermScopeWrite, "id"))
+	app.Handle(http.MethodPatch, "/v1/scopes/:id", sg.patch, authen, mid.Require(gr, auth.PermScopeWrite, "id"))
+	app.Handle(http.MethodDelete, "/v1/scopes/:id", sg.delete, authen, mid.Require(gr, auth.PermScopeManage, "id"))
+	app.Handle(http.MethodPost, "/v1/scopes/:id/restore", sg.restore, authen, mid.Authorize(auth.RoleAdmin))
+	app.Handle(http.MethodGet, "/v1/scopes/:id/members", sg.queryMembers, authen, mid.Require(gr, auth.PermScopeRead, "id"))
+	app.Handle(http.MethodDelete, "/v1/scopes/:id/members/:user_id", sg.removeMember, authen, mid.Require(gr, auth.PermScopeManage, "id"))
+	app.Handle(http.MethodPost, "/v1/scopes/:id/invitations", sg.invite, authen, mid.Require(gr, auth.PermScopeManage, "id"))
+	app.Handle(http.MethodPost, "/v1/invitations/:token/accept", sg.acceptInvitation, authen)
+	app.Handle(http.MethodPost, "/v1/invitations/:token/decline", sg.declineInvitation, authen)
+
+	wr := wallet.NewWalletRepository(log, db)
+
+	wg := walletGroup{
+		repo: wr,
+	}
+
+	app.Handle(http.MethodGet, "/v1/scopes/:id/wallets", wg.queryByScope, authen, mid.Require(gr, auth.PermScopeRead, "id"))
+	app.Handle(http.MethodPost, "/v1/scopes/:id/wallets", wg.create, authen, mid.Require(gr, auth.PermScopeWrite, "id"), idem)
+	app.Handle(http.MethodPatch, "/v1/scopes/:id/wallets/:wallet_id", wg.patch, authen, mid.Require(gr, auth.PermScopeWrite, "id"))
+	app.Handle(http.MethodDelete, "/v1/scopes/:id/wallets/:wallet_id", wg.delete, authen, mid.Require(gr, auth.PermScopeWrite, "id"))
+	app.Handle(http.MethodGet, "/v1/wallets/:id", wg.queryByID, authen)
+	app.Handle(http.MethodPost, "/v1/wallets/:id/restore", wg.restore, authen, mid.Authorize(auth.RoleAdmin))
+
+	pg := paymentGroup{
+		repo:    payment.NewPaymentRepository(log, db),
+		wallets: wr,
+	}
+
+	app.Handle(http.MethodGet, "/v1/wallets/:id/payments", pg.queryByWallet, authen, mid.RequireFunc(gr, auth.PermScopeRead, pg.walletScope))
+	app.Handle(http.MethodPost, "/v1/wallets/:id/payments:batch", pg.batch, authen, mid.RequireFunc(gr, auth.PermScopeWrite, pg.walletScope), idem)
 
 	return app
 }
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/core/session"
+	"github.com/egorovdmi/financify/business/sys/validate"
+	"github.com/egorovdmi/financify/foundation/web"
+	"github.com/pkg/errors"
+)
+
+type mfaGroup struct {
+	session session.Core
+}
+
+func (mg mfaGroup) verify(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var req struct {
+		MFAToken string `json:"mfa_token" validate:"required"`
+		Code     string `json:"code" validate:"required"`
+	}
+	if err := web.Decode(r, &req); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+	if err := validate.Check(req); err != nil {
+		return err
+	}
+
+	var tkn struct {
+		Token string `json:"token"`
+	}
+	var err error
+	tkn.Token, err = mg.session.VerifyMFA(ctx, v.TraceID, web.Param(r, "kid"), req.MFAToken, req.Code, v.Now)
+	if err != nil {
+		var le *session.LockedError
+		if errors.As(err, &le) {
+			return tooManyAttempts(rw, le)
+		}
+
+		switch err {
+		case session.ErrAuthenticationFailure, session.ErrInvalidCode, session.ErrMFANotEnrolled:
+			return web.NewRequestError(err, http.StatusUnauthorized)
+		default:
+			return errors.Wrap(err, "verifying second factor")
+		}
+	}
+
+	return web.Respond(ctx, rw, tkn, http.StatusOK)
+}
+
+func (mg mfaGroup) enroll(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	e, err := mg.session.EnrollTOTP(ctx, v.TraceID, claims.Subject, v.Now)
+	if err != nil {
+		return errors.Wrapf(err, "User: %s", claims.Subject)
+	}
+
+	return web.Respond(ctx, rw, e, http.StatusCreated)
+}
+
+func (mg mfaGroup) confirm(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var req struct {
+		Code string `json:"code" validate:"required"`
+	}
+	if err := web.Decode(r, &req); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+	if err := validate.Check(req); err != nil {
+		return err
+	}
+
+	var resp struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	var err error
+	resp.RecoveryCodes, err = mg.session.ConfirmTOTP(ctx, v.TraceID, claims.Subject, req.Code, v.Now)
+	if err != nil {
+		return errors.Wrapf(err, "User: %s", claims.Subject)
+	}
+
+	return web.Respond(ctx, rw, resp, http.StatusOK)
+}
+
+func (mg mfaGroup) disable(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var req struct {
+		Code string `json:"code" validate:"required"`
+	}
+	if err := web.Decode(r, &req); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+	if err := validate.Check(req); err != nil {
+		return err
+	}
+
+	if err := mg.session.DisableTOTP(ctx, v.TraceID, claims.Subject, req.Code, v.Now); err != nil {
+		return errors.Wrapf(err, "User: %s", claims.Subject)
+	}
+
+	return web.Respond(ctx, rw, nil, http.StatusNoContent)
+}
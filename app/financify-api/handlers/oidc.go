@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/egorovdmi/financify/business/core/sso"
+	"github.com/egorovdmi/financify/foundation/web"
+	"github.com/pkg/errors"
+)
+
+type oidcGroup struct {
+	core sso.Core
+	kid  string
+}
+
+func (og oidcGroup) login(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	url, err := og.core.Begin(ctx, v.TraceID, v.Now)
+	if err != nil {
+		return errors.Wrap(err, "starting login")
+	}
+
+	return web.Redirect(ctx, rw, r, url, http.StatusFound)
+}
+
+func (og oidcGroup) callback(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		err := errors.Errorf("identity provider error: %s", e)
+		return web.NewRequestError(err, http.StatusUnauthorized)
+	}
+
+	tkn, err := og.core.Callback(ctx, v.TraceID, og.kid, q.Get("state"), q.Get("code"), v.Now)
+	if err != nil {
+		return errors.Wrap(err, "completing login")
+	}
+
+	return web.Respond(ctx, rw, tkn, http.StatusOK)
+}
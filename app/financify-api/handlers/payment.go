@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/payment"
+	"github.com/egorovdmi/financify/business/data/wallet"
+	"github.com/egorovdmi/financify/business/sys/validate"
+	"github.com/egorovdmi/financify/foundation/web"
+	"github.com/pkg/errors"
+)
+
+type paymentGroup struct {
+	repo    payment.PaymentRepository
+	wallets wallet.WalletRepository
+}
+
+// walletScope finds the scope of the wallet in the route so access can be
+// checked against the grants on the scope.
+func (pg paymentGroup) walletScope(ctx context.Context, r *http.Request) (string, error) {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return "", web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return "", errors.New("claims missing from context")
+	}
+
+	w, err := pg.wallets.QueryByID(ctx, v.TraceID, claims, web.Param(r, "id"))
+	if err != nil {
+		return "", errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
+	}
+
+	return w.ScopeID, nil
+}
+
+func (pg paymentGroup) queryByWallet(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	payments, err := pg.repo.QueryByWallet(ctx, v.TraceID, web.Param(r, "id"))
+	if err != nil {
+		return errors.Wrapf(err, "WalletID: %s", web.Param(r, "id"))
+	}
+
+	return web.Respond(ctx, rw, payments, http.StatusOK)
+}
+
+func (pg paymentGroup) batch(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var nb payment.NewBatch
+	if err := web.Decode(r, &nb); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+	if err := validate.Check(nb); err != nil {
+		return err
+	}
+
+	b, err := pg.repo.Batch(ctx, v.TraceID, claims, web.Param(r, "id"), nb, v.Now)
+	if err != nil {
+		return errors.Wrapf(err, "WalletID: %s", web.Param(r, "id"))
+	}
+
+	// Nothing of an atomic batch with failed items was applied.
+	if b.Mode == payment.ModeAtomic && b.Failed > 0 {
+		return web.Respond(ctx, rw, b, http.StatusUnprocessableEntity)
+	}
+
+	return web.Respond(ctx, rw, b, http.StatusOK)
+}
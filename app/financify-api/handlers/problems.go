@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/egorovdmi/financify/business/core/session"
+	"github.com/egorovdmi/financify/business/core/sso"
+	"github.com/egorovdmi/financify/business/data/apikey"
+	"github.com/egorovdmi/financify/business/data/audit"
+	"github.com/egorovdmi/financify/business/data/payment"
+	"github.com/egorovdmi/financify/business/data/scope"
+	"github.com/egorovdmi/financify/business/data/user"
+	"github.com/egorovdmi/financify/business/data/wallet"
+	"github.com/egorovdmi/financify/business/mid"
+	"github.com/egorovdmi/financify/business/sys/money"
+	"github.com/egorovdmi/financify/foundation/web"
+)
+
+// Set of problem types the API reports errors as. Handlers return domain
+// errors as is, wrapped or not, and the registry picks the response.
+var (
+	problemValidation = web.ProblemType{
+		URI:    "/problems/validation",
+		Title:  "Your request parameters didn't validate.",
+		Status: http.StatusBadRequest,
+	}
+	problemInvalidID = web.ProblemType{
+		URI:    "/problems/invalid-id",
+		Title:  "The ID in the request isn't valid.",
+		Status: http.StatusBadRequest,
+	}
+	problemInvalidRequest = web.ProblemType{
+		URI:    "/problems/invalid-request",
+		Title:  "The request can't be processed as sent.",
+		Status: http.StatusBadRequest,
+	}
+	problemUnauthorized = web.ProblemType{
+		URI:    "/problems/unauthorized",
+		Title:  "The credentials weren't accepted.",
+		Status: http.StatusUnauthorized,
+	}
+	problemForbidden = web.ProblemType{
+		URI:    "/problems/forbidden",
+		Title:  "You aren't allowed to do that.",
+		Status: http.StatusForbidden,
+	}
+	problemNotFound = web.ProblemType{
+		URI:    "/problems/not-found",
+		Title:  "The resource doesn't exist.",
+		Status: http.StatusNotFound,
+	}
+	problemConflict = web.ProblemType{
+		URI:    "/problems/conflict",
+		Title:  "The request conflicts with the state of the resource.",
+		Status: http.StatusConflict,
+	}
+	problemGone = web.ProblemType{
+		URI:    "/problems/gone",
+		Title:  "The resource has expired.",
+		Status: http.StatusGone,
+	}
+	problemVersionMismatch = web.ProblemType{
+		URI:    "/problems/version-mismatch",
+		Title:  "The resource was changed since you last read it.",
+		Status: http.StatusPreconditionFailed,
+	}
+)
+
+func init() {
+	web.RegisterProblem(problemValidation, mid.ErrValidation)
+
+	web.RegisterProblem(problemInvalidID,
+		user.ErrInvalidID, scope.ErrInvalidID, wallet.ErrInvalidID,
+		payment.ErrInvalidID, audit.ErrInvalidID, apikey.ErrInvalidID,
+	)
+
+	web.RegisterProblem(problemInvalidRequest, apikey.ErrPastExpiry, session.ErrInvalidCode, money.ErrInvalid)
+
+	web.RegisterProblem(problemUnauthorized,
+		session.ErrAuthenticationFailure, session.ErrSessionRevoked, sso.ErrInvalidLogin,
+	)
+
+	web.RegisterProblem(problemForbidden,
+		user.ErrForbidden, user.ErrWrongPassword, apikey.ErrForbidden, apikey.ErrNotPermitted,
+		session.ErrNotVerified, sso.ErrEmailNotVerified, scope.ErrInvitationMismatch,
+	)
+
+	web.RegisterProblem(problemNotFound,
+		user.ErrNotFound, user.ErrVerificationNotFound, user.ErrPasswordResetNotFound,
+		scope.ErrNotFound, scope.ErrMemberNotFound, scope.ErrInvitationNotFound,
+		wallet.ErrNotFound, wallet.ErrScopeNotFound, payment.ErrWalletNotFound,
+		apikey.ErrNotFound, session.ErrMFANotEnrolled,
+	)
+
+	web.RegisterProblem(problemConflict,
+		user.ErrEmailTaken, user.ErrLastOwner, scope.ErrLastOwner,
+		session.ErrMFAEnrolled, sso.ErrAccountExists, scope.ErrAlreadyMember,
+	)
+
+	web.RegisterProblem(problemGone,
+		user.ErrVerificationExpired, user.ErrPasswordResetExpired, scope.ErrInvitationExpired,
+	)
+
+	web.RegisterProblem(problemVersionMismatch,
+		user.ErrVersionMismatch, scope.ErrVersionMismatch, wallet.ErrVersionMismatch,
+	)
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/scope"
+	"github.com/egorovdmi/financify/business/sys/validate"
+	"github.com/egorovdmi/financify/foundation/web"
+	"github.com/pkg/errors"
+)
+
+type scopeGroup struct {
+	repo scope.ScopeRepository
+}
+
+func (sg scopeGroup) query(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	scopes, err := sg.repo.Query(ctx, v.TraceID, claims)
+	if err != nil {
+		return errors.Wrap(err, "unable to query for scopes")
+	}
+
+	return web.Respond(ctx, rw, scopes, http.StatusOK)
+}
+
+func (sg scopeGroup) queryByID(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	s, err := sg.repo.QueryByID(ctx, v.TraceID, claims, web.Param(r, "id"))
+	if err != nil {
+		return errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
+	}
+
+	if web.NotModified(r, s.ETag()) {
+		return web.Respond(ctx, rw, &s, http.StatusNotModified)
+	}
+
+	return web.Respond(ctx, rw, &s, http.StatusOK)
+}
+
+func (sg scopeGroup) create(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var ns scope.NewScope
+	if err := web.Decode(r, &ns); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+	if err := validate.Check(ns); err != nil {
+		return err
+	}
+
+	s, err := sg.repo.Create(ctx, v.TraceID, claims, ns, v.Now)
+	if err != nil {
+		return errors.Wrapf(err, "Scope: %+v", &ns)
+	}
+
+	return web.Respond(ctx, rw, &s, http.StatusCreated)
+}
+
+func (sg scopeGroup) update(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var us scope.UpdateScope
+	if err := web.Decode(r, &us); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+	if err := validate.Check(us); err != nil {
+		return err
+	}
+
+	if err := sg.repo.Update(ctx, v.TraceID, claims, web.Param(r, "id"), us, web.IfMatch(r), v.Now); err != nil {
+		return errors.Wrapf(err, "ID: %s; Scope: %+v", web.Param(r, "id"), &us)
+	}
+
+	return web.Respond(ctx, rw, nil, http.StatusNoContent)
+}
+
+func (sg scopeGroup) patch(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	s, err := sg.repo.QueryByID(ctx, v.TraceID, claims, web.Param(r, "id"))
+	if err != nil {
+		return errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
+	}
+
+	ps, err := web.Patch(r, scope.NewScope{Title: s.Title}, validate.Check)
+	if err != nil {
+		return err
+	}
+
+	// Without a precondition the patch still applies only to the version it
+	// was computed from.
+	etag := web.IfMatch(r)
+	if etag == "" {
+		etag = s.ETag()
+	}
+
+	us := scope.UpdateScope{
+		Title: &ps.Title,
+	}
+	if err := sg.repo.Update(ctx, v.TraceID, claims, s.ID, us, etag, v.Now); err != nil {
+		return errors.Wrapf(err, "ID: %s; Scope: %+v", s.ID, &us)
+	}
+
+	s, err = sg.repo.QueryByID(ctx, v.TraceID, claims, web.Param(r, "id"))
+	if err != nil {
+		return errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
+	}
+
+	return web.Respond(ctx, rw, &s, http.StatusOK)
+}
+
+func (sg scopeGroup) delete(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	if err := sg.repo.Delete(ctx, v.TraceID, web.Param(r, "id"), web.IfMatch(r), v.Now); err != nil {
+		return errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
+	}
+
+	return web.Respond(ctx, rw, nil, http.StatusNoContent)
+}
+
+func (sg scopeGroup) restore(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	s, err := sg.repo.Restore(ctx, v.TraceID, web.Param(r, "id"), v.Now)
+	if err != nil {
+		return errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
+	}
+
+	return web.Respond(ctx, rw, &s, http.StatusOK)
+}
+
+func (sg scopeGroup) queryMembers(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	members, err := sg.repo.QueryMembers(ctx, v.TraceID, web.Param(r, "id"))
+	if err != nil {
+		return errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
+	}
+
+	return web.Respond(ctx, rw, members, http.StatusOK)
+}
+
+func (sg scopeGroup) removeMember(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	if err := sg.repo.RemoveMember(ctx, v.TraceID, web.Param(r, "id"), web.Param(r, "user_id"), v.Now); err != nil {
+		return errors.Wrapf(err, "ID: %s; UserID: %s", web.Param(r, "id"), web.Param(r, "user_id"))
+	}
+
+	return web.Respond(ctx, rw, nil, http.StatusNoContent)
+}
+
+func (sg scopeGroup) invite(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var ni scope.NewInvitation
+	if err := web.Decode(r, &ni); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+	if err := validate.Check(ni); err != nil {
+		return err
+	}
+
+	inv, token, err := sg.repo.CreateInvitation(ctx, v.TraceID, claims, web.Param(r, "id"), ni, v.Now)
+	if err != nil {
+		return errors.Wrapf(err, "ID: %s; Invitation: %+v", web.Param(r, "id"), &ni)
+	}
+
+	resp := struct {
+		scope.Invitation
+		Token string `json:"token"`
+	}{
+		Invitation: inv,
+		Token:      token,
+	}
+
+	return web.Respond(ctx, rw, resp, http.StatusCreated)
+}
+
+func (sg scopeGroup) acceptInvitation(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	m, err := sg.repo.AcceptInvitation(ctx, v.TraceID, claims, web.Param(r, "token"), v.Now)
+	if err != nil {
+		return errors.Wrap(err, "accepting invitation")
+	}
+
+	return web.Respond(ctx, rw, &m, http.StatusOK)
+}
+
+func (sg scopeGroup) declineInvitation(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	if err := sg.repo.DeclineInvitation(ctx, v.TraceID, claims, web.Param(r, "token"), v.Now); err != nil {
+		return errors.Wrap(err, "declining invitation")
+	}
+
+	return web.Respond(ctx, rw, nil, http.StatusNoContent)
+}
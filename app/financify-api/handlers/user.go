@@ -2,18 +2,25 @@ package handlers
 
 import (
 	"context"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 
 	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/core/account"
+	"github.com/egorovdmi/financify/business/core/session"
 	"github.com/egorovdmi/financify/business/data/user"
+	"github.com/egorovdmi/financify/business/sys/validate"
 	"github.com/egorovdmi/financify/foundation/web"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/trace"
 )
 
 type userGroup struct {
-	repo user.UserRepository
-	auth *auth.Auth
+	repo    user.UserRepository
+	account account.Core
+	session session.Core
 }
 
 func (ug userGroup) query(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
@@ -47,16 +54,11 @@ func (ug userGroup) queryByID(ctx context.Context, rw http.ResponseWriter, r *ht
 
 	usr, err := ug.repo.QueryByID(ctx, v.TraceID, claims, web.Param(r, "id"))
 	if err != nil {
-		switch err {
-		case user.ErrInvalidID:
-			return web.NewRequestError(err, http.StatusBadRequest)
-		case user.ErrNotFound:
-			return web.NewRequestError(err, http.StatusNotFound)
-		case user.ErrForbidden:
-			return web.NewRequestError(err, http.StatusForbidden)
-		default:
-			return errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
-		}
+		return errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
+	}
+
+	if web.NotModified(r, usr.ETag()) {
+		return web.Respond(ctx, rw, &usr, http.StatusNotModified)
 	}
 
 	return web.Respond(ctx, rw, &usr, http.StatusOK)
@@ -72,10 +74,13 @@ func (ug userGroup) create(ctx context.Context, rw http.ResponseWriter, r *http.
 	if err := web.Decode(r, &nu); err != nil {
 		return errors.Wrap(err, "unable to decode payload")
 	}
+	if err := validate.Check(nu); err != nil {
+		return err
+	}
 
 	usr, err := ug.repo.Create(ctx, v.TraceID, nu, v.Now)
 	if err != nil {
-		return errors.Wrapf(err, "User: %+v", &nu)
+		return errors.Wrapf(err, "creating user %q", nu.Name)
 	}
 
 	return web.Respond(ctx, rw, &usr, http.StatusCreated)
@@ -96,40 +101,71 @@ func (ug userGroup) update(ctx context.Context, rw http.ResponseWriter, r *http.
 	if err := web.Decode(r, &uu); err != nil {
 		return errors.Wrap(err, "unable to decode payload")
 	}
+	if err := validate.Check(uu); err != nil {
+		return err
+	}
 
-	if err := ug.repo.Update(ctx, v.TraceID, claims, web.Param(r, "id"), uu, v.Now); err != nil {
-		switch err {
-		case user.ErrInvalidID:
-			return web.NewRequestError(err, http.StatusBadRequest)
-		case user.ErrNotFound:
-			return web.NewRequestError(err, http.StatusNotFound)
-		case user.ErrForbidden:
-			return web.NewRequestError(err, http.StatusForbidden)
-		default:
-			return errors.Wrapf(err, "ID: %s; User: %+v", web.Param(r, "id"), &uu)
-		}
+	if err := ug.account.Update(ctx, v.TraceID, claims, web.Param(r, "id"), uu, web.IfMatch(r), v.Now); err != nil {
+		return errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
 	}
 
 	return web.Respond(ctx, rw, nil, http.StatusNoContent)
 }
 
+func (ug userGroup) patch(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	usr, err := ug.repo.QueryByID(ctx, v.TraceID, claims, web.Param(r, "id"))
+	if err != nil {
+		return errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
+	}
+
+	pu, err := web.Patch(r, user.NewPatchUser(usr), validate.Check)
+	if err != nil {
+		return err
+	}
+
+	// Without a precondition the patch still applies only to the version it
+	// was computed from.
+	etag := web.IfMatch(r)
+	if etag == "" {
+		etag = usr.ETag()
+	}
+
+	uu := pu.Changes(usr)
+	if err := ug.account.Update(ctx, v.TraceID, claims, usr.ID, uu, etag, v.Now); err != nil {
+		return errors.Wrapf(err, "ID: %s", usr.ID)
+	}
+
+	usr, err = ug.repo.QueryByID(ctx, v.TraceID, claims, web.Param(r, "id"))
+	if err != nil {
+		return errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
+	}
+
+	return web.Respond(ctx, rw, &usr, http.StatusOK)
+}
+
 func (ug userGroup) delete(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
 	v, ok := ctx.Value(web.KeyValues).(*web.Values)
 	if !ok {
 		return web.NewShutdownError("web value missing from context")
 	}
 
-	if err := ug.repo.Delete(ctx, v.TraceID, web.Param(r, "id")); err != nil {
-		switch err {
-		case user.ErrInvalidID:
-			return web.NewRequestError(err, http.StatusBadRequest)
-		case user.ErrNotFound:
-			return web.NewRequestError(err, http.StatusNotFound)
-		case user.ErrForbidden:
-			return web.NewRequestError(err, http.StatusForbidden)
-		default:
-			return errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
-		}
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	if err := ug.repo.Delete(ctx, v.TraceID, claims, web.Param(r, "id"), web.IfMatch(r), v.Now); err != nil {
+		return errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
 	}
 
 	return web.Respond(ctx, rw, nil, http.StatusNoContent)
@@ -147,23 +183,60 @@ func (ug userGroup) token(ctx context.Context, rw http.ResponseWriter, r *http.R
 		return web.NewRequestError(err, http.StatusUnauthorized)
 	}
 
-	claims, err := ug.repo.Authenticate(ctx, v.TraceID, email, pass, v.Now)
+	tkn, err := ug.session.Token(ctx, v.TraceID, web.Param(r, "kid"), email, pass, clientIP(r), v.Now)
 	if err != nil {
-		switch err {
-		case user.ErrAuthenticationFailure:
-			return web.NewRequestError(err, http.StatusUnauthorized)
-		default:
-			return errors.Wrap(err, "authenticating")
+		var le *session.LockedError
+		if errors.As(err, &le) {
+			return tooManyAttempts(rw, le)
 		}
+
+		return errors.Wrap(err, "authenticating")
 	}
 
-	var tkn struct {
-		Token string `json:"token"`
+	return web.Respond(ctx, rw, tkn, http.StatusOK)
+}
+
+func (ug userGroup) restore(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
 	}
-	tkn.Token, err = ug.auth.GenerateToken(web.Param(r, "kid"), claims)
+
+	usr, err := ug.repo.Restore(ctx, v.TraceID, web.Param(r, "id"), v.Now)
 	if err != nil {
-		return errors.Wrap(err, "generating token")
+		return errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
 	}
 
-	return web.Respond(ctx, rw, tkn, http.StatusOK)
+	return web.Respond(ctx, rw, &usr, http.StatusOK)
+}
+
+func (ug userGroup) unlock(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	if err := ug.session.Unlock(ctx, v.TraceID, web.Param(r, "id")); err != nil {
+		return errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
+	}
+
+	return web.Respond(ctx, rw, nil, http.StatusNoContent)
+}
+
+// tooManyAttempts converts a lockout into a 429 response telling the client
+// when to retry.
+func tooManyAttempts(rw http.ResponseWriter, le *session.LockedError) error {
+	secs := int(math.Ceil(le.RetryAfter.Seconds()))
+	rw.Header().Set("Retry-After", strconv.Itoa(secs))
+	return web.NewRequestError(le, http.StatusTooManyRequests)
+}
+
+// clientIP returns the IP of the connected client. Forwarding headers aren't
+// trusted since they are set by the client.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
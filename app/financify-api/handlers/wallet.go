@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/wallet"
+	"github.com/egorovdmi/financify/business/sys/validate"
+	"github.com/egorovdmi/financify/foundation/web"
+	"github.com/pkg/errors"
+)
+
+type walletGroup struct {
+	repo wallet.WalletRepository
+}
+
+func (wg walletGroup) queryByScope(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	wallets, err := wg.repo.QueryByScope(ctx, v.TraceID, claims, web.Param(r, "id"))
+	if err != nil {
+		return errors.Wrapf(err, "ScopeID: %s", web.Param(r, "id"))
+	}
+
+	return web.Respond(ctx, rw, wallets, http.StatusOK)
+}
+
+func (wg walletGroup) queryByID(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	w, err := wg.repo.QueryByID(ctx, v.TraceID, claims, web.Param(r, "id"))
+	if err != nil {
+		return errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
+	}
+
+	if web.NotModified(r, w.ETag()) {
+		return web.Respond(ctx, rw, &w, http.StatusNotModified)
+	}
+
+	return web.Respond(ctx, rw, &w, http.StatusOK)
+}
+
+func (wg walletGroup) create(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var nw wallet.NewWallet
+	if err := web.Decode(r, &nw); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+	if err := validate.Check(nw); err != nil {
+		return err
+	}
+
+	w, err := wg.repo.Create(ctx, v.TraceID, claims, web.Param(r, "id"), nw, v.Now)
+	if err != nil {
+		return errors.Wrapf(err, "ScopeID: %s; Wallet: %+v", web.Param(r, "id"), &nw)
+	}
+
+	return web.Respond(ctx, rw, &w, http.StatusCreated)
+}
+
+func (wg walletGroup) patch(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	scopeID, walletID := web.Param(r, "id"), web.Param(r, "wallet_id")
+
+	w, err := wg.repo.QueryByID(ctx, v.TraceID, claims, walletID)
+	if err == nil && w.ScopeID != scopeID {
+		err = wallet.ErrNotFound
+	}
+	if err != nil {
+		return errors.Wrapf(err, "ScopeID: %s; ID: %s", scopeID, walletID)
+	}
+
+	pw, err := web.Patch(r, wallet.NewWallet{Title: w.Title}, validate.Check)
+	if err != nil {
+		return err
+	}
+
+	// Without a precondition the patch still applies only to the version it
+	// was computed from.
+	etag := web.IfMatch(r)
+	if etag == "" {
+		etag = w.ETag()
+	}
+
+	uw := wallet.UpdateWallet{
+		Title: &pw.Title,
+	}
+	if err := wg.repo.Update(ctx, v.TraceID, scopeID, walletID, uw, etag, v.Now); err != nil {
+		return errors.Wrapf(err, "ScopeID: %s; ID: %s; Wallet: %+v", scopeID, walletID, &uw)
+	}
+
+	w, err = wg.repo.QueryByID(ctx, v.TraceID, claims, walletID)
+	if err != nil {
+		return errors.Wrapf(err, "ID: %s", walletID)
+	}
+
+	return web.Respond(ctx, rw, &w, http.StatusOK)
+}
+
+func (wg walletGroup) delete(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	if err := wg.repo.Delete(ctx, v.TraceID, web.Param(r, "id"), web.Param(r, "wallet_id"), web.IfMatch(r), v.Now); err != nil {
+		return errors.Wrapf(err, "ScopeID: %s; ID: %s", web.Param(r, "id"), web.Param(r, "wallet_id"))
+	}
+
+	return web.Respond(ctx, rw, nil, http.StatusNoContent)
+}
+
+func (wg walletGroup) restore(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	w, err := wg.repo.Restore(ctx, v.TraceID, web.Param(r, "id"), v.Now)
+	if err != nil {
+		return errors.Wrapf(err, "ID: %s", web.Param(r, "id"))
+	}
+
+	return web.Respond(ctx, rw, &w, http.StatusOK)
+}
@@ -6,7 +6,6 @@ import (
 	"expvar"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
@@ -17,29 +16,33 @@ import (
 	"github.com/ardanlabs/conf"
 	"github.com/egorovdmi/financify/app/financify-api/handlers"
 	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/core/purge"
+	"github.com/egorovdmi/financify/business/core/session"
+	"github.com/egorovdmi/financify/business/sys/lockout"
+	"github.com/egorovdmi/financify/business/sys/pwhash"
+	"github.com/egorovdmi/financify/business/sys/validate"
 	"github.com/egorovdmi/financify/foundation/database"
+	"github.com/egorovdmi/financify/foundation/logger"
+	"github.com/egorovdmi/financify/foundation/mail"
+	"github.com/egorovdmi/financify/foundation/metrics"
+	"github.com/egorovdmi/financify/foundation/oidc"
+	"github.com/egorovdmi/financify/foundation/tracing"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/pkg/errors"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/zipkin"
-	"go.opentelemetry.io/otel/sdk/resource"
-	"go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
 )
 
 // build is the git version of this program. It is set using build flags in the makefile.
 var build = "develop"
 
 func main() {
-	log := log.New(os.Stdout, "FINANCIFY : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile)
+	log := logger.New(os.Stdout, logger.LevelInfo, logger.FormatJSON).With("service", "FINANCIFY")
 	if err := run(log); err != nil {
-		log.Println("main: error:", err)
+		log.Error("main: error", "error", err)
 		os.Exit(1)
 	}
 }
 
-func run(log *log.Logger) error {
+func run(log *logger.Logger) error {
 
 	// =============================================================================================
 	// Configuration
@@ -52,6 +55,8 @@ func run(log *log.Logger) error {
 			ReadTimeout     time.Duration `conf:"default:5s"`
 			WriteTimeout    time.Duration `conf:"default:5s"`
 			ShutdownTimeout time.Duration `conf:"default:5s"`
+			PublicURL       string        `conf:"default:http://localhost:3000"`
+			TrustRequestID  bool          `conf:"default:false,help:use the X-Request-ID header set by a proxy"`
 		}
 		Auth struct {
 			KeyID          string `conf:"default:90a50c59-e095-4c36-b9a3-54f83a3832e2"`
@@ -64,9 +69,46 @@ func run(log *log.Logger) error {
 			Password   string `conf:"default:postgres"`
 			Name       string `conf:"default:postgres"`
 			DisableTLS bool   `conf:"default:true"`
+
+			SlowQueryThreshold time.Duration `conf:"default:200ms"`
+		}
+		Password struct {
+			MinLength    int    `conf:"default:8"`
+			BreachList   string `conf:"help:file of breached passwords that can't be used (one per line)"`
+			Algorithm    string `conf:"default:bcrypt,help:bcrypt or argon2id; outdated hashes are upgraded on login"`
+			BcryptCost   int    `conf:"default:10"`
+			ArgonTime    uint32 `conf:"default:1"`
+			ArgonMemory  uint32 `conf:"default:65536,help:argon2id memory in KiB"`
+			ArgonThreads uint8  `conf:"default:4"`
+		}
+		Lockout struct {
+			AccountThreshold int           `conf:"default:5"`
+			IPThreshold      int           `conf:"default:20"`
+			Delay            time.Duration `conf:"default:1s"`
+			MaxDelay         time.Duration `conf:"default:15m"`
+			Window           time.Duration `conf:"default:1h"`
+		}
+		OIDC struct {
+			Issuer       string `conf:"help:issuer URL of the OpenID Connect provider; login with it is disabled when empty"`
+			ClientID     string
+			ClientSecret string `conf:"mask"`
+			RedirectURL  string `conf:"default:http://localhost:3000/v1/oidc/callback"`
+			AutoLink     bool   `conf:"default:false,help:link logins to regular users with the same verified email"`
+		}
+		Purge struct {
+			Retention time.Duration `conf:"default:720h,help:how long deleted users and scopes and wallets can be restored"`
+			Interval  time.Duration `conf:"default:1h,help:how often records past the retention are removed; 0 disables purging"`
+		}
+		Mail struct {
+			Dir string `conf:"help:directory to store outgoing emails in; only their subjects are logged when empty"`
+		}
+		Log struct {
+			Level  string `conf:"default:info,help:debug or info or warn or error"`
+			Format string `conf:"default:json,help:text or json"`
 		}
-		Zipkin struct {
-			ReporterURI string  `conf:"default:http://localhost:9411/api/v2/spans"`
+		Tracing struct {
+			Exporter    string  `conf:"default:zipkin,help:zipkin or otlp-http or otlp-grpc or stdout or none"`
+			Endpoint    string  `conf:"help:collector URL; the exporter default when empty"`
 			ServiceName string  `conf:"default:financify-api"`
 			Probability float64 `conf:"default:0.05"`
 		}
@@ -100,20 +142,31 @@ func run(log *log.Logger) error {
 		return errors.Wrap(err, "parsing config")
 	}
 
+	level, err := logger.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return errors.Wrap(err, "parsing log level")
+	}
+	format, err := logger.ParseFormat(cfg.Log.Format)
+	if err != nil {
+		return errors.Wrap(err, "parsing log format")
+	}
+	log.SetLevel(level)
+	log.SetFormat(format)
+
 	expvar.NewString("build").Set(build)
-	log.Printf("main: started: application initializing : version %q\n", build)
-	defer log.Println("main: completed")
+	log.Info("main: started: application initializing", "version", build)
+	defer log.Info("main: completed")
 
 	out, err := conf.String(&cfg)
 	if err != nil {
 		return errors.Wrap(err, "generating config for output")
 	}
-	log.Printf("main: config: \n%v\n", out)
+	log.Info("main: config", "config", out)
 
 	// =============================================================================================
 	// Initialize authentication support
 
-	log.Println("main: initializing authentication support")
+	log.Info("main: initializing authentication support")
 
 	privatePEM, err := ioutil.ReadFile(cfg.Auth.PrivateKeyFile)
 	if err != nil {
@@ -138,15 +191,50 @@ func run(log *log.Logger) error {
 		return errors.Wrap(err, "constructing auth")
 	}
 
+	// =============================================================================================
+	// Initialize password support
+
+	log.Info("main: initializing password support")
+
+	policy := validate.PasswordPolicy{
+		MinLength: cfg.Password.MinLength,
+	}
+	if cfg.Password.BreachList != "" {
+		f, err := os.Open(cfg.Password.BreachList)
+		if err != nil {
+			return errors.Wrap(err, "opening breach list")
+		}
+		policy.Breached, err = validate.ReadBreachList(f)
+		f.Close()
+		if err != nil {
+			return errors.Wrap(err, "reading breach list")
+		}
+	}
+	validate.SetPasswordPolicy(policy)
+
+	err = pwhash.Configure(pwhash.Config{
+		Algorithm:     cfg.Password.Algorithm,
+		BcryptCost:    cfg.Password.BcryptCost,
+		Argon2Time:    cfg.Password.ArgonTime,
+		Argon2Memory:  cfg.Password.ArgonMemory,
+		Argon2Threads: cfg.Password.ArgonThreads,
+	})
+	if err != nil {
+		return errors.Wrap(err, "configuring password hashing")
+	}
+
 	// =============================================================================================
 	// Initialize database support
-	log.Println("main: initializing database support")
+	log.Info("main: initializing database support")
 	db, err := database.Open(database.Config{
 		Host:       cfg.DB.Host,
 		Name:       cfg.DB.Name,
 		User:       cfg.DB.User,
 		Password:   cfg.DB.Password,
 		DisableTLS: cfg.DB.DisableTLS,
+
+		Log:                log,
+		SlowQueryThreshold: cfg.DB.SlowQueryThreshold,
 	})
 
 	if err != nil {
@@ -154,22 +242,23 @@ func run(log *log.Logger) error {
 	}
 
 	defer func() {
-		log.Printf("main: Database stopping : %s", cfg.DB.Host)
+		log.Info("main: database stopping", "host", cfg.DB.Host)
 		db.Close()
 	}()
 
 	// =========================================================================
 	// Start Tracing Support
 
-	log.Printf("main: initializing OT/Zipkin tracing support")
+	log.Info("main: initializing tracing support", "exporter", cfg.Tracing.Exporter)
 
-	traceProvider, err := startTracing(
-		cfg.Zipkin.ServiceName,
-		cfg.Zipkin.ReporterURI,
-		cfg.Zipkin.Probability,
-	)
+	traceProvider, err := tracing.Start(tracing.Config{
+		ServiceName: cfg.Tracing.ServiceName,
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Probability: cfg.Tracing.Probability,
+	})
 	if err != nil {
-		return fmt.Errorf("starting tracing: %w", err)
+		return errors.Wrap(err, "starting tracing")
 	}
 	defer traceProvider.Shutdown(context.Background())
 
@@ -178,27 +267,119 @@ func run(log *log.Logger) error {
 	//
 	// /debug/pprof - Added to default mux by importing the net/http/pprof packege.
 	// /debug/vars - Added to default mux by importing the expvar packege.
+	// /metrics - Prometheus metrics of requests and the database pool.
+
+	log.Info("main: initializing debugging support")
 
-	log.Println("main: initializing debugging support")
+	database.RegisterStats(metrics.Default, db)
+	http.DefaultServeMux.Handle("/metrics", metrics.Handler())
 
 	go func() {
-		log.Printf("main: debug listening %s", cfg.Web.DebugHost)
+		log.Info("main: debug listening", "host", cfg.Web.DebugHost)
 		if err := http.ListenAndServe(cfg.Web.DebugHost, http.DefaultServeMux); err != nil {
-			log.Printf("main: debug listener closed: %v", err)
+			log.Error("main: debug listener closed", "error", err)
 		}
 	}()
 
+	// =============================================================================================
+	// Initialize mail support
+
+	log.Info("main: initializing mail support")
+
+	var mailer mail.Mailer = mail.NewLogMailer(log)
+	if cfg.Mail.Dir != "" {
+		mailer = mail.NewFileMailer(cfg.Mail.Dir)
+	}
+
+	// =============================================================================================
+	// Initialize OpenID Connect support
+
+	var provider *oidc.Provider
+	if cfg.OIDC.Issuer != "" {
+		log.Info("main: initializing OpenID Connect support", "issuer", cfg.OIDC.Issuer)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		provider, err = oidc.New(ctx, oidc.Config{
+			Issuer:       cfg.OIDC.Issuer,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+		}, nil)
+		cancel()
+		if err != nil {
+			return errors.Wrap(err, "initializing openid connect")
+		}
+	}
+
+	// =============================================================================================
+	// Initialize login lockout support
+
+	log.Info("main: initializing login lockout support")
+
+	accounts := lockout.NewMemoryStore(cfg.Lockout.Window)
+	ips := lockout.NewMemoryStore(cfg.Lockout.Window)
+
+	lock := session.Lockout{
+		Accounts: lockout.New(accounts, lockout.Policy{
+			Threshold: cfg.Lockout.AccountThreshold,
+			Delay:     cfg.Lockout.Delay,
+			MaxDelay:  cfg.Lockout.MaxDelay,
+			Window:    cfg.Lockout.Window,
+		}),
+		IPs: lockout.New(ips, lockout.Policy{
+			Threshold: cfg.Lockout.IPThreshold,
+			Delay:     cfg.Lockout.Delay,
+			MaxDelay:  cfg.Lockout.MaxDelay,
+			Window:    cfg.Lockout.Window,
+		}),
+	}
+
+	// Stale records are swept once per window.
+	sweepCtx, stopSweep := context.WithCancel(context.Background())
+	defer stopSweep()
+
+	if cfg.Lockout.Window > 0 {
+		go accounts.Run(sweepCtx, cfg.Lockout.Window)
+		go ips.Run(sweepCtx, cfg.Lockout.Window)
+	}
+
+	// =============================================================================================
+	// Start Purge Service
+
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	defer stopPurge()
+
+	if cfg.Purge.Interval > 0 {
+		log.Info("main: initializing purge support", "retention", cfg.Purge.Retention)
+
+		go purge.NewCore(log, db, cfg.Purge.Retention).Run(purgeCtx, cfg.Purge.Interval)
+	}
+
 	// =============================================================================================
 	// Start API Service
 
-	log.Println("main: initializing API support")
+	log.Info("main: initializing API support")
 
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
 	api := http.Server{
-		Addr:         cfg.Web.APIHost,
-		Handler:      handlers.API(build, shutdown, log, auth, db),
+		Addr: cfg.Web.APIHost,
+		Handler: handlers.API(handlers.APIConfig{
+			Build:     build,
+			Shutdown:  shutdown,
+			Log:       log,
+			Auth:      auth,
+			DB:        db,
+			Mailer:    mailer,
+			PublicURL: cfg.Web.PublicURL,
+			Lockout:   lock,
+			OIDC:      provider,
+			OIDCKeyID: cfg.Auth.KeyID,
+
+			OIDCAutoLink:   cfg.OIDC.AutoLink,
+			TrustRequestID: cfg.Web.TrustRequestID,
+		}),
 		ReadTimeout:  cfg.Web.ReadTimeout,
 		WriteTimeout: cfg.Web.WriteTimeout,
 	}
@@ -206,7 +387,7 @@ func run(log *log.Logger) error {
 	serverErrors := make(chan error, 1)
 
 	go func() {
-		log.Printf("main: API listening on %s", api.Addr)
+		log.Info("main: API listening", "host", api.Addr)
 		serverErrors <- api.ListenAndServe()
 	}()
 
@@ -216,7 +397,7 @@ func run(log *log.Logger) error {
 		return errors.Wrap(err, "server error")
 
 	case sig := <-shutdown:
-		log.Printf("main: %v: start shutdown", sig)
+		log.Info("main: start shutdown", "signal", sig)
 
 		ctx, cancel := context.WithTimeout(context.Background(), cfg.Web.ShutdownTimeout)
 		defer cancel()
@@ -229,39 +410,3 @@ func run(log *log.Logger) error {
 
 	return nil
 }
-
-// startTracing configure open telemetry to be used with zipkin.
-func startTracing(serviceName string, reporterURI string, probability float64) (*trace.TracerProvider, error) {
-
-	// WARNING: The current settings are using defaults which may not be
-	// compatible with your project. Please review the documentation for
-	// opentelemetry.
-
-	exporter, err := zipkin.New(
-		reporterURI,
-		// zipkin.WithLogger(zap.NewStdLog(log)),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("creating new exporter: %w", err)
-	}
-
-	traceProvider := trace.NewTracerProvider(
-		trace.WithSampler(trace.TraceIDRatioBased(probability)),
-		trace.WithBatcher(exporter,
-			trace.WithMaxExportBatchSize(trace.DefaultMaxExportBatchSize),
-			trace.WithBatchTimeout(trace.DefaultScheduleDelay*time.Millisecond),
-			trace.WithMaxExportBatchSize(trace.DefaultMaxExportBatchSize),
-		),
-		trace.WithResource(
-			resource.NewWithAttributes(
-				semconv.SchemaURL,
-				semconv.ServiceNameKey.String(serviceName),
-				attribute.String("exporter", "zipkin"),
-			),
-		),
-	)
-
-	// I can only get this working properly using the singleton :(
-	otel.SetTracerProvider(traceProvider)
-	return traceProvider, nil
-}
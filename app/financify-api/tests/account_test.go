@@ -0,0 +1,283 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egorovdmi/financify/app/financify-api/handlers"
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/tests"
+	"github.com/egorovdmi/financify/foundation/mail"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type AccountTests struct {
+	app     http.Handler
+	auth    *auth.Auth
+	kid     string
+	mailDir string
+}
+
+func TestAccount(t *testing.T) {
+	test := tests.NewIntegration(t)
+	t.Cleanup(test.Teardown)
+
+	mailDir := t.TempDir()
+
+	shutdown := make(chan os.Signal, 1)
+	tests := AccountTests{
+		app: handlers.API(handlers.APIConfig{
+			Build:     "develop",
+			Shutdown:  shutdown,
+			Log:       test.Log,
+			Auth:      test.Auth,
+			DB:        test.DB,
+			Mailer:    mail.NewFileMailer(mailDir),
+			PublicURL: "http://localhost:3000",
+		}),
+		auth:    test.Auth,
+		kid:     test.KID,
+		mailDir: mailDir,
+	}
+
+	t.Run("signupAndVerify", tests.signupAndVerify)
+	t.Run("resetPassword", tests.resetPassword)
+}
+
+func (at *AccountTests) signupAndVerify(t *testing.T) {
+	body := `{ "name": "Jane", "email": "jane@example.com", "password": "gophers-unite", "password_confirm": "gophers-unite" }`
+
+	t.Log("Given the need for new users to sign up on their own.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen signing up with a new email.", testID)
+		{
+			r := httptest.NewRequest(http.MethodPost, "/v1/signup", strings.NewReader(body))
+			w := httptest.NewRecorder()
+			at.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusCreated {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 201 for the response : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 201 for the response.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodPost, "/v1/signup", strings.NewReader(body))
+			w = httptest.NewRecorder()
+			at.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusConflict {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 409 signing up twice : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 409 signing up twice.", tests.Success, testID)
+
+			if code := at.token(t, "jane@example.com", "gophers-unite"); code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT get a token before verifying the email : got %d.", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT get a token before verifying the email.", tests.Success, testID)
+
+			link := linkRegex.FindString(at.lastMail(t, "jane@example.com"))
+			if link == "" {
+				t.Fatalf("\t%s\tTest %d:\tShould receive an email with the verification link.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive an email with the verification link.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodPost, "/v1/signup/resend", strings.NewReader(`{ "email": "jane@example.com" }`))
+			w = httptest.NewRecorder()
+			at.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to ask for a new link : got %d.", tests.Failed, testID, w.Code)
+			}
+			resent := linkRegex.FindString(at.lastMail(t, "jane@example.com"))
+			if resent == "" || resent == link {
+				t.Fatalf("\t%s\tTest %d:\tShould receive an email with a new verification link : got %q.", tests.Failed, testID, resent)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive an email with a new verification link.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodGet, link, nil)
+			w = httptest.NewRecorder()
+			at.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to use the replaced link : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to use the replaced link.", tests.Success, testID)
+			link = resent
+
+			r = httptest.NewRequest(http.MethodGet, link, nil)
+			w = httptest.NewRecorder()
+			at.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to verify the email : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to verify the email.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodGet, link, nil)
+			w = httptest.NewRecorder()
+			at.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to use the link twice : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to use the link twice.", tests.Success, testID)
+
+			if code := at.token(t, "jane@example.com", "gophers-unite"); code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould get a token after verifying the email : got %d.", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get a token after verifying the email.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodPost, "/v1/signup/resend", strings.NewReader(`{ "email": "jane@example.com" }`))
+			w = httptest.NewRecorder()
+			at.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNoContent || linkRegex.FindString(at.lastMail(t, "jane@example.com")) != link {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT send a link once the email is verified : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT send a link once the email is verified.", tests.Success, testID)
+		}
+	}
+}
+
+// token requests a token for the credentials and returns the status code.
+func (at *AccountTests) token(t *testing.T, email string, pass string) int {
+	r := httptest.NewRequest(http.MethodGet, "/v1/token/"+at.kid, nil)
+	w := httptest.NewRecorder()
+
+	r.SetBasicAuth(email, pass)
+	at.app.ServeHTTP(w, r)
+
+	return w.Code
+}
+
+// Regular expressions to find secrets in the sent emails.
+var (
+	linkRegex  = regexp.MustCompile(`/v1/signup/verify/[A-Za-z0-9_-]+`)
+	tokenRegex = regexp.MustCompile(`(?m)^[A-Za-z0-9_-]{43}$`)
+)
+
+// lastMail returns the content of the latest email sent to the address.
+func (at *AccountTests) lastMail(t *testing.T, to string) string {
+	files, err := os.ReadDir(at.mailDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var last string
+	for _, f := range files {
+		data, err := os.ReadFile(filepath.Join(at.mailDir, f.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "To: "+to+"\r\n") {
+			last = string(data)
+		}
+	}
+
+	return last
+}
+
+func (at *AccountTests) resetPassword(t *testing.T) {
+	now := time.Now()
+	claims := auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   tests.UserID,
+			IssuedAt:  jwt.NewNumericDate(now.Add(-time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+		Roles: []string{auth.RoleUser},
+	}
+
+	oldToken, err := at.auth.GenerateToken(at.kid, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log("Given the need for users to recover their accounts.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen resetting the password of an existing user.", testID)
+		{
+			if code := at.me(t, oldToken); code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to use the token before the reset : got %d.", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to use the token before the reset.", tests.Success, testID)
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/password/forgot", strings.NewReader(`{ "email": "nobody@example.com" }`))
+			w := httptest.NewRecorder()
+			at.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 204 for an unknown email : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 204 for an unknown email.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodPost, "/v1/password/forgot", strings.NewReader(`{ "email": "user@example.com" }`))
+			w = httptest.NewRecorder()
+			at.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 204 for the response : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 204 for the response.", tests.Success, testID)
+
+			token := tokenRegex.FindString(at.lastMail(t, "user@example.com"))
+			if token == "" {
+				t.Fatalf("\t%s\tTest %d:\tShould receive an email with the reset token.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive an email with the reset token.", tests.Success, testID)
+
+			body := `{ "token": "` + token + `", "password": "newgophers", "password_confirm": "newgophers" }`
+
+			r = httptest.NewRequest(http.MethodPost, "/v1/password/reset", strings.NewReader(body))
+			w = httptest.NewRecorder()
+			at.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reset the password : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to reset the password.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodPost, "/v1/password/reset", strings.NewReader(body))
+			w = httptest.NewRecorder()
+			at.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to use the reset token twice : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to use the reset token twice.", tests.Success, testID)
+
+			if code := at.me(t, oldToken); code != http.StatusUnauthorized {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to use a token issued before the reset : got %d.", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to use a token issued before the reset.", tests.Success, testID)
+
+			if code := at.token(t, "user@example.com", "gophers"); code != http.StatusUnauthorized {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT get a token with the old password : got %d.", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT get a token with the old password.", tests.Success, testID)
+
+			if code := at.token(t, "user@example.com", "newgophers"); code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould get a token with the new password : got %d.", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get a token with the new password.", tests.Success, testID)
+		}
+	}
+}
+
+// me requests the user the token belongs to and returns the status code.
+func (at *AccountTests) me(t *testing.T, token string) int {
+	r := httptest.NewRequest(http.MethodGet, "/v1/users/"+tests.UserID, nil)
+	w := httptest.NewRecorder()
+
+	r.Header.Add("Authorization", "Bearer "+token)
+	at.app.ServeHTTP(w, r)
+
+	return w.Code
+}
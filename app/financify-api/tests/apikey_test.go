@@ -0,0 +1,169 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/egorovdmi/financify/app/financify-api/handlers"
+	"github.com/egorovdmi/financify/business/data/apikey"
+	"github.com/egorovdmi/financify/business/tests"
+	"github.com/egorovdmi/financify/foundation/mail"
+)
+
+// seedScopeID is the scope owned by the seeded user.
+const seedScopeID = "79ee821f-0a5b-4416-a77c-176cbfa14e4d"
+
+// seedUserID is the seeded regular user.
+const seedUserID = "45b5fbd3-755f-4379-8f07-a58d4a30fa2f"
+
+type APIKeyTests struct {
+	app        http.Handler
+	userToken  string
+	adminToken string
+}
+
+func TestAPIKeys(t *testing.T) {
+	test := tests.NewIntegration(t)
+	t.Cleanup(test.Teardown)
+
+	shutdown := make(chan os.Signal, 1)
+	tests := APIKeyTests{
+		app: handlers.API(handlers.APIConfig{
+			Build:     "develop",
+			Shutdown:  shutdown,
+			Log:       test.Log,
+			Auth:      test.Auth,
+			DB:        test.DB,
+			Mailer:    mail.NewLogMailer(test.Log),
+			PublicURL: "http://localhost:3000",
+		}),
+		userToken:  test.Token(test.KID, "user@example.com", "gophers"),
+		adminToken: test.Token(test.KID, "admin@example.com", "gophers"),
+	}
+
+	t.Run("useAPIKey", tests.useAPIKey)
+	t.Run("keyPrivileges", tests.keyPrivileges)
+}
+
+func (kt *APIKeyTests) useAPIKey(t *testing.T) {
+	t.Log("Given the need to access the API with an API key.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using a read-only key.", testID)
+		{
+			body := `{ "name": "import script", "permissions": ["scope:read"] }`
+			w := kt.do(http.MethodPost, "/v1/apikeys", body, "Bearer "+kt.userToken)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 201 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 201 for the response.", tests.Success, testID)
+
+			var created struct {
+				apikey.APIKey
+				Key string `json:"key"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			if !strings.HasPrefix(created.Key, "fin_"+created.Prefix+"_") {
+				t.Fatalf("\t%s\tTest %d:\tShould get the key with its prefix : got %q.", tests.Failed, testID, created.Key)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the key with its prefix.", tests.Success, testID)
+
+			if w := kt.do(http.MethodGet, "/v1/scopes/"+seedScopeID, "", "ApiKey "+created.Key); w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould read the scope with the key : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould read the scope with the key.", tests.Success, testID)
+
+			if w := kt.do(http.MethodPut, "/v1/scopes/"+seedScopeID, `{ "title": "Hacked" }`, "ApiKey "+created.Key); w.Code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT write the scope with a read-only key : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT write the scope with a read-only key.", tests.Success, testID)
+
+			body = `{ "name": "escalation", "permissions": ["scope:write"] }`
+			if w := kt.do(http.MethodPost, "/v1/apikeys", body, "ApiKey "+created.Key); w.Code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT create a key with more permissions : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT create a key with more permissions.", tests.Success, testID)
+
+			w = kt.do(http.MethodGet, "/v1/apikeys", "", "Bearer "+kt.userToken)
+			var keys []apikey.APIKey
+			if err := json.NewDecoder(w.Body).Decode(&keys); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			if len(keys) != 1 || keys[0].DateLastUsed == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould list the key as used : got %+v.", tests.Failed, testID, keys)
+			}
+			t.Logf("\t%s\tTest %d:\tShould list the key as used.", tests.Success, testID)
+
+			if w := kt.do(http.MethodDelete, "/v1/apikeys/"+created.ID, "", "Bearer "+kt.userToken); w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to revoke the key : got %d.", tests.Failed, testID, w.Code)
+			}
+			if w := kt.do(http.MethodGet, "/v1/scopes/"+seedScopeID, "", "ApiKey "+created.Key); w.Code != http.StatusUnauthorized {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept a revoked key : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT accept a revoked key.", tests.Success, testID)
+		}
+	}
+}
+
+func (kt *APIKeyTests) keyPrivileges(t *testing.T) {
+	body := `{ "name": "reporting", "permissions": ["scope:read"] }`
+
+	t.Log("Given the need to keep API keys to their permissions.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using a read-only key of an admin.", testID)
+		{
+			key := kt.createKey(t, testID, kt.adminToken, body)
+
+			if w := kt.do(http.MethodGet, "/v1/users", "", "ApiKey "+key); w.Code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT reach an admin route : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT reach an admin route.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen using a read-only key of a user.", testID)
+		{
+			key := kt.createKey(t, testID, kt.userToken, body)
+
+			update := `{ "email": "taken-over@example.com" }`
+			if w := kt.do(http.MethodPut, "/v1/users/"+seedUserID, update, "ApiKey "+key); w.Code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT update the account : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT update the account.", tests.Success, testID)
+		}
+	}
+}
+
+// createKey creates a key with the token and returns the plain key.
+func (kt *APIKeyTests) createKey(t *testing.T, testID int, token string, body string) string {
+	w := kt.do(http.MethodPost, "/v1/apikeys", body, "Bearer "+token)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("\t%s\tTest %d:\tShould be able to create a key : got %d.", tests.Failed, testID, w.Code)
+	}
+
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+	}
+
+	return created.Key
+}
+
+func (kt *APIKeyTests) do(method string, path string, body string, authorization string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", authorization)
+	kt.app.ServeHTTP(w, r)
+
+	return w
+}
@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/egorovdmi/financify/app/financify-api/handlers"
+	"github.com/egorovdmi/financify/business/data/audit"
+	"github.com/egorovdmi/financify/business/tests"
+	"github.com/egorovdmi/financify/foundation/mail"
+)
+
+func TestAudit(t *testing.T) {
+	test := tests.NewIntegration(t)
+	t.Cleanup(test.Teardown)
+
+	shutdown := make(chan os.Signal, 1)
+	app := handlers.API(handlers.APIConfig{
+		Build:     "develop",
+		Shutdown:  shutdown,
+		Log:       test.Log,
+		Auth:      test.Auth,
+		DB:        test.DB,
+		Mailer:    mail.NewLogMailer(test.Log),
+		PublicURL: "http://localhost:3000",
+	})
+
+	userToken := test.Token(test.KID, "user@example.com", "gophers")
+	adminToken := test.Token(test.KID, "admin@example.com", "gophers")
+
+	t.Log("Given the need to read the audit log.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen an admin changes a user and reads the log.", testID)
+		{
+			r := httptest.NewRequest(http.MethodPut, "/v1/users/"+tests.UserID, strings.NewReader(`{ "name": "Audited" }`))
+			w := httptest.NewRecorder()
+			r.Header.Add("Authorization", "Bearer "+adminToken)
+			app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to update the user : got %d.", tests.Failed, testID, w.Code)
+			}
+
+			r = httptest.NewRequest(http.MethodGet, "/v1/audit?entity=user&entity_id="+tests.UserID+"&actor="+tests.AdminID, nil)
+			w = httptest.NewRecorder()
+			r.Header.Add("Authorization", "Bearer "+adminToken)
+			app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", tests.Success, testID)
+
+			var events []audit.Event
+			if err := json.NewDecoder(w.Body).Decode(&events); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould able to unmarshal the response : %v.", tests.Failed, testID, err)
+			}
+			if len(events) != 1 || events[0].Action != audit.ActionUpdate {
+				t.Fatalf("\t%s\tTest %d:\tShould get the update event : got %+v.", tests.Failed, testID, events)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the update event.", tests.Success, testID)
+		}
+
+		table := []struct {
+			name   string
+			path   string
+			token  string
+			status int
+		}{
+			{"a user reads the log", "/v1/audit", userToken, http.StatusForbidden},
+			{"an admin sends a malformed time", "/v1/audit?since=yesterday", adminToken, http.StatusBadRequest},
+			{"an admin sends a malformed actor", "/v1/audit?actor=123", adminToken, http.StatusBadRequest},
+		}
+
+		for i, tt := range table {
+			testID := i + 1
+			t.Logf("\tTest %d:\tWhen %s.", testID, tt.name)
+			{
+				r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+				w := httptest.NewRecorder()
+				r.Header.Add("Authorization", "Bearer "+tt.token)
+				app.ServeHTTP(w, r)
+
+				if w.Code != tt.status {
+					t.Fatalf("\t%s\tTest %d:\tShould receive a status code of %d for the response : got %d.", tests.Failed, testID, tt.status, w.Code)
+				}
+				t.Logf("\t%s\tTest %d:\tShould receive a status code of %d for the response.", tests.Success, testID, tt.status)
+			}
+		}
+	}
+}
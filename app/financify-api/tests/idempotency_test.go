@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/egorovdmi/financify/app/financify-api/handlers"
+	"github.com/egorovdmi/financify/business/data/scope"
+	"github.com/egorovdmi/financify/business/tests"
+	"github.com/egorovdmi/financify/foundation/mail"
+)
+
+func TestIdempotency(t *testing.T) {
+	test := tests.NewIntegration(t)
+	t.Cleanup(test.Teardown)
+
+	shutdown := make(chan os.Signal, 1)
+	app := handlers.API(handlers.APIConfig{
+		Build:     "develop",
+		Shutdown:  shutdown,
+		Log:       test.Log,
+		Auth:      test.Auth,
+		DB:        test.DB,
+		Mailer:    mail.NewLogMailer(test.Log),
+		PublicURL: "http://localhost:3000",
+	})
+
+	userToken := test.Token(test.KID, "user@example.com", "gophers")
+
+	post := func(body string, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/v1/scopes", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.Header.Add("Authorization", "Bearer "+userToken)
+		r.Header.Add("Idempotency-Key", key)
+		app.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Log("Given the need to safely retry requests.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a scope is created twice with the same key.", testID)
+		{
+			w := post(`{ "title": "Holidays" }`, "holidays-1")
+			if w.Code != http.StatusCreated {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 201 for the response : got %d.", tests.Failed, testID, w.Code)
+			}
+			var first scope.Scope
+			if err := json.NewDecoder(w.Body).Decode(&first); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould able to unmarshal the response : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 201 for the response.", tests.Success, testID)
+
+			w = post(`{ "title": "Holidays" }`, "holidays-1")
+			if w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "true" {
+				t.Fatalf("\t%s\tTest %d:\tShould receive the replayed response : got %d.", tests.Failed, testID, w.Code)
+			}
+			var second scope.Scope
+			if err := json.NewDecoder(w.Body).Decode(&second); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould able to unmarshal the response : %v.", tests.Failed, testID, err)
+			}
+			if second.ID != first.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould get the same scope : got %s want %s.", tests.Failed, testID, second.ID, first.ID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the same scope.", tests.Success, testID)
+
+			if w := post(`{ "title": "Groceries" }`, "holidays-1"); w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 422 for a different body : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 422 for a different body.", tests.Success, testID)
+
+			if w := post(`{ "title": "Holidays" }`, strings.Repeat("k", 256)); w.Code != http.StatusBadRequest {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 400 for a long key : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for a long key.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the client went away before the response was sent.", testID)
+		{
+			r := httptest.NewRequest(http.MethodPost, "/v1/scopes", strings.NewReader(`{ "title": "Car" }`))
+			r.Header.Add("Authorization", "Bearer "+userToken)
+			r.Header.Add("Idempotency-Key", "car-1")
+			app.ServeHTTP(brokenWriter{httptest.NewRecorder()}, r)
+
+			w := post(`{ "title": "Car" }`, "car-1")
+			if w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "true" {
+				t.Fatalf("\t%s\tTest %d:\tShould replay the response instead of creating the scope again : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould replay the response instead of creating the scope again.", tests.Success, testID)
+		}
+	}
+}
+
+// brokenWriter fails every write like a connection closed by the client.
+type brokenWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (brokenWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection reset by peer")
+}
@@ -0,0 +1,238 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egorovdmi/financify/app/financify-api/handlers"
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/core/session"
+	"github.com/egorovdmi/financify/business/tests"
+	"github.com/egorovdmi/financify/foundation/mail"
+	"github.com/egorovdmi/financify/foundation/oidc"
+	"github.com/egorovdmi/financify/foundation/oidc/oidctest"
+	"github.com/egorovdmi/financify/foundation/totp"
+)
+
+type OIDCTests struct {
+	app      http.Handler
+	auth     *auth.Auth
+	provider *oidctest.Provider
+	browser  *http.Client
+}
+
+func TestOIDC(t *testing.T) {
+	test := tests.NewIntegration(t)
+	t.Cleanup(test.Teardown)
+
+	fake, err := oidctest.NewProvider("financify", "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(fake.Close)
+
+	provider, err := oidc.New(context.Background(), oidc.Config{
+		Issuer:       fake.URL,
+		ClientID:     "financify",
+		ClientSecret: "s3cr3t",
+		RedirectURL:  "http://localhost:3000/v1/oidc/callback",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shutdown := make(chan os.Signal, 1)
+	tests := OIDCTests{
+		app: handlers.API(handlers.APIConfig{
+			Build:        "develop",
+			Shutdown:     shutdown,
+			Log:          test.Log,
+			Auth:         test.Auth,
+			DB:           test.DB,
+			Mailer:       mail.NewLogMailer(test.Log),
+			PublicURL:    "http://localhost:3000",
+			OIDC:         provider,
+			OIDCKeyID:    test.KID,
+			OIDCAutoLink: true,
+		}),
+		auth:     test.Auth,
+		provider: fake,
+		browser: &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+
+	t.Run("loginWithProvider", tests.loginWithProvider)
+}
+
+func (ot *OIDCTests) loginWithProvider(t *testing.T) {
+	t.Log("Given the need to log in with an external identity provider.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen an unknown identity logs in.", testID)
+		{
+			ot.provider.Login(oidctest.Identity{Subject: "ext-1", Email: "newbie@example.com", EmailVerified: true, Name: "Newbie"})
+
+			callback := ot.authorize(t)
+			w := ot.callback(callback)
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", tests.Success, testID)
+
+			first := ot.subject(t, w)
+
+			if w := ot.callback(callback); w.Code != http.StatusUnauthorized {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT complete the same login twice : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT complete the same login twice.", tests.Success, testID)
+
+			w = ot.callback(ot.authorize(t))
+			if second := ot.subject(t, w); second != first {
+				t.Fatalf("\t%s\tTest %d:\tShould log in as the same user again : got %q want %q.", tests.Failed, testID, second, first)
+			}
+			t.Logf("\t%s\tTest %d:\tShould log in as the same user again.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen an identity with the email of a user logs in.", testID)
+		{
+			ot.provider.Login(oidctest.Identity{Subject: "ext-2", Email: "user@example.com", EmailVerified: true})
+
+			w := ot.callback(ot.authorize(t))
+			if sub := ot.subject(t, w); sub != tests.UserID {
+				t.Fatalf("\t%s\tTest %d:\tShould link the identity to the user : got %q.", tests.Failed, testID, sub)
+			}
+			t.Logf("\t%s\tTest %d:\tShould link the identity to the user.", tests.Success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen an identity with an unverified email logs in.", testID)
+		{
+			ot.provider.Login(oidctest.Identity{Subject: "ext-3", Email: "admin@example.com"})
+
+			if w := ot.callback(ot.authorize(t)); w.Code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT link an unverified email : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT link an unverified email.", tests.Success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen an identity with the email of an admin logs in.", testID)
+		{
+			ot.provider.Login(oidctest.Identity{Subject: "ext-4", Email: "admin@example.com", EmailVerified: true})
+
+			if w := ot.callback(ot.authorize(t)); w.Code != http.StatusConflict {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT link a privileged user : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT link a privileged user.", tests.Success, testID)
+		}
+
+		testID = 4
+		t.Logf("\tTest %d:\tWhen a user with a second factor logs in.", testID)
+		{
+			ot.provider.Login(oidctest.Identity{Subject: "ext-2", Email: "user@example.com", EmailVerified: true})
+
+			var tkn session.Token
+			if err := json.NewDecoder(ot.callback(ot.authorize(t)).Body).Decode(&tkn); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			ot.enrollTOTP(t, tkn.Token)
+
+			tkn = session.Token{}
+			if err := json.NewDecoder(ot.callback(ot.authorize(t)).Body).Decode(&tkn); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			if !tkn.MFARequired || tkn.Token != "" || tkn.MFAToken == "" {
+				t.Fatalf("\t%s\tTest %d:\tShould require the second factor : got %+v.", tests.Failed, testID, tkn)
+			}
+			t.Logf("\t%s\tTest %d:\tShould require the second factor.", tests.Success, testID)
+		}
+	}
+}
+
+// authorize starts a login and lets the fake provider redirect back, returning
+// the callback URL.
+func (ot *OIDCTests) authorize(t *testing.T) *url.URL {
+	r := httptest.NewRequest(http.MethodGet, "/v1/oidc/login", nil)
+	w := httptest.NewRecorder()
+	ot.app.ServeHTTP(w, r)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("Should be redirected to the provider : got %d.", w.Code)
+	}
+
+	resp, err := ot.browser.Get(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return callback
+}
+
+// enrollTOTP enrolls and confirms a second factor for the user of the token.
+func (ot *OIDCTests) enrollTOTP(t *testing.T, token string) {
+	r := httptest.NewRequest(http.MethodPost, "/v1/mfa/totp", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	ot.app.ServeHTTP(w, r)
+
+	var e session.Enrollment
+	if err := json.NewDecoder(w.Body).Decode(&e); err != nil {
+		t.Fatalf("Should be able to enroll a second factor : %v", err)
+	}
+
+	code, err := totp.Code(e.Secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/v1/mfa/totp/confirm", strings.NewReader(`{ "code": "`+code+`" }`))
+	r.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	ot.app.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Should be able to confirm the second factor : got %d.", w.Code)
+	}
+}
+
+func (ot *OIDCTests) callback(callback *url.URL) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	w := httptest.NewRecorder()
+	ot.app.ServeHTTP(w, r)
+
+	return w
+}
+
+// subject returns the user the issued token belongs to.
+func (ot *OIDCTests) subject(t *testing.T, w *httptest.ResponseRecorder) string {
+	var tkn struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&tkn); err != nil {
+		t.Fatalf("Should be able to unmarshal the response : %v", err)
+	}
+
+	claims, err := ot.auth.ValidateToken(tkn.Token)
+	if err != nil {
+		t.Fatalf("Should get a valid token : %v", err)
+	}
+
+	return claims.Subject
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/egorovdmi/financify/app/financify-api/handlers"
+	"github.com/egorovdmi/financify/business/data/payment"
+	"github.com/egorovdmi/financify/business/tests"
+	"github.com/egorovdmi/financify/foundation/mail"
+)
+
+func TestPaymentBatch(t *testing.T) {
+	test := tests.NewIntegration(t)
+	t.Cleanup(test.Teardown)
+
+	shutdown := make(chan os.Signal, 1)
+	app := handlers.API(handlers.APIConfig{
+		Build:     "develop",
+		Shutdown:  shutdown,
+		Log:       test.Log,
+		Auth:      test.Auth,
+		DB:        test.DB,
+		Mailer:    mail.NewLogMailer(test.Log),
+		PublicURL: "http://localhost:3000",
+	})
+
+	userToken := test.Token(test.KID, "user@example.com", "gophers")
+
+	const walletID = "a11af2a9-9b3c-4950-bf8e-bf0d3c6399f2"
+
+	do := func(method string, path string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.Header.Add("Authorization", "Bearer "+userToken)
+		app.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Log("Given the need to enter many payments at once.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen posting batches to a wallet.", testID)
+		{
+			body := `{ "items": [
+				{ "product_name": "Bread", "product_quantity": 1, "amount": -2.5 },
+				{ "product_name": "Milk", "product_quantity": 0, "amount": -1 }
+			] }`
+			if w := do(http.MethodPost, "/v1/wallets/"+walletID+"/payments:batch", body); w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 422 for an atomic batch with an invalid item : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 422 for an atomic batch with an invalid item.", tests.Success, testID)
+
+			body = strings.Replace(body, `"items"`, `"mode": "best_effort", "items"`, 1)
+			w := do(http.MethodPost, "/v1/wallets/"+walletID+"/payments:batch", body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for a best effort batch : got %d.", tests.Failed, testID, w.Code)
+			}
+			var b payment.Batch
+			if err := json.NewDecoder(w.Body).Decode(&b); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould able to unmarshal the response : %v.", tests.Failed, testID, err)
+			}
+			if b.Applied != 1 || b.Failed != 1 || b.Balance != -250 {
+				t.Fatalf("\t%s\tTest %d:\tShould apply the valid item : got %+v.", tests.Failed, testID, b)
+			}
+			t.Logf("\t%s\tTest %d:\tShould apply the valid item.", tests.Success, testID)
+
+			w = do(http.MethodGet, "/v1/wallets/"+walletID+"/payments", "")
+			var payments []payment.Payment
+			if err := json.NewDecoder(w.Body).Decode(&payments); err != nil || len(payments) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould list the stored payment : got %d, %v.", tests.Failed, testID, len(payments), err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould list the stored payment.", tests.Success, testID)
+
+			if w := do(http.MethodPost, "/v1/wallets/"+tests.UserID+"/payments:batch", body); w.Code != http.StatusNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 404 for an unknown wallet : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 404 for an unknown wallet.", tests.Success, testID)
+
+			body = `{ "items": [ { "product_name": "Bread", "product_quantity": 1, "amount": -2.505 } ] }`
+			if w := do(http.MethodPost, "/v1/wallets/"+walletID+"/payments:batch", body); w.Code != http.StatusBadRequest {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 400 for fractions of a cent : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for fractions of a cent.", tests.Success, testID)
+
+			item := `{ "product_name": "Bread", "product_quantity": 1, "amount": -1 }`
+			body = `{ "items": [` + strings.Repeat(item+",", payment.MaxBatch) + item + `] }`
+			if w := do(http.MethodPost, "/v1/wallets/"+walletID+"/payments:batch", body); w.Code != http.StatusBadRequest {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 400 for more than %d items : got %d.", tests.Failed, testID, payment.MaxBatch, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for more than %d items.", tests.Success, testID, payment.MaxBatch)
+		}
+	}
+}
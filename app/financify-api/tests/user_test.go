@@ -3,6 +3,7 @@ package tests
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -13,11 +14,14 @@ import (
 	"github.com/egorovdmi/financify/business/auth"
 	"github.com/egorovdmi/financify/business/data/user"
 	"github.com/egorovdmi/financify/business/tests"
+	"github.com/egorovdmi/financify/foundation/logger"
+	"github.com/egorovdmi/financify/foundation/mail"
 	"github.com/google/go-cmp/cmp"
 )
 
 type UserTests struct {
 	app        http.Handler
+	logs       *bytes.Buffer
 	kid        string
 	userToken  string
 	adminToken string
@@ -27,24 +31,41 @@ func TestUsers(t *testing.T) {
 	test := tests.NewIntegration(t)
 	t.Cleanup(test.Teardown)
 
+	// Records are kept to make sure no secret ends up in them.
+	var logs bytes.Buffer
+	log := logger.New(io.MultiWriter(os.Stdout, &logs), logger.LevelDebug, logger.FormatText).With("service", "TEST")
+
 	shutdown := make(chan os.Signal, 1)
 	tests := UserTests{
-		app:        handlers.API("develop", shutdown, test.Log, test.Auth, test.DB),
+		app: handlers.API(handlers.APIConfig{
+			Build:     "develop",
+			Shutdown:  shutdown,
+			Log:       log,
+			Auth:      test.Auth,
+			DB:        test.DB,
+			Mailer:    mail.NewLogMailer(test.Log),
+			PublicURL: "http://localhost:3000",
+		}),
+		logs:       &logs,
 		kid:        test.KID,
 		userToken:  test.Token(test.KID, "user@example.com", "gophers"),
 		adminToken: test.Token(test.KID, "admin@example.com", "gophers"),
 	}
 
 	t.Run("crudUsers", tests.crudUsers)
+	t.Run("authorizeUsers", tests.authorizeUsers)
 }
 
 func (ut *UserTests) crudUsers(t *testing.T) {
 	nu := ut.postUser201(t)
 	defer ut.deleteUser204(t, nu.ID)
 
+	ut.postUser409(t)
 	ut.getUser200(t, nu.ID)
 	ut.putUser204(t, nu.ID)
 	ut.putUser403(t, nu.ID)
+	ut.conditionalUser(t, nu.ID)
+	ut.patchUser(t, nu.ID)
 }
 
 func (ut *UserTests) postUser201(t *testing.T) user.User {
@@ -52,8 +73,8 @@ func (ut *UserTests) postUser201(t *testing.T) user.User {
 		Name:            "John Smith",
 		Email:           "smith@example.com",
 		Roles:           []string{auth.RoleAdmin},
-		Password:        "gophers",
-		PasswordConfirm: "gophers",
+		Password:        "gophers-unite",
+		PasswordConfirm: "gophers-unite",
 	}
 
 	body, err := json.Marshal(&nu)
@@ -98,6 +119,46 @@ func (ut *UserTests) postUser201(t *testing.T) user.User {
 	return got
 }
 
+func (ut *UserTests) postUser409(t *testing.T) {
+	const password = "gophers-never-logged"
+
+	nu := user.NewUser{
+		Name:            "John Smith",
+		Email:           "smith@example.com",
+		Roles:           []string{auth.RoleUser},
+		Password:        password,
+		PasswordConfirm: password,
+	}
+
+	body, err := json.Marshal(&nu)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/users", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Add("Authorization", "Bearer "+ut.adminToken)
+	ut.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to keep passwords out of the logs.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen creating a user with a taken email.", testID)
+		{
+			if w.Code != http.StatusConflict {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 409 for the response : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 409 for the response.", tests.Success, testID)
+
+			if strings.Contains(ut.logs.String(), password) {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT write the password to the log.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT write the password to the log.", tests.Success, testID)
+		}
+	}
+}
+
 func (ut *UserTests) deleteUser204(t *testing.T, id string) {
 	r := httptest.NewRequest(http.MethodDelete, "/v1/users/"+id, nil)
 	w := httptest.NewRecorder()
@@ -224,3 +285,166 @@ func (ut *UserTests) putUser403(t *testing.T, id string) {
 		}
 	}
 }
+
+func (ut *UserTests) conditionalUser(t *testing.T, id string) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/users/"+id, nil)
+	w := httptest.NewRecorder()
+
+	r.Header.Add("Authorization", "Bearer "+ut.adminToken)
+	ut.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to make conditional requests for a user.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the ETag of the user.", testID)
+		{
+			etag := w.Header().Get("ETag")
+			if w.Code != http.StatusOK || etag == "" {
+				t.Fatalf("\t%s\tTest %d:\tShould receive an ETag with the user : got %d %q.", tests.Failed, testID, w.Code, etag)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive an ETag with the user.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodGet, "/v1/users/"+id, nil)
+			w = httptest.NewRecorder()
+
+			r.Header.Add("Authorization", "Bearer "+ut.adminToken)
+			r.Header.Add("If-None-Match", etag)
+			ut.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 304 without a body : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 304 without a body.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodPut, "/v1/users/"+id, strings.NewReader(`{ "name": "Bill Smith" }`))
+			w = httptest.NewRecorder()
+
+			r.Header.Add("Authorization", "Bearer "+ut.adminToken)
+			r.Header.Add("If-Match", `"0"`)
+			ut.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusPreconditionFailed {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 412 for a stale ETag : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 412 for a stale ETag.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodPut, "/v1/users/"+id, strings.NewReader(`{ "name": "Bill Smith" }`))
+			w = httptest.NewRecorder()
+
+			r.Header.Add("Authorization", "Bearer "+ut.adminToken)
+			r.Header.Add("If-Match", etag)
+			ut.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 204 for the current ETag : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 204 for the current ETag.", tests.Success, testID)
+		}
+	}
+}
+
+func (ut *UserTests) patchUser(t *testing.T, id string) {
+	patch := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPatch, "/v1/users/"+id, strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		r.Header.Add("Authorization", "Bearer "+ut.adminToken)
+		r.Header.Add("Content-Type", "application/merge-patch+json")
+		ut.app.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Log("Given the need to patch a user.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen sending a merge patch.", testID)
+		{
+			w := patch(`{ "name": "Patched Smith" }`)
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", tests.Success, testID)
+
+			var got user.User
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould able to unmarshal the response : %v.", tests.Failed, testID, err)
+			}
+			if got.Name != "Patched Smith" || got.Email != "smith@example.com" {
+				t.Fatalf("\t%s\tTest %d:\tShould change only the patched fields : got %q %q.", tests.Failed, testID, got.Name, got.Email)
+			}
+			t.Logf("\t%s\tTest %d:\tShould change only the patched fields.", tests.Success, testID)
+
+			if w := patch(`{ "name": null }`); w.Code != http.StatusBadRequest {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 400 for clearing a required field : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for clearing a required field.", tests.Success, testID)
+
+			if w := patch(`{ "id": "` + tests.AdminID + `" }`); w.Code != http.StatusBadRequest {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 400 for an unknown field : got %d.", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for an unknown field.", tests.Success, testID)
+
+			w = patch(`{ "email": "bill@example.com" }`)
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to change the email : got %d.", tests.Failed, testID, w.Code)
+			}
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould able to unmarshal the response : %v.", tests.Failed, testID, err)
+			}
+			if got.Email != "bill@example.com" || got.Verified {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT keep a changed email verified : got %q %v.", tests.Failed, testID, got.Email, got.Verified)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT keep a changed email verified.", tests.Success, testID)
+		}
+	}
+}
+
+func (ut *UserTests) authorizeUsers(t *testing.T) {
+	newAdmin := `{ "name": "Eve", "email": "eve@example.com", "roles": ["ADMIN"], "password": "gophers-unite", "password_confirm": "gophers-unite" }`
+	newUser := `{ "name": "Eve", "email": "eve@example.com", "roles": ["USER"], "password": "gophers-unite", "password_confirm": "gophers-unite" }`
+
+	table := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		token  string
+		status int
+	}{
+		{"a user lists users", http.MethodGet, "/v1/users", "", ut.userToken, http.StatusForbidden},
+		{"a user creates a user", http.MethodPost, "/v1/users", newUser, ut.userToken, http.StatusForbidden},
+		{"a user creates an admin", http.MethodPost, "/v1/users", newAdmin, ut.userToken, http.StatusForbidden},
+		{"a user reads another user", http.MethodGet, "/v1/users/" + tests.AdminID, "", ut.userToken, http.StatusForbidden},
+		{"a user updates another user", http.MethodPut, "/v1/users/" + tests.AdminID, `{ "name": "Eve" }`, ut.userToken, http.StatusForbidden},
+		{"a user promotes themselves", http.MethodPut, "/v1/users/" + tests.UserID, `{ "roles": ["ADMIN"] }`, ut.userToken, http.StatusForbidden},
+		{"a user deletes another user", http.MethodDelete, "/v1/users/" + tests.AdminID, "", ut.userToken, http.StatusForbidden},
+		{"a user unlocks an account", http.MethodPost, "/v1/users/" + tests.AdminID + "/unlock", "", ut.userToken, http.StatusForbidden},
+		{"an admin unlocks an account", http.MethodPost, "/v1/users/" + tests.UserID + "/unlock", "", ut.adminToken, http.StatusNoContent},
+		{"a user restores an account", http.MethodPost, "/v1/users/" + tests.AdminID + "/restore", "", ut.userToken, http.StatusForbidden},
+		{"an admin restores an account that isn't deleted", http.MethodPost, "/v1/users/" + tests.UserID + "/restore", "", ut.adminToken, http.StatusNotFound},
+		{"a user reads themselves", http.MethodGet, "/v1/users/" + tests.UserID, "", ut.userToken, http.StatusOK},
+		{"an admin lists users", http.MethodGet, "/v1/users", "", ut.adminToken, http.StatusOK},
+		{"an anonymous caller lists users", http.MethodGet, "/v1/users", "", "", http.StatusUnauthorized},
+	}
+
+	t.Log("Given the need to enforce authorization on every user route.")
+	{
+		for testID, tt := range table {
+			t.Logf("\tTest %d:\tWhen %s.", testID, tt.name)
+			{
+				r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+				w := httptest.NewRecorder()
+
+				if tt.token != "" {
+					r.Header.Add("Authorization", "Bearer "+tt.token)
+				}
+				ut.app.ServeHTTP(w, r)
+
+				if w.Code != tt.status {
+					t.Fatalf("\t%s\tTest %d:\tShould receive a status code of %d for the response : got %d.", tests.Failed, testID, tt.status, w.Code)
+				}
+				t.Logf("\t%s\tTest %d:\tShould receive a status code of %d for the response.", tests.Success, testID, tt.status)
+			}
+		}
+	}
+}
@@ -19,9 +19,27 @@ const Key ctxKey = 1
 type Claims struct {
 	jwt.RegisteredClaims
 	Roles []string `json:"roles"`
+
+	// MFAPending marks a challenge token issued after the password check that
+	// can only be exchanged for a real token with a second factor.
+	MFAPending bool `json:"mfa_pending,omitempty"`
+
+	// Permissions restricts the claims to a subset of what the roles carry,
+	// e.g. for API keys. Empty means no restriction.
+	Permissions []Permission `json:"permissions,omitempty"`
+
+	// APIKey marks the claims of an API key. They only grant the permissions
+	// of the key, never the roles of its owner.
+	APIKey bool `json:"api_key,omitempty"`
 }
 
+// Authorize checks if the claims carry any of the roles. Claims of an API key
+// never do, so role checks can't be passed with a key.
 func (c Claims) Authorize(roles ...string) bool {
+	if c.APIKey {
+		return false
+	}
+
 	for _, has := range c.Roles {
 		for _, want := range roles {
 			if has == want {
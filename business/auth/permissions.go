@@ -0,0 +1,47 @@
+package auth
+
+// Permission represents a single action that can be performed on a resource.
+type Permission string
+
+// Set of permissions known by the system.
+const (
+	PermScopeRead   Permission = "scope:read"
+	PermScopeWrite  Permission = "scope:write"
+	PermScopeManage Permission = "scope:manage"
+)
+
+// rolePermissions maps every role to the permissions it carries. A role only
+// defines what a user may ever do; access to a particular resource still
+// requires a grant for that resource unless the user is an admin. Both roles
+// carry the same permissions, every user manages the scopes they own, so what
+// sets an admin apart is skipping the grant check.
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {PermScopeRead, PermScopeWrite, PermScopeManage},
+	RoleUser:  {PermScopeRead, PermScopeWrite, PermScopeManage},
+}
+
+// HasPermission checks if any of the roles in the claims carries the
+// specified permission and the claims aren't restricted to other permissions.
+func (c Claims) HasPermission(perm Permission) bool {
+	if len(c.Permissions) > 0 {
+		restricted := true
+		for _, p := range c.Permissions {
+			if p == perm {
+				restricted = false
+				break
+			}
+		}
+		if restricted {
+			return false
+		}
+	}
+
+	for _, role := range c.Roles {
+		for _, p := range rolePermissions[role] {
+			if p == perm {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+// Package account provides the core business API for users managing their own
+// accounts, like signing up without the help of an admin.
+package account
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/user"
+	"github.com/egorovdmi/financify/foundation/logger"
+	"github.com/egorovdmi/financify/foundation/mail"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewSignup contains information needed for a user to sign up.
+type NewSignup struct {
+	Name            string `json:"name" validate:"required"`
+	Email           string `json:"email" validate:"required,email"`
+	Password        string `json:"password" validate:"required,password,nefold=Email"`
+	PasswordConfirm string `json:"password_confirm" validate:"eqfield=Password"`
+}
+
+// ResetPassword contains information needed to set a new password using a
+// reset token.
+type ResetPassword struct {
+	Token           string `json:"token" validate:"required"`
+	Password        string `json:"password" validate:"required,password"`
+	PasswordConfirm string `json:"password_confirm" validate:"eqfield=Password"`
+}
+
+// Core manages the set of API's for account access.
+type Core struct {
+	log       *logger.Logger
+	user      user.UserRepository
+	mailer    mail.Mailer
+	publicURL string
+}
+
+// NewCore constructs a core for account api access. The public URL is where
+// the API can be reached by users and is used to build links sent in emails.
+func NewCore(log *logger.Logger, db *sqlx.DB, mailer mail.Mailer, publicURL string) Core {
+	return Core{
+		log:       log,
+		user:      user.NewUserRepository(log, db),
+		mailer:    mailer,
+		publicURL: publicURL,
+	}
+}
+
+// Signup registers a new user with the USER role and sends them the link to
+// verify their email. The user can't sign in until the email is verified.
+func (c Core) Signup(ctx context.Context, traceID string, ns NewSignup, now time.Time) (user.User, error) {
+	currentSpan := trace.SpanFromContext(ctx)
+	ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.core.account.signup")
+	defer span.End()
+
+	nu := user.NewUser{
+		Name:            ns.Name,
+		Email:           ns.Email,
+		Roles:           []string{auth.RoleUser},
+		Password:        ns.Password,
+		PasswordConfirm: ns.PasswordConfirm,
+	}
+
+	usr, token, err := c.user.Register(ctx, traceID, nu, now)
+	if err != nil {
+		return user.User{}, err
+	}
+
+	if err := c.sendVerification(ctx, usr, token); err != nil {
+		return user.User{}, err
+	}
+
+	return usr, nil
+}
+
+// ResendVerification sends a new verification link to the email, e.g. when
+// the first one got lost or expired. Nothing happens for unknown or already
+// verified emails so the endpoint can't be used to discover accounts.
+func (c Core) ResendVerification(ctx context.Context, traceID string, email string, now time.Time) error {
+	currentSpan := trace.SpanFromContext(ctx)
+	ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.core.account.resendverification")
+	defer span.End()
+
+	usr, err := c.user.LookupByEmail(ctx, traceID, email)
+	if err != nil {
+		if err == user.ErrNotFound {
+			return nil
+		}
+		return errors.Wrap(err, "unable to query user by email")
+	}
+	if usr.Verified {
+		return nil
+	}
+
+	token, err := c.user.CreateVerification(ctx, traceID, usr.ID, now)
+	if err != nil {
+		return err
+	}
+
+	return c.sendVerification(ctx, usr, token)
+}
+
+// sendVerification emails the user the link verifying their email.
+func (c Core) sendVerification(ctx context.Context, usr user.User, token string) error {
+	msg := mail.Message{
+		To:      usr.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hello %s,\n\nplease verify your email by following the link below within %s:\n\n%s/v1/signup/verify/%s\n",
+			usr.Name, user.VerificationTTL, c.publicURL, token),
+	}
+
+	if err := c.mailer.Send(ctx, msg); err != nil {
+		return errors.Wrap(err, "sending verification email")
+	}
+
+	return nil
+}
+
+// Update modifies the user, see user.UserRepository.Update. A changed email
+// isn't verified anymore, so a link verifying the new one is sent.
+func (c Core) Update(ctx context.Context, traceID string, claims auth.Claims, userID string, uu user.UpdateUser, etag string, now time.Time) error {
+	currentSpan := trace.SpanFromContext(ctx)
+	ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.core.account.update")
+	defer span.End()
+
+	if err := c.user.Update(ctx, traceID, claims, userID, uu, etag, now); err != nil {
+		return err
+	}
+	if uu.Email == nil {
+		return nil
+	}
+
+	usr, err := c.user.LookupByID(ctx, traceID, userID)
+	if err != nil {
+		return errors.Wrap(err, "unable to query user by id")
+	}
+	if usr.Verified {
+		return nil
+	}
+
+	token, err := c.user.CreateVerification(ctx, traceID, usr.ID, now)
+	if err != nil {
+		return err
+	}
+
+	return c.sendVerification(ctx, usr, token)
+}
+
+// Verify activates the account the verification token was issued for.
+func (c Core) Verify(ctx context.Context, traceID string, token string, now time.Time) (user.User, error) {
+	currentSpan := trace.SpanFromContext(ctx)
+	ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.core.account.verify")
+	defer span.End()
+
+	return c.user.Verify(ctx, traceID, token, now)
+}
+
+// ForgotPassword sends a password reset token to the email. Nothing happens
+// for unknown emails so the endpoint can't be used to discover accounts.
+func (c Core) ForgotPassword(ctx context.Context, traceID string, email string, now time.Time) error {
+	currentSpan := trace.SpanFromContext(ctx)
+	ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.core.account.forgotpassword")
+	defer span.End()
+
+	usr, err := c.user.LookupByEmail(ctx, traceID, email)
+	if err != nil {
+		if err == user.ErrNotFound {
+			return nil
+		}
+		return errors.Wrap(err, "unable to query user by email")
+	}
+
+	token, err := c.user.CreatePasswordReset(ctx, traceID, usr.ID, now)
+	if err != nil {
+		return err
+	}
+
+	msg := mail.Message{
+		To:      usr.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nsomebody asked to reset the password of your account. Use the token below with %s/v1/password/reset within %s to set a new one:\n\n%s\n\nIf it wasn't you, just ignore this email.\n",
+			usr.Name, c.publicURL, user.PasswordResetTTL, token),
+	}
+
+	if err := c.mailer.Send(ctx, msg); err != nil {
+		return errors.Wrap(err, "sending password reset email")
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password using the token sent by ForgotPassword.
+// Every token issued for the user before the reset stops being valid.
+func (c Core) ResetPassword(ctx context.Context, traceID string, rp ResetPassword, now time.Time) error {
+	currentSpan := trace.SpanFromContext(ctx)
+	ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.core.account.resetpassword")
+	defer span.End()
+
+	return c.user.ResetPassword(ctx, traceID, rp.Token, rp.Password, now)
+}
@@ -0,0 +1,97 @@
+// Package purge provides the core business API for permanently removing
+// deleted records once their retention period is over.
+package purge
+
+import (
+	"context"
+	"time"
+
+	"github.com/egorovdmi/financify/business/data/idempotency"
+	"github.com/egorovdmi/financify/business/data/scope"
+	"github.com/egorovdmi/financify/business/data/user"
+	"github.com/egorovdmi/financify/business/data/wallet"
+	"github.com/egorovdmi/financify/foundation/logger"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Core manages the set of API's for purging deleted records.
+type Core struct {
+	log       *logger.Logger
+	user      user.UserRepository
+	scope     scope.ScopeRepository
+	wallet    wallet.WalletRepository
+	keys      idempotency.IdempotencyRepository
+	retention time.Duration
+}
+
+// NewCore constructs a core for purging records deleted longer than the
+// retention period ago.
+func NewCore(log *logger.Logger, db *sqlx.DB, retention time.Duration) Core {
+	return Core{
+		log:       log,
+		user:      user.NewUserRepository(log, db),
+		scope:     scope.NewScopeRepository(log, db),
+		wallet:    wallet.NewWalletRepository(log, db),
+		keys:      idempotency.NewIdempotencyRepository(log, db),
+		retention: retention,
+	}
+}
+
+// Purge permanently removes wallets, scopes and users deleted before the
+// retention period. Wallets go first so the ones belonging to purged scopes
+// and users are counted as their own. Expired idempotency keys are removed
+// as well.
+func (c Core) Purge(ctx context.Context, traceID string, now time.Time) error {
+	currentSpan := trace.SpanFromContext(ctx)
+	ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.core.purge.purge")
+	defer span.End()
+
+	before := now.Add(-c.retention)
+
+	wallets, err := c.wallet.Purge(ctx, traceID, before, now)
+	if err != nil {
+		return errors.Wrap(err, "purging wallets")
+	}
+
+	scopes, err := c.scope.Purge(ctx, traceID, before, now)
+	if err != nil {
+		return errors.Wrap(err, "purging scopes")
+	}
+
+	users, err := c.user.Purge(ctx, traceID, before, now)
+	if err != nil {
+		return errors.Wrap(err, "purging users")
+	}
+
+	keys, err := c.keys.Purge(ctx, traceID, now.Add(-idempotency.TTL))
+	if err != nil {
+		return errors.Wrap(err, "purging idempotency keys")
+	}
+
+	c.log.Info("purge completed", "trace_id", traceID, "before", before.UTC().Format(time.RFC3339),
+		"wallets", wallets, "scopes", scopes, "users", users, "idempotency_keys", keys)
+
+	return nil
+}
+
+// Run purges on every tick of the interval until the context is canceled.
+// Failures are logged and retried on the next tick.
+func (c Core) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.Purge(ctx, uuid.New().String(), time.Now()); err != nil {
+			c.log.Error("purge failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/egorovdmi/financify/business/data/mfa"
+	"github.com/egorovdmi/financify/business/data/user"
+	"github.com/egorovdmi/financify/foundation/totp"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Settings of the time-based one-time passwords handed out to users.
+const (
+	totpIssuer        = "Financify"
+	totpSkew          = 1
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 10
+)
+
+// recoveryEncoding is used to render recovery codes so they are easy to type.
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Enrollment contains what a user needs to set up their authenticator app.
+type Enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// EnrollTOTP generates a new secret for the user. The second factor isn't
+// enforced until the user confirms it with a valid code.
+func (c Core) EnrollTOTP(ctx context.Context, traceID string, userID string, now time.Time) (Enrollment, error) {
+	currentSpan := trace.SpanFromContext(ctx)
+	ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.core.session.enrolltotp")
+	defer span.End()
+
+	t, err := c.mfa.QueryTOTP(ctx, traceID, userID)
+	switch {
+	case err == nil && t.Confirmed:
+		return Enrollment{}, ErrMFAEnrolled
+	case err != nil && err != mfa.ErrNotFound:
+		return Enrollment{}, errors.Wrap(err, "unable to query second factor")
+	}
+
+	usr, err := c.user.LookupByID(ctx, traceID, userID)
+	if err != nil {
+		if err == user.ErrNotFound {
+			return Enrollment{}, ErrAuthenticationFailure
+		}
+		return Enrollment{}, errors.Wrap(err, "unable to query user by id")
+	}
+
+	s, err := totp.GenerateSecret()
+	if err != nil {
+		return Enrollment{}, errors.Wrap(err, "generating secret")
+	}
+
+	if _, err := c.mfa.SaveTOTP(ctx, traceID, usr.ID, s, now); err != nil {
+		return Enrollment{}, errors.Wrap(err, "saving secret")
+	}
+
+	e := Enrollment{
+		Secret: s,
+		URI:    totp.URI(totpIssuer, usr.Email, s),
+	}
+
+	return e, nil
+}
+
+// ConfirmTOTP activates the enrolled secret once the user proves they can
+// generate codes with it and returns a fresh set of recovery codes.
+func (c Core) ConfirmTOTP(ctx context.Context, traceID string, userID string, code string, now time.Time) ([]string, error) {
+	currentSpan := trace.SpanFromContext(ctx)
+	ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.core.session.confirmtotp")
+	defer span.End()
+
+	t, err := c.mfa.QueryTOTP(ctx, traceID, userID)
+	if err != nil {
+		if err == mfa.ErrNotFound {
+			return nil, ErrMFANotEnrolled
+		}
+		return nil, errors.Wrap(err, "unable to query second factor")
+	}
+
+	if t.Confirmed {
+		return nil, ErrMFAEnrolled
+	}
+
+	step, ok := totp.Validate(t.Secret, code, now, totpSkew)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashed := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, errors.Wrap(err, "reading random bytes")
+		}
+		s := strings.ToLower(recoveryEncoding.EncodeToString(b))
+		codes[i] = s[:8] + "-" + s[8:]
+		hashed[i] = normalizeRecoveryCode(codes[i])
+	}
+
+	if err := c.mfa.ConfirmTOTP(ctx, traceID, userID, step, hashed, now); err != nil {
+		return nil, errors.Wrap(err, "confirming second factor")
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP removes the second factor of the user after checking a valid
+// one-time password or recovery code.
+func (c Core) DisableTOTP(ctx context.Context, traceID string, userID string, code string, now time.Time) error {
+	currentSpan := trace.SpanFromContext(ctx)
+	ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.core.session.disabletotp")
+	defer span.End()
+
+	if err := c.checkCode(ctx, traceID, userID, code, now); err != nil {
+		return err
+	}
+
+	if err := c.mfa.DeleteTOTP(ctx, traceID, userID, now); err != nil {
+		return errors.Wrap(err, "deleting second factor")
+	}
+
+	return nil
+}
+
+// checkCode verifies the code against the confirmed second factor of the user.
+// Codes made of digits are treated as one-time passwords, which can be used
+// only once, anything else as a recovery code.
+func (c Core) checkCode(ctx context.Context, traceID string, userID string, code string, now time.Time) error {
+	t, err := c.mfa.QueryTOTP(ctx, traceID, userID)
+	if err != nil {
+		if err == mfa.ErrNotFound {
+			return ErrMFANotEnrolled
+		}
+		return errors.Wrap(err, "unable to query second factor")
+	}
+
+	if !t.Confirmed {
+		return ErrMFANotEnrolled
+	}
+
+	if isDigits(code) {
+		step, ok := totp.Validate(t.Secret, code, now, totpSkew)
+		if !ok || step <= t.LastStep {
+			return ErrInvalidCode
+		}
+
+		if err := c.mfa.UseStep(ctx, traceID, userID, step, now); err != nil {
+			if err == mfa.ErrStepUsed {
+				return ErrInvalidCode
+			}
+			return errors.Wrap(err, "recording used code")
+		}
+
+		return nil
+	}
+
+	if err := c.mfa.UseRecoveryCode(ctx, traceID, userID, normalizeRecoveryCode(code)); err != nil {
+		if err == mfa.ErrRecoveryCodeNotFound {
+			return ErrInvalidCode
+		}
+		return errors.Wrap(err, "using recovery code")
+	}
+
+	return nil
+}
+
+// normalizeRecoveryCode strips the formatting users may or may not type.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// isDigits reports whether the code looks like a one-time password.
+func isDigits(code string) bool {
+	if len(code) != totp.Digits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,431 @@
+// Package session provides the core business API for checking user credentials
+// and issuing access tokens.
+package session
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/apikey"
+	"github.com/egorovdmi/financify/business/data/mfa"
+	"github.com/egorovdmi/financify/business/data/user"
+	"github.com/egorovdmi/financify/business/sys/lockout"
+	"github.com/egorovdmi/financify/business/sys/pwhash"
+	"github.com/egorovdmi/financify/foundation/logger"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Set of error variables for session operations.
+var (
+	// ErrAuthenticationFailure occurs when a user attempts to authenticate but
+	// anything goes wrong.
+	ErrAuthenticationFailure = errors.New("authentication failed")
+
+	// ErrNotVerified occurs when a user with the right credentials hasn't
+	// verified their email yet.
+	ErrNotVerified = errors.New("email is not verified")
+
+	// ErrSessionRevoked occurs when a valid token was issued before the user
+	// revoked all of their sessions.
+	ErrSessionRevoked = errors.New("session revoked")
+
+	// ErrInvalidCode occurs when the provided one-time password or recovery
+	// code doesn't match.
+	ErrInvalidCode = errors.New("invalid verification code")
+
+	// ErrMFAEnrolled occurs when a user attempts to enroll a second factor
+	// while one is already active.
+	ErrMFAEnrolled = errors.New("second factor already enrolled")
+
+	// ErrMFANotEnrolled occurs when a second factor operation is requested by
+	// a user without one.
+	ErrMFANotEnrolled = errors.New("second factor not enrolled")
+)
+
+// Registered claims values used for every issued token.
+const (
+	issuer   = "service project"
+	audience = "students"
+	tokenTTL = time.Hour
+
+	// mfaTokenTTL limits the time between the password check and the second
+	// factor.
+	mfaTokenTTL = 5 * time.Minute
+)
+
+// Token is the result of a successful password check. Users with a second
+// factor get a challenge token instead which must be exchanged via VerifyMFA.
+type Token struct {
+	Token       string `json:"token,omitempty"`
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+}
+
+// LockedError is returned when too many failed attempts locked the login.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface.
+func (le *LockedError) Error() string {
+	return "too many failed attempts"
+}
+
+// Lockout contains the limiters throttling failed logins per account and per
+// client IP. A nil limiter disables the respective check.
+type Lockout struct {
+	Accounts *lockout.Limiter
+	IPs      *lockout.Limiter
+}
+
+// Core manages the set of API's for session access.
+type Core struct {
+	log     *logger.Logger
+	user    user.UserRepository
+	mfa     mfa.MFARepository
+	apikey  apikey.APIKeyRepository
+	auth    *auth.Auth
+	lockout Lockout
+}
+
+// NewCore constructs a core for session api access.
+func NewCore(log *logger.Logger, db *sqlx.DB, a *auth.Auth, lock Lockout) Core {
+	return Core{
+		log:     log,
+		user:    user.NewUserRepository(log, db),
+		mfa:     mfa.NewMFARepository(log, db),
+		apikey:  apikey.NewAPIKeyRepository(log, db),
+		auth:    a,
+		lockout: lock,
+	}
+}
+
+// Authenticate finds a user by their email and verifies their password. On
+// success it returns a Claims value representing this user. The claims can be
+// used to generate a token for future authentication.
+func (c Core) Authenticate(ctx context.Context, traceID string, email string, password string, now time.Time) (auth.Claims, error) {
+	currentSpan := trace.SpanFromContext(ctx)
+	ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.core.session.authenticate")
+	defer span.End()
+
+	usr, err := c.user.LookupByEmail(ctx, traceID, email)
+	if err != nil {
+		if err == user.ErrNotFound {
+			return auth.Claims{}, ErrAuthenticationFailure
+		}
+		return auth.Claims{}, errors.Wrap(err, "unable to query user by email")
+	}
+
+	if err := pwhash.Compare(usr.PasswordHash, password); err != nil {
+		return auth.Claims{}, ErrAuthenticationFailure
+	}
+
+	if !usr.Verified {
+		return auth.Claims{}, ErrNotVerified
+	}
+
+	// The password is only known right now, so outdated hashes get upgraded
+	// transparently. Failing to do so must not fail the login.
+	if pwhash.NeedsRehash(usr.PasswordHash) {
+		if err := c.rehash(ctx, traceID, usr.ID, password, now); err != nil {
+			c.log.Warn("rehash failed", "trace_id", traceID, "op", "session.Authenticate", "error", err)
+		}
+	}
+
+	return newClaims(usr, now), nil
+}
+
+// Token authenticates the user by email and password and issues a signed
+// token for them using the specified key. When the user has a confirmed second
+// factor a short-lived challenge token is issued instead. Repeated failures
+// for the same account or from the same IP lock the login temporarily.
+func (c Core) Token(ctx context.Context, traceID string, kid string, email string, password string, ip string, now time.Time) (Token, error) {
+	accountKey := accountKey(email)
+	if err := c.checkLockout(ctx, accountKey, ip, now); err != nil {
+		return Token{}, err
+	}
+
+	claims, err := c.Authenticate(ctx, traceID, email, password, now)
+	if err != nil {
+		if err == ErrAuthenticationFailure {
+			return Token{}, c.fail(ctx, traceID, accountKey, ip, now)
+		}
+		return Token{}, err
+	}
+
+	return c.issue(ctx, traceID, kid, accountKey, claims, now)
+}
+
+// Issue issues a token for the user authenticated by other means, e.g. by an
+// external identity provider. Like Token it issues a challenge token instead
+// when the user has a confirmed second factor.
+func (c Core) Issue(ctx context.Context, traceID string, kid string, userID string, now time.Time) (Token, error) {
+	usr, err := c.user.LookupByID(ctx, traceID, userID)
+	if err != nil {
+		return Token{}, errors.Wrap(err, "unable to query user by id")
+	}
+
+	return c.issue(ctx, traceID, kid, accountKey(usr.Email), newClaims(usr, now), now)
+}
+
+// issue signs the claims of an authenticated user, or a challenge token when
+// the user has a confirmed second factor.
+func (c Core) issue(ctx context.Context, traceID string, kid string, accountKey string, claims auth.Claims, now time.Time) (Token, error) {
+
+	// Failed attempts are only forgotten once a real token is issued, else
+	// logging in with the password would reset the lockout of the second
+	// factor.
+	t, err := c.mfa.QueryTOTP(ctx, traceID, claims.Subject)
+	switch {
+	case err == nil && t.Confirmed:
+		claims.MFAPending = true
+		claims.ExpiresAt = jwt.NewNumericDate(now.Add(mfaTokenTTL))
+
+		token, err := c.auth.GenerateToken(kid, claims)
+		if err != nil {
+			return Token{}, errors.Wrap(err, "generating mfa token")
+		}
+		return Token{MFARequired: true, MFAToken: token}, nil
+
+	case err != nil && err != mfa.ErrNotFound:
+		return Token{}, errors.Wrap(err, "unable to query second factor")
+	}
+
+	if err := c.lockout.Accounts.Reset(ctx, accountKey); err != nil {
+		return Token{}, errors.Wrap(err, "resetting failed attempts")
+	}
+
+	token, err := c.auth.GenerateToken(kid, claims)
+	if err != nil {
+		return Token{}, errors.Wrap(err, "generating token")
+	}
+
+	return Token{Token: token}, nil
+}
+
+// VerifyMFA exchanges a challenge token issued by Token or Issue together
+// with a one-time password or a recovery code for a real token.
+func (c Core) VerifyMFA(ctx context.Context, traceID string, kid string, mfaToken string, code string, now time.Time) (string, error) {
+	currentSpan := trace.SpanFromContext(ctx)
+	ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.core.session.verifymfa")
+	defer span.End()
+
+	claims, err := c.auth.ValidateToken(mfaToken)
+	if err != nil || !claims.MFAPending {
+		return "", ErrAuthenticationFailure
+	}
+
+	usr, err := c.user.LookupByID(ctx, traceID, claims.Subject)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound, user.ErrInvalidID:
+			return "", ErrAuthenticationFailure
+		default:
+			return "", errors.Wrap(err, "unable to query user by id")
+		}
+	}
+
+	accountKey := accountKey(usr.Email)
+	if err := c.checkLockout(ctx, accountKey, "", now); err != nil {
+		return "", err
+	}
+
+	if err := c.checkCode(ctx, traceID, usr.ID, code, now); err != nil {
+		if err == ErrInvalidCode {
+			if err := c.fail(ctx, traceID, accountKey, "", now); err != ErrAuthenticationFailure {
+				return "", err
+			}
+		}
+		return "", err
+	}
+
+	if err := c.lockout.Accounts.Reset(ctx, accountKey); err != nil {
+		return "", errors.Wrap(err, "resetting failed attempts")
+	}
+
+	token, err := c.auth.GenerateToken(kid, newClaims(usr, now))
+	if err != nil {
+		return "", errors.Wrap(err, "generating token")
+	}
+
+	return token, nil
+}
+
+// Validate checks the token is signed by us and the session it represents is
+// still active, returning the claims it carries.
+func (c Core) Validate(ctx context.Context, traceID string, token string) (auth.Claims, error) {
+	currentSpan := trace.SpanFromContext(ctx)
+	ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.core.session.validate")
+	defer span.End()
+
+	claims, err := c.auth.ValidateToken(token)
+	if err != nil {
+		return auth.Claims{}, ErrAuthenticationFailure
+	}
+
+	// Challenge tokens only prove the password, never grant access.
+	if claims.MFAPending {
+		return auth.Claims{}, ErrAuthenticationFailure
+	}
+
+	usr, err := c.user.LookupByID(ctx, traceID, claims.Subject)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound, user.ErrInvalidID:
+			return auth.Claims{}, ErrAuthenticationFailure
+		default:
+			return auth.Claims{}, errors.Wrap(err, "unable to query user by id")
+		}
+	}
+
+	// Issued at has a precision of a second, so tokens issued within the same
+	// second as the revocation are kept valid.
+	if usr.SessionsRevoked != nil && claims.IssuedAt != nil &&
+		claims.IssuedAt.Time.Before(usr.SessionsRevoked.Truncate(time.Second)) {
+		return auth.Claims{}, ErrSessionRevoked
+	}
+
+	return claims, nil
+}
+
+// ValidateAPIKey checks the key presented by a client and returns claims of
+// its owner restricted to the key's permissions. The claims never pass a role
+// check, see auth.Claims.Authorize.
+func (c Core) ValidateAPIKey(ctx context.Context, traceID string, key string, now time.Time) (auth.Claims, error) {
+	currentSpan := trace.SpanFromContext(ctx)
+	ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.core.session.validateapikey")
+	defer span.End()
+
+	k, err := c.apikey.Lookup(ctx, traceID, key, now)
+	if err != nil {
+		switch err {
+		case apikey.ErrNotFound, apikey.ErrInvalidKey, apikey.ErrExpired:
+			return auth.Claims{}, ErrAuthenticationFailure
+		default:
+			return auth.Claims{}, errors.Wrap(err, "unable to look up api key")
+		}
+	}
+
+	usr, err := c.user.LookupByID(ctx, traceID, k.UserID)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound, user.ErrInvalidID:
+			return auth.Claims{}, ErrAuthenticationFailure
+		default:
+			return auth.Claims{}, errors.Wrap(err, "unable to query user by id")
+		}
+	}
+
+	claims := newClaims(usr, now)
+	claims.ID = k.ID
+	claims.APIKey = true
+	claims.ExpiresAt = nil
+	if k.DateExpires != nil {
+		claims.ExpiresAt = jwt.NewNumericDate(*k.DateExpires)
+	}
+	for _, p := range k.Permissions {
+		claims.Permissions = append(claims.Permissions, auth.Permission(p))
+	}
+
+	return claims, nil
+}
+
+// rehash stores a new hash of the password using the configured algorithm.
+func (c Core) rehash(ctx context.Context, traceID string, userID string, password string, now time.Time) error {
+	hash, err := pwhash.Generate(password)
+	if err != nil {
+		return errors.Wrap(err, "generating password hash")
+	}
+
+	return c.user.UpdatePasswordHash(ctx, traceID, userID, hash, now)
+}
+
+// Unlock forgets the failed login attempts of the user.
+func (c Core) Unlock(ctx context.Context, traceID string, userID string) error {
+	usr, err := c.user.LookupByID(ctx, traceID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := c.lockout.Accounts.Reset(ctx, accountKey(usr.Email)); err != nil {
+		return errors.Wrap(err, "resetting failed attempts")
+	}
+
+	return nil
+}
+
+// checkLockout fails with a LockedError while the account or the IP is locked.
+func (c Core) checkLockout(ctx context.Context, accountKey string, ip string, now time.Time) error {
+	wait, err := c.lockout.Accounts.Wait(ctx, accountKey, now)
+	if err != nil {
+		return errors.Wrap(err, "checking account lockout")
+	}
+
+	if ip != "" {
+		ipWait, err := c.lockout.IPs.Wait(ctx, ip, now)
+		if err != nil {
+			return errors.Wrap(err, "checking ip lockout")
+		}
+		if ipWait > wait {
+			wait = ipWait
+		}
+	}
+
+	if wait > 0 {
+		return &LockedError{RetryAfter: wait}
+	}
+
+	return nil
+}
+
+// fail records a failed attempt for the account and the IP. It returns a
+// LockedError if that locked either of them, ErrAuthenticationFailure
+// otherwise.
+func (c Core) fail(ctx context.Context, traceID string, accountKey string, ip string, now time.Time) error {
+	wait, err := c.lockout.Accounts.Fail(ctx, accountKey, now)
+	if err != nil {
+		return errors.Wrap(err, "recording account failure")
+	}
+
+	if ip != "" {
+		ipWait, err := c.lockout.IPs.Fail(ctx, ip, now)
+		if err != nil {
+			return errors.Wrap(err, "recording ip failure")
+		}
+		if ipWait > wait {
+			wait = ipWait
+		}
+	}
+
+	if wait > 0 {
+		c.log.Warn("login locked", "trace_id", traceID, "op", "session.fail", "account", accountKey, "ip", ip, "wait", wait)
+		return &LockedError{RetryAfter: wait}
+	}
+
+	return ErrAuthenticationFailure
+}
+
+// accountKey identifies the account in the lockout stores regardless of
+// whether the email belongs to a user.
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// newClaims constructs the claims issued to the specified user.
+func newClaims(usr user.User, now time.Time) auth.Claims {
+	return auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   usr.ID,
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(tokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Roles: usr.Roles,
+	}
+}
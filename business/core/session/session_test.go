@@ -0,0 +1,303 @@
+package session_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/core/session"
+	"github.com/egorovdmi/financify/business/data/dbschema"
+	"github.com/egorovdmi/financify/business/data/user"
+	"github.com/egorovdmi/financify/business/sys/lockout"
+	"github.com/egorovdmi/financify/business/sys/pwhash"
+	"github.com/egorovdmi/financify/business/tests"
+	"github.com/egorovdmi/financify/foundation/totp"
+)
+
+func TestSession(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	ctx := tests.Context()
+	if err := dbschema.Seed(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const keyID = "7a7fb378-d885-43ad-aa25-a0b33bca287f"
+	lookup := func(kid string) (*rsa.PublicKey, error) {
+		return &privateKey.PublicKey, nil
+	}
+
+	a, err := auth.New("RS256", lookup, auth.Keys{keyID: privateKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sess := session.NewCore(log, db, a, session.Lockout{})
+
+	t.Log("Given the need to authenticate users and issue tokens.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling the seeded admin user.", testID)
+		{
+			now := time.Now()
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			claims, err := sess.Authenticate(ctx, traceID, "admin@example.com", "gophers", now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to authenticate: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to authenticate.", tests.Success, testID)
+
+			if claims.Subject != tests.AdminID {
+				t.Fatalf("\t%s\tTest %d:\tShould get claims for the admin : got %q want %q.", tests.Failed, testID, claims.Subject, tests.AdminID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get claims for the admin.", tests.Success, testID)
+
+			if !claims.Authorize(auth.RoleAdmin) {
+				t.Fatalf("\t%s\tTest %d:\tShould get the ADMIN role in the claims.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the ADMIN role in the claims.", tests.Success, testID)
+
+			token, err := sess.Token(ctx, traceID, keyID, "admin@example.com", "gophers", "", now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to issue a token: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to issue a token.", tests.Success, testID)
+
+			if _, err := a.ValidateToken(token.Token); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to validate the issued token: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to validate the issued token.", tests.Success, testID)
+
+			if _, err := sess.Validate(ctx, traceID, "not-a-token"); err != session.ErrAuthenticationFailure {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept a malformed token: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT accept a malformed token.", tests.Success, testID)
+
+			if _, err := sess.Authenticate(ctx, traceID, "admin@example.com", "wrong", now); err != session.ErrAuthenticationFailure {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT authenticate with a wrong password: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT authenticate with a wrong password.", tests.Success, testID)
+
+			if _, err := sess.Authenticate(ctx, traceID, "nobody@example.com", "gophers", now); err != session.ErrAuthenticationFailure {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT authenticate an unknown email: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT authenticate an unknown email.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen handling a user with a second factor.", testID)
+		{
+			now := time.Now()
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			e, err := sess.EnrollTOTP(ctx, traceID, tests.UserID, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to enroll a second factor: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to enroll a second factor.", tests.Success, testID)
+
+			step := totp.Step(now)
+			code, err := totp.Code(e.Secret, step)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			codes, err := sess.ConfirmTOTP(ctx, traceID, tests.UserID, code, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to confirm the second factor: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to confirm the second factor.", tests.Success, testID)
+
+			if len(codes) != 10 {
+				t.Fatalf("\t%s\tTest %d:\tShould get 10 recovery codes : got %d.", tests.Failed, testID, len(codes))
+			}
+			t.Logf("\t%s\tTest %d:\tShould get 10 recovery codes.", tests.Success, testID)
+
+			tkn, err := sess.Token(ctx, traceID, keyID, "user@example.com", "gophers", "", now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to pass the password check: %s.", tests.Failed, testID, err)
+			}
+			if !tkn.MFARequired || tkn.Token != "" || tkn.MFAToken == "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get only a challenge token : %+v.", tests.Failed, testID, tkn)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get only a challenge token.", tests.Success, testID)
+
+			if _, err := sess.Validate(ctx, traceID, tkn.MFAToken); err != session.ErrAuthenticationFailure {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept the challenge token as access token: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT accept the challenge token as access token.", tests.Success, testID)
+
+			if _, err := sess.VerifyMFA(ctx, traceID, keyID, tkn.MFAToken, code, now); err != session.ErrInvalidCode {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept an already used code: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT accept an already used code.", tests.Success, testID)
+
+			later := now.Add(totp.Period)
+			code, err = totp.Code(e.Secret, step+1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := sess.VerifyMFA(ctx, traceID, keyID, tkn.MFAToken, code, later)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould exchange the challenge and a new code: %s.", tests.Failed, testID, err)
+			}
+			if _, err := sess.Validate(ctx, traceID, token); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould get a valid access token: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould exchange the challenge and a new code.", tests.Success, testID)
+
+			if _, err := sess.VerifyMFA(ctx, traceID, keyID, tkn.MFAToken, codes[0], later); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould accept a recovery code: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept a recovery code.", tests.Success, testID)
+
+			if _, err := sess.VerifyMFA(ctx, traceID, keyID, tkn.MFAToken, codes[0], later); err != session.ErrInvalidCode {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept a recovery code twice: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT accept a recovery code twice.", tests.Success, testID)
+
+			if err := sess.DisableTOTP(ctx, traceID, tests.UserID, codes[1], later); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to disable the second factor: %s.", tests.Failed, testID, err)
+			}
+
+			tkn, err = sess.Token(ctx, traceID, keyID, "user@example.com", "gophers", "", later)
+			if err != nil || tkn.Token == "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get a token right away once disabled: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get a token right away once disabled.", tests.Success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen failing to log in repeatedly.", testID)
+		{
+			now := time.Now()
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			policy := lockout.Policy{Threshold: 2, Delay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+			sess := session.NewCore(log, db, a, session.Lockout{
+				Accounts: lockout.New(lockout.NewMemoryStore(time.Hour), policy),
+				IPs:      lockout.New(lockout.NewMemoryStore(time.Hour), policy),
+			})
+
+			for i := 0; i < policy.Threshold; i++ {
+				if _, err := sess.Token(ctx, traceID, keyID, "admin@example.com", "wrong", "10.0.0.1", now); err != session.ErrAuthenticationFailure {
+					t.Fatalf("\t%s\tTest %d:\tShould fail with a wrong password: %v.", tests.Failed, testID, err)
+				}
+			}
+
+			_, err := sess.Token(ctx, traceID, keyID, "admin@example.com", "wrong", "10.0.0.1", now)
+			var le *session.LockedError
+			if !errors.As(err, &le) || le.RetryAfter != time.Minute {
+				t.Fatalf("\t%s\tTest %d:\tShould lock the login after too many failures: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould lock the login after too many failures.", tests.Success, testID)
+
+			if _, err := sess.Token(ctx, traceID, keyID, "admin@example.com", "gophers", "10.0.0.2", now); !errors.As(err, &le) {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the account locked for the right password: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the account locked for the right password.", tests.Success, testID)
+
+			if _, err := sess.Token(ctx, traceID, keyID, "user@example.com", "gophers", "10.0.0.1", now); !errors.As(err, &le) {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the IP locked for other accounts: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the IP locked for other accounts.", tests.Success, testID)
+
+			if err := sess.Unlock(ctx, traceID, tests.AdminID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unlock the account: %s.", tests.Failed, testID, err)
+			}
+			if _, err := sess.Token(ctx, traceID, keyID, "admin@example.com", "gophers", "10.0.0.2", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould log in once the account is unlocked: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould log in once the account is unlocked.", tests.Success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen the hashing algorithm was changed.", testID)
+		{
+			now := time.Now()
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			cfg := pwhash.DefaultConfig
+			cfg.Algorithm = pwhash.Argon2id
+			cfg.Argon2Memory = 1024
+			if err := pwhash.Configure(cfg); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { pwhash.Configure(pwhash.DefaultConfig) })
+
+			if _, err := sess.Authenticate(ctx, traceID, "admin@example.com", "gophers", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould authenticate with the old hash: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould authenticate with the old hash.", tests.Success, testID)
+
+			usr, err := user.NewUserRepository(log, db).LookupByID(ctx, traceID, tests.AdminID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pwhash.NeedsRehash(usr.PasswordHash) {
+				t.Fatalf("\t%s\tTest %d:\tShould upgrade the hash on login : got %q.", tests.Failed, testID, usr.PasswordHash[:10])
+			}
+			t.Logf("\t%s\tTest %d:\tShould upgrade the hash on login.", tests.Success, testID)
+
+			if _, err := sess.Authenticate(ctx, traceID, "admin@example.com", "gophers", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould authenticate with the new hash: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould authenticate with the new hash.", tests.Success, testID)
+		}
+
+		testID = 4
+		t.Logf("\tTest %d:\tWhen failing the second factor repeatedly.", testID)
+		{
+			now := time.Now()
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			policy := lockout.Policy{Threshold: 2, Delay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+			sess := session.NewCore(log, db, a, session.Lockout{
+				Accounts: lockout.New(lockout.NewMemoryStore(time.Hour), policy),
+			})
+
+			e, err := sess.EnrollTOTP(ctx, traceID, tests.UserID, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to enroll a second factor: %s.", tests.Failed, testID, err)
+			}
+			code, err := totp.Code(e.Secret, totp.Step(now))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := sess.ConfirmTOTP(ctx, traceID, tests.UserID, code, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to confirm the second factor: %s.", tests.Failed, testID, err)
+			}
+
+			for i := 0; i < policy.Threshold; i++ {
+				tkn, err := sess.Token(ctx, traceID, keyID, "user@example.com", "gophers", "", now)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould pass the password check: %s.", tests.Failed, testID, err)
+				}
+				if _, err := sess.VerifyMFA(ctx, traceID, keyID, tkn.MFAToken, "000000", now); err != session.ErrInvalidCode {
+					t.Fatalf("\t%s\tTest %d:\tShould fail with a wrong code: %v.", tests.Failed, testID, err)
+				}
+			}
+
+			tkn, err := sess.Token(ctx, traceID, keyID, "user@example.com", "gophers", "", now)
+			var le *session.LockedError
+			if err == nil {
+				_, err = sess.VerifyMFA(ctx, traceID, keyID, tkn.MFAToken, "000000", now)
+			}
+			if !errors.As(err, &le) {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the second factor locked after a password check: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the second factor locked after a password check.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Package sso provides the core business API for logging in with an external
+// OpenID Connect provider.
+package sso
+
+import (
+	"context"
+	"time"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/core/session"
+	"github.com/egorovdmi/financify/business/data/identity"
+	"github.com/egorovdmi/financify/business/data/user"
+	"github.com/egorovdmi/financify/business/sys/secret"
+	"github.com/egorovdmi/financify/foundation/logger"
+	"github.com/egorovdmi/financify/foundation/oidc"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Set of error variables for single sign-on.
+var (
+	// ErrInvalidLogin occurs when the callback doesn't belong to a login we
+	// started, the code can't be exchanged or the ID token doesn't verify.
+	ErrInvalidLogin = errors.New("invalid login")
+
+	// ErrEmailNotVerified occurs when an unknown identity has no verified
+	// email a local user could be created or linked with.
+	ErrEmailNotVerified = errors.New("email not verified by the identity provider")
+
+	// ErrAccountExists occurs when an unknown identity has the email of a
+	// local user it may not be linked with automatically.
+	ErrAccountExists = errors.New("an account with this email already exists")
+)
+
+// Core manages the set of API's for single sign-on.
+type Core struct {
+	log      *logger.Logger
+	user     user.UserRepository
+	identity identity.IdentityRepository
+	session  session.Core
+	provider *oidc.Provider
+	autoLink bool
+}
+
+// NewCore constructs a core for single sign-on api access. With autoLink an
+// unknown identity is linked to the regular user with the same verified email,
+// otherwise such logins are refused. Users holding any other role are never
+// linked automatically.
+func NewCore(log *logger.Logger, db *sqlx.DB, sess session.Core, provider *oidc.Provider, autoLink bool) Core {
+	return Core{
+		log:      log,
+		user:     user.NewUserRepository(log, db),
+		identity: identity.NewIdentityRepository(log, db),
+		session:  sess,
+		provider: provider,
+		autoLink: autoLink,
+	}
+}
+
+// Begin starts a login and returns the URL of the provider's login page.
+func (c Core) Begin(ctx context.Context, traceID string, now time.Time) (string, error) {
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		return "", err
+	}
+
+	nonce, _, err := secret.New()
+	if err != nil {
+		return "", errors.Wrap(err, "generating nonce")
+	}
+
+	state, err := c.identity.CreateState(ctx, traceID, verifier, nonce, now)
+	if err != nil {
+		return "", errors.Wrap(err, "storing login state")
+	}
+
+	return c.provider.AuthCodeURL(state, nonce, verifier), nil
+}
+
+// Callback completes the login the provider redirected back from and issues
+// our own token, or a challenge for the second factor, for the linked user. Unknown identities get a new user, or are
+// linked to the user with the same verified email when allowed, see NewCore.
+func (c Core) Callback(ctx context.Context, traceID string, kid string, state string, code string, now time.Time) (session.Token, error) {
+	currentSpan := trace.SpanFromContext(ctx)
+	ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.core.sso.callback")
+	defer span.End()
+
+	st, err := c.identity.ConsumeState(ctx, traceID, state, now)
+	if err != nil {
+		switch err {
+		case identity.ErrStateNotFound, identity.ErrStateExpired:
+			return session.Token{}, ErrInvalidLogin
+		default:
+			return session.Token{}, errors.Wrap(err, "consuming login state")
+		}
+	}
+
+	rawIDToken, err := c.provider.Exchange(ctx, code, st.CodeVerifier)
+	if err != nil {
+		c.log.Warn("code exchange failed", "trace_id", traceID, "op", "sso.Callback", "error", err)
+		return session.Token{}, ErrInvalidLogin
+	}
+
+	claims, err := c.provider.Verify(ctx, rawIDToken, st.Nonce)
+	if err != nil {
+		c.log.Warn("id token verification failed", "trace_id", traceID, "op", "sso.Callback", "error", err)
+		return session.Token{}, ErrInvalidLogin
+	}
+
+	userID, err := c.link(ctx, traceID, claims, now)
+	if err != nil {
+		return session.Token{}, err
+	}
+
+	tkn, err := c.session.Issue(ctx, traceID, kid, userID, now)
+	if err != nil {
+		return session.Token{}, errors.Wrap(err, "issuing token")
+	}
+
+	return tkn, nil
+}
+
+// link returns the local user of the external identity, linking it first if
+// it's unknown.
+func (c Core) link(ctx context.Context, traceID string, claims oidc.IDClaims, now time.Time) (string, error) {
+	issuer := c.provider.Issuer()
+
+	id, err := c.identity.QueryByExternal(ctx, traceID, issuer, claims.Subject)
+	switch {
+	case err == nil:
+		return id.UserID, nil
+	case err != identity.ErrNotFound:
+		return "", errors.Wrap(err, "querying identity")
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return "", ErrEmailNotVerified
+	}
+
+	usr, err := c.user.LookupByEmail(ctx, traceID, claims.Email)
+	if err != nil {
+		if err != user.ErrNotFound {
+			return "", errors.Wrap(err, "querying user by email")
+		}
+
+		// The password is random since the user logs in at the provider.
+		password, _, err := secret.New()
+		if err != nil {
+			return "", errors.Wrap(err, "generating password")
+		}
+
+		name := claims.Name
+		if name == "" {
+			name = claims.Email
+		}
+
+		nu := user.NewUser{
+			Name:     name,
+			Email:    claims.Email,
+			Roles:    []string{auth.RoleUser},
+			Password: password,
+		}
+
+		usr, err = c.user.Create(ctx, traceID, nu, now)
+		if err != nil {
+			return "", errors.Wrap(err, "creating user")
+		}
+	} else if !c.autoLink || privileged(usr) {
+
+		// Anyone controlling the email at the provider would take over the
+		// account, so only regular users opting in are linked.
+		c.log.Warn("identity not linked", "trace_id", traceID, "op", "sso.link", "user_id", usr.ID, "issuer", issuer)
+		return "", ErrAccountExists
+	}
+
+	if _, err := c.identity.Create(ctx, traceID, issuer, claims.Subject, usr.ID, claims.Email, now); err != nil {
+		return "", errors.Wrap(err, "linking identity")
+	}
+
+	return usr.ID, nil
+}
+
+// privileged reports whether the user holds any role beyond a regular user.
+func privileged(usr user.User) bool {
+	for _, role := range usr.Roles {
+		if role != auth.RoleUser {
+			return true
+		}
+	}
+	return false
+}
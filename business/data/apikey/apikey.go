@@ -0,0 +1,215 @@
+// Package apikey contains the storage of API keys.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/audit"
+	"github.com/egorovdmi/financify/business/sys/secret"
+	"github.com/egorovdmi/financify/foundation/database"
+	"github.com/egorovdmi/financify/foundation/logger"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Set of error variables for CRUD operations.
+var (
+	ErrNotFound     = errors.New("api key not found")
+	ErrInvalidID    = errors.New("ID is not in its proper form")
+	ErrForbidden    = errors.New("attempted action is not allowed")
+	ErrInvalidKey   = errors.New("api key is not in its proper form")
+	ErrExpired      = errors.New("api key expired")
+	ErrPastExpiry   = errors.New("expiry must be in the future")
+	ErrNotPermitted = errors.New("api key can't carry permissions the creator doesn't hold")
+)
+
+// keyPrefix starts every key so it's recognizable, e.g. by secret scanners.
+// A key looks like fin_<prefix>_<secret> where the prefix identifies the key
+// and the secret proves its possession.
+const keyPrefix = "fin"
+
+// Entity names api keys in the audit log.
+const Entity = "api_key"
+
+type APIKeyRepository struct {
+	log *logger.Logger
+	db  *sqlx.DB
+}
+
+func NewAPIKeyRepository(log *logger.Logger, db *sqlx.DB) APIKeyRepository {
+	return APIKeyRepository{
+		log: log,
+		db:  db,
+	}
+}
+
+// Create generates a new key for the authenticated user and returns it
+// together with the plain key which is never available again.
+func (r APIKeyRepository) Create(ctx context.Context, traceID string, claims auth.Claims, nk NewAPIKey, now time.Time) (APIKey, string, error) {
+	for _, p := range nk.Permissions {
+		if !claims.HasPermission(auth.Permission(p)) {
+			return APIKey{}, "", ErrNotPermitted
+		}
+	}
+
+	if nk.DateExpires != nil && !nk.DateExpires.After(now) {
+		return APIKey{}, "", ErrPastExpiry
+	}
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return APIKey{}, "", errors.Wrap(err, "reading random bytes")
+	}
+	prefix := hex.EncodeToString(b)
+
+	token, hash, err := secret.New()
+	if err != nil {
+		return APIKey{}, "", errors.Wrap(err, "generating api key secret")
+	}
+
+	k := APIKey{
+		ID:          uuid.New().String(),
+		UserID:      claims.Subject,
+		Name:        nk.Name,
+		Prefix:      prefix,
+		SecretHash:  hash,
+		Permissions: nk.Permissions,
+		DateCreated: now.UTC(),
+	}
+	if nk.DateExpires != nil {
+		expires := nk.DateExpires.UTC()
+		k.DateExpires = &expires
+	}
+
+	const q = `INSERT INTO api_keys
+		(api_key_id, user_id, name, prefix, secret_hash, permissions, date_expires, date_created)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	err = database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "APIKeyRepository.Create",
+			"query", database.Log(q, k.ID, k.UserID, k.Name, k.Prefix, k.SecretHash, k.Permissions, k.DateExpires, k.DateCreated))
+
+		if _, err := tx.ExecContext(ctx, q, k.ID, k.UserID, k.Name, k.Prefix, k.SecretHash, k.Permissions, k.DateExpires, k.DateCreated); err != nil {
+			return errors.Wrap(err, "inserting api key")
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionCreate,
+			Entity:   Entity,
+			EntityID: k.ID,
+			After:    k,
+		}, now)
+	})
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	return k, keyPrefix + "_" + prefix + "_" + token, nil
+}
+
+// Query retrieves the keys of the authenticated user.
+func (r APIKeyRepository) Query(ctx context.Context, traceID string, claims auth.Claims) ([]APIKey, error) {
+	const q = `SELECT * FROM api_keys WHERE user_id=$1 ORDER BY date_created`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "APIKeyRepository.Query",
+		"query", database.Log(q, claims.Subject))
+
+	keys := []APIKey{}
+	if err := r.db.SelectContext(ctx, &keys, q, claims.Subject); err != nil {
+		return nil, errors.Wrap(err, "selecting api keys")
+	}
+
+	return keys, nil
+}
+
+// Delete revokes the key. Users can revoke their own keys, admins any key.
+func (r APIKeyRepository) Delete(ctx context.Context, traceID string, claims auth.Claims, keyID string, now time.Time) error {
+	if _, err := uuid.Parse(keyID); err != nil {
+		return ErrInvalidID
+	}
+
+	const qs = `SELECT * FROM api_keys WHERE api_key_id=$1`
+	const qd = `DELETE FROM api_keys WHERE api_key_id=$1`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "APIKeyRepository.Delete",
+		"query", database.Log(qs, keyID))
+
+	var k APIKey
+	if err := r.db.GetContext(ctx, &k, qs, keyID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return errors.Wrapf(err, "selecting api key %q", keyID)
+	}
+
+	if !claims.Authorize(auth.RoleAdmin) && k.UserID != claims.Subject {
+		return ErrForbidden
+	}
+
+	return database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "APIKeyRepository.Delete",
+			"query", database.Log(qd, keyID))
+
+		if _, err := tx.ExecContext(ctx, qd, keyID); err != nil {
+			return errors.Wrapf(err, "deleting api key %q", keyID)
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionDelete,
+			Entity:   Entity,
+			EntityID: k.ID,
+			Before:   k,
+		}, now)
+	})
+}
+
+// Lookup finds the key matching the plain key presented by a client and
+// records it as used. It's meant for authentication and has no claims.
+func (r APIKeyRepository) Lookup(ctx context.Context, traceID string, key string, now time.Time) (APIKey, error) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != keyPrefix {
+		return APIKey{}, ErrInvalidKey
+	}
+
+	const qs = `SELECT * FROM api_keys WHERE prefix=$1`
+	const qu = `UPDATE api_keys SET "date_last_used"=$2 WHERE api_key_id=$1`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "APIKeyRepository.Lookup",
+		"query", database.Log(qs, parts[1]))
+
+	var k APIKey
+	if err := r.db.GetContext(ctx, &k, qs, parts[1]); err != nil {
+		if err == sql.ErrNoRows {
+			return APIKey{}, ErrNotFound
+		}
+		return APIKey{}, errors.Wrapf(err, "selecting api key %q", parts[1])
+	}
+
+	if subtle.ConstantTimeCompare([]byte(secret.Hash(parts[2])), []byte(k.SecretHash)) != 1 {
+		return APIKey{}, ErrNotFound
+	}
+
+	if k.DateExpires != nil && now.After(*k.DateExpires) {
+		return APIKey{}, ErrExpired
+	}
+
+	lastUsed := now.UTC()
+	k.DateLastUsed = &lastUsed
+
+	r.log.Debug("query", "trace_id", traceID, "op", "APIKeyRepository.Lookup",
+		"query", database.Log(qu, k.ID, lastUsed))
+
+	if _, err := r.db.ExecContext(ctx, qu, k.ID, lastUsed); err != nil {
+		return APIKey{}, errors.Wrapf(err, "updating api key %q", k.ID)
+	}
+
+	return k, nil
+}
@@ -0,0 +1,29 @@
+package apikey
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APIKey represents a long-lived credential of a user for scripts and other
+// machines. Only the hash of its secret is stored.
+type APIKey struct {
+	ID           string         `db:"api_key_id" json:"id"`
+	UserID       string         `db:"user_id" json:"user_id"`
+	Name         string         `db:"name" json:"name"`
+	Prefix       string         `db:"prefix" json:"prefix"`
+	SecretHash   string         `db:"secret_hash" json:"-"`
+	Permissions  pq.StringArray `db:"permissions" json:"permissions"`
+	DateExpires  *time.Time     `db:"date_expires" json:"date_expires,omitempty"`
+	DateLastUsed *time.Time     `db:"date_last_used" json:"date_last_used,omitempty"`
+	DateCreated  time.Time      `db:"date_created" json:"date_created"`
+}
+
+// NewAPIKey contains information needed to create a new APIKey. The key can
+// only carry permissions the creator holds.
+type NewAPIKey struct {
+	Name        string     `json:"name" validate:"required"`
+	Permissions []string   `json:"permissions" validate:"required,min=1,dive,oneof=scope:read scope:write scope:manage"`
+	DateExpires *time.Time `json:"date_expires"`
+}
@@ -0,0 +1,188 @@
+// Package audit contains the append-only log of state-changing operations.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/foundation/database"
+	"github.com/egorovdmi/financify/foundation/logger"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Set of actions recorded in the log.
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionPurge   = "purge"
+)
+
+// Set of error variables for CRUD operations.
+var (
+	ErrInvalidID = errors.New("ID is not in its proper form")
+)
+
+// Query returns at most maxLimit events at once.
+const maxLimit = 1000
+
+// Record writes the event using the transaction of the operation it describes,
+// so either both or none are stored. The actor is taken from the claims of the
+// authenticated user in the context; operations without one, like signups,
+// have no actor.
+func Record(ctx context.Context, db sqlx.ExtContext, log *logger.Logger, traceID string, ne NewEvent, now time.Time) error {
+	changes, err := Diff(ne.Before, ne.After)
+	if err != nil {
+		return errors.Wrap(err, "computing changes")
+	}
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return errors.Wrap(err, "marshaling changes")
+	}
+
+	var actorID *string
+	if claims, ok := ctx.Value(auth.Key).(auth.Claims); ok && claims.Subject != "" {
+		actorID = &claims.Subject
+	}
+
+	e := Event{
+		ID:          uuid.New().String(),
+		ActorID:     actorID,
+		TraceID:     traceID,
+		Action:      ne.Action,
+		Entity:      ne.Entity,
+		EntityID:    ne.EntityID,
+		Changes:     data,
+		DateCreated: now.UTC(),
+	}
+
+	const q = `INSERT INTO audit_events
+		(event_id, actor_id, trace_id, action, entity, entity_id, changes, date_created)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	log.Debug("query", "trace_id", traceID, "op", "audit.Record",
+		"query", database.Log(q, e.ID, e.ActorID, e.TraceID, e.Action, e.Entity, e.EntityID, database.Redact(e.Changes), e.DateCreated))
+
+	if _, err := db.ExecContext(ctx, q, e.ID, e.ActorID, e.TraceID, e.Action, e.Entity, e.EntityID, []byte(e.Changes), e.DateCreated); err != nil {
+		return errors.Wrap(err, "inserting audit event")
+	}
+
+	return nil
+}
+
+// Diff compares the JSON representations of before and after and returns the
+// fields that differ.
+func Diff(before interface{}, after interface{}) (map[string]Change, error) {
+	b, err := toMap(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := toMap(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]Change)
+	for k, bv := range b {
+		if av, ok := a[k]; !ok || !reflect.DeepEqual(av, bv) {
+			changes[k] = Change{Before: bv, After: av}
+		}
+	}
+	for k, av := range a {
+		if _, ok := b[k]; !ok {
+			changes[k] = Change{After: av}
+		}
+	}
+
+	return changes, nil
+}
+
+func toMap(v interface{}) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return m, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// =============================================================================
+
+type AuditRepository struct {
+	log *logger.Logger
+	db  *sqlx.DB
+}
+
+func NewAuditRepository(log *logger.Logger, db *sqlx.DB) AuditRepository {
+	return AuditRepository{
+		log: log,
+		db:  db,
+	}
+}
+
+// Query retrieves the events matching the filter, newest first.
+func (r AuditRepository) Query(ctx context.Context, traceID string, f Filter) ([]Event, error) {
+	var where []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.ActorID != "" {
+		if _, err := uuid.Parse(f.ActorID); err != nil {
+			return nil, ErrInvalidID
+		}
+		add("actor_id = $%d", f.ActorID)
+	}
+	if f.Entity != "" {
+		add("entity = $%d", f.Entity)
+	}
+	if f.EntityID != "" {
+		add("entity_id = $%d", f.EntityID)
+	}
+	if !f.Since.IsZero() {
+		add("date_created >= $%d", f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		add("date_created < $%d", f.Until.UTC())
+	}
+
+	limit := f.Limit
+	if limit <= 0 || limit > maxLimit {
+		limit = maxLimit
+	}
+
+	q := `SELECT * FROM audit_events`
+	if len(where) > 0 {
+		q += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	q += fmt.Sprintf(` ORDER BY date_created DESC LIMIT %d`, limit)
+
+	r.log.Debug("query", "trace_id", traceID, "op", "AuditRepository.Query",
+		"query", database.Log(q, args...))
+
+	events := []Event{}
+	if err := r.db.SelectContext(ctx, &events, q, args...); err != nil {
+		return nil, errors.Wrap(err, "selecting audit events")
+	}
+
+	return events, nil
+}
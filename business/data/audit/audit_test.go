@@ -0,0 +1,174 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/audit"
+	"github.com/egorovdmi/financify/business/data/dbschema"
+	"github.com/egorovdmi/financify/business/data/user"
+	"github.com/egorovdmi/financify/business/tests"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestAudit(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	ctx := tests.Context()
+	if err := dbschema.Seed(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	ur := user.NewUserRepository(log, db)
+	ar := audit.NewAuditRepository(log, db)
+
+	t.Log("Given the need to record state-changing operations.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen an admin creates and updates a user.", testID)
+		{
+			now := time.Date(2022, time.October, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			claims := auth.Claims{
+				RegisteredClaims: jwt.RegisteredClaims{
+					Subject:   tests.AdminID,
+					ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+					IssuedAt:  jwt.NewNumericDate(now),
+				},
+				Roles: []string{auth.RoleAdmin},
+			}
+			ctx := context.WithValue(ctx, auth.Key, claims)
+
+			nu := user.NewUser{
+				Name:            "John",
+				Email:           "john@example.com",
+				Roles:           []string{auth.RoleUser},
+				Password:        "gophers-unite",
+				PasswordConfirm: "gophers-unite",
+			}
+
+			usr, err := ur.Create(ctx, traceID, nu, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a user: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create a user.", tests.Success, testID)
+
+			upd := user.UpdateUser{
+				Name: tests.StringPointer("Anna"),
+			}
+			if err := ur.Update(ctx, traceID, claims, usr.ID, upd, "", now.Add(time.Minute)); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to update a user: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to update a user.", tests.Success, testID)
+
+			events, err := ar.Query(ctx, traceID, audit.Filter{Entity: user.Entity, EntityID: usr.ID})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query events: %s.", tests.Failed, testID, err)
+			}
+			if len(events) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould get an event per operation : got %d want %d.", tests.Failed, testID, len(events), 2)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get an event per operation.", tests.Success, testID)
+
+			upEvent, crEvent := events[0], events[1]
+			if crEvent.Action != audit.ActionCreate || upEvent.Action != audit.ActionUpdate {
+				t.Fatalf("\t%s\tTest %d:\tShould get the newest event first : got %q, %q.", tests.Failed, testID, upEvent.Action, crEvent.Action)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the newest event first.", tests.Success, testID)
+
+			if upEvent.ActorID == nil || *upEvent.ActorID != tests.AdminID || upEvent.TraceID != traceID {
+				t.Fatalf("\t%s\tTest %d:\tShould record the actor and trace ID : got %v, %q.", tests.Failed, testID, upEvent.ActorID, upEvent.TraceID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould record the actor and trace ID.", tests.Success, testID)
+
+			var changes map[string]audit.Change
+			if err := json.Unmarshal(upEvent.Changes, &changes); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the changes: %s.", tests.Failed, testID, err)
+			}
+			if c, ok := changes["name"]; !ok || c.Before != "John" || c.After != "Anna" {
+				t.Fatalf("\t%s\tTest %d:\tShould record the changed name : got %+v.", tests.Failed, testID, changes)
+			}
+			if _, ok := changes["email"]; ok {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT record fields that didn't change : got %+v.", tests.Failed, testID, changes)
+			}
+			t.Logf("\t%s\tTest %d:\tShould record only the changed fields.", tests.Success, testID)
+
+			var crChanges map[string]audit.Change
+			if err := json.Unmarshal(crEvent.Changes, &crChanges); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the changes: %s.", tests.Failed, testID, err)
+			}
+			if _, ok := crChanges["password_hash"]; ok {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT record the password hash.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT record the password hash.", tests.Success, testID)
+
+			events, err = ar.Query(ctx, traceID, audit.Filter{ActorID: tests.AdminID, Since: now.Add(time.Second)})
+			if err != nil || len(events) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould filter events by actor and time : got %d, %v.", tests.Failed, testID, len(events), err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould filter events by actor and time.", tests.Success, testID)
+
+			upd = user.UpdateUser{
+				Password: tests.StringPointer("gophers-reunite"),
+			}
+			if err := ur.Update(ctx, traceID, claims, usr.ID, upd, "", now.Add(2*time.Minute)); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to change the password: %s.", tests.Failed, testID, err)
+			}
+			events, err = ar.Query(ctx, traceID, audit.Filter{Entity: user.Entity, EntityID: usr.ID, Since: now.Add(2 * time.Minute)})
+			if err != nil || len(events) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould get the password change event : got %d, %v.", tests.Failed, testID, len(events), err)
+			}
+			var pwChanges map[string]audit.Change
+			if err := json.Unmarshal(events[0].Changes, &pwChanges); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the changes: %s.", tests.Failed, testID, err)
+			}
+			if c, ok := pwChanges["password_changed"]; !ok || c.After != true {
+				t.Fatalf("\t%s\tTest %d:\tShould record the password change : got %+v.", tests.Failed, testID, pwChanges)
+			}
+			if _, ok := pwChanges["password_hash"]; ok {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT record the password hash.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould record the password change.", tests.Success, testID)
+
+			if _, err := db.ExecContext(ctx, `DELETE FROM audit_events`); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to delete events.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to delete events.", tests.Success, testID)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	type thing struct {
+		Name   string `json:"name"`
+		Secret string `json:"-"`
+		Count  int    `json:"count"`
+	}
+
+	t.Log("Given the need to compute the changes of an operation.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen comparing two values.", testID)
+		{
+			changes, err := audit.Diff(thing{"a", "x", 1}, thing{"b", "y", 1})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to diff: %s.", tests.Failed, testID, err)
+			}
+			if len(changes) != 1 || changes["name"].Before != "a" || changes["name"].After != "b" {
+				t.Fatalf("\t%s\tTest %d:\tShould get only the visible changed field : got %+v.", tests.Failed, testID, changes)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get only the visible changed field.", tests.Success, testID)
+
+			changes, err = audit.Diff(nil, thing{"a", "x", 1})
+			if err != nil || len(changes) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould get every field of a created value : got %+v, %v.", tests.Failed, testID, changes, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get every field of a created value.", tests.Success, testID)
+		}
+	}
+}
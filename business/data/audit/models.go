@@ -0,0 +1,45 @@
+package audit
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event represents a single state-changing operation.
+type Event struct {
+	ID          string          `db:"event_id" json:"id"`
+	ActorID     *string         `db:"actor_id" json:"actor_id"`
+	TraceID     string          `db:"trace_id" json:"trace_id"`
+	Action      string          `db:"action" json:"action"`
+	Entity      string          `db:"entity" json:"entity"`
+	EntityID    string          `db:"entity_id" json:"entity_id"`
+	Changes     json.RawMessage `db:"changes" json:"changes"`
+	DateCreated time.Time       `db:"date_created" json:"date_created"`
+}
+
+// NewEvent describes an operation to record. Before is nil for creations and
+// After is nil for deletions. Both are marshaled to JSON, so fields hidden from
+// JSON, like password hashes, never end up in the log.
+type NewEvent struct {
+	Action   string
+	Entity   string
+	EntityID string
+	Before   interface{}
+	After    interface{}
+}
+
+// Filter narrows down the events returned by Query. Zero values don't filter.
+type Filter struct {
+	ActorID  string
+	Entity   string
+	EntityID string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
+
+// Change is the value of a single field before and after an operation.
+type Change struct {
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
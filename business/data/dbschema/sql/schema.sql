@@ -96,3 +96,225 @@ CREATE TABLE payments (
 	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
 );
 CREATE INDEX payments_mm_idx ON payments (user_id, scope_id, wallet_id, payment_id);
+
+-- Version: 1.5
+-- Description: Create table grants
+CREATE TABLE grants (
+	grant_id     UUID,
+	user_id      UUID,
+	resource_id  UUID,
+	permission   TEXT,
+	date_created TIMESTAMP,
+
+	PRIMARY KEY (grant_id),
+	UNIQUE (user_id, resource_id, permission),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- Version: 1.6
+-- Description: Shared scopes with members and invitations
+CREATE TABLE scope_members (
+	scope_id     UUID,
+	user_id      UUID,
+	role         TEXT,
+	date_created TIMESTAMP,
+
+	PRIMARY KEY (scope_id, user_id),
+	FOREIGN KEY (scope_id) REFERENCES scopes(scope_id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+CREATE INDEX scope_members_user_idx ON scope_members (user_id);
+
+INSERT INTO scope_members (scope_id, user_id, role, date_created)
+	SELECT scope_id, user_id, 'OWNER', date_created FROM scopes WHERE user_id IS NOT NULL;
+
+INSERT INTO grants (grant_id, user_id, resource_id, permission, date_created)
+	SELECT gen_random_uuid(), m.user_id, m.scope_id, p.permission, m.date_created
+	FROM scope_members m
+	CROSS JOIN (VALUES ('scope:read'), ('scope:write'), ('scope:manage'), ('payments:approve')) AS p(permission)
+	ON CONFLICT DO NOTHING;
+
+CREATE TABLE scope_invitations (
+	invitation_id UUID,
+	scope_id      UUID,
+	email         TEXT,
+	role          TEXT,
+	token_hash    TEXT UNIQUE,
+	invited_by    UUID,
+	status        TEXT,
+	expires_at    TIMESTAMP,
+	date_created  TIMESTAMP,
+	date_updated  TIMESTAMP,
+
+	PRIMARY KEY (invitation_id),
+	FOREIGN KEY (scope_id) REFERENCES scopes(scope_id) ON DELETE CASCADE,
+	FOREIGN KEY (invited_by) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- Version: 1.7
+-- Description: Email verification for self-registered users
+ALTER TABLE users ADD COLUMN verified BOOLEAN NOT NULL DEFAULT TRUE;
+
+CREATE TABLE user_verifications (
+	token_hash   TEXT,
+	user_id      UUID,
+	expires_at   TIMESTAMP,
+	date_created TIMESTAMP,
+
+	PRIMARY KEY (token_hash),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- Version: 1.8
+-- Description: Password reset and session revocation
+ALTER TABLE users ADD COLUMN date_sessions_revoked TIMESTAMP;
+
+CREATE TABLE password_resets (
+	token_hash   TEXT,
+	user_id      UUID,
+	expires_at   TIMESTAMP,
+	date_created TIMESTAMP,
+
+	PRIMARY KEY (token_hash),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- Version: 1.9
+-- Description: Time-based one-time passwords as a second factor
+CREATE TABLE user_totp (
+	user_id      UUID,
+	secret       TEXT,
+	confirmed    BOOLEAN,
+	last_step    BIGINT,
+	date_created TIMESTAMP,
+	date_updated TIMESTAMP,
+
+	PRIMARY KEY (user_id),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE user_recovery_codes (
+	code_hash    TEXT,
+	user_id      UUID,
+	date_created TIMESTAMP,
+
+	PRIMARY KEY (code_hash),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- Version: 2.0
+-- Description: API keys for machine-to-machine access
+CREATE TABLE api_keys (
+	api_key_id     UUID,
+	user_id        UUID,
+	name           TEXT,
+	prefix         TEXT UNIQUE,
+	secret_hash    TEXT,
+	permissions    TEXT[],
+	date_expires   TIMESTAMP,
+	date_last_used TIMESTAMP,
+	date_created   TIMESTAMP,
+
+	PRIMARY KEY (api_key_id),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- Version: 2.1
+-- Description: Identities at external OpenID Connect providers
+CREATE TABLE user_identities (
+	issuer       TEXT,
+	subject      TEXT,
+	user_id      UUID,
+	email        TEXT,
+	date_created TIMESTAMP,
+
+	PRIMARY KEY (issuer, subject),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE oidc_states (
+	state_hash    TEXT,
+	code_verifier TEXT,
+	nonce         TEXT,
+	expires_at    TIMESTAMP,
+	date_created  TIMESTAMP,
+
+	PRIMARY KEY (state_hash)
+);
+
+-- Version: 2.2
+-- Description: Append-only audit log of state-changing operations
+CREATE TABLE audit_events (
+	event_id     UUID,
+	actor_id     UUID,
+	trace_id     TEXT,
+	action       TEXT,
+	entity       TEXT,
+	entity_id    TEXT,
+	changes      JSONB,
+	date_created TIMESTAMP,
+
+	PRIMARY KEY (event_id)
+);
+
+CREATE INDEX audit_events_actor_idx ON audit_events (actor_id, date_created);
+CREATE INDEX audit_events_entity_idx ON audit_events (entity, entity_id, date_created);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+	BEFORE UPDATE OR DELETE ON audit_events
+	FOR EACH ROW EXECUTE PROCEDURE audit_events_append_only();
+
+-- Version: 2.3
+-- Description: Soft delete for users, scopes and wallets
+ALTER TABLE users ADD COLUMN date_deleted TIMESTAMP;
+ALTER TABLE scopes ADD COLUMN date_deleted TIMESTAMP;
+ALTER TABLE wallets ADD COLUMN date_deleted TIMESTAMP;
+
+ALTER TABLE users DROP CONSTRAINT users_email_key;
+CREATE UNIQUE INDEX users_email_active_idx ON users (email) WHERE date_deleted IS NULL;
+
+-- Version: 2.4
+-- Description: Versions for optimistic concurrency
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE scopes ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE wallets ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- Version: 2.5
+-- Description: Idempotency keys of retried requests
+CREATE TABLE idempotency_keys (
+	idempotency_key TEXT,
+	user_id         UUID,
+	request_hash    TEXT,
+	status_code     INTEGER NOT NULL DEFAULT 0,
+	header          JSONB NOT NULL DEFAULT '{}',
+	body            BYTEA NOT NULL DEFAULT '',
+	date_created    TIMESTAMP,
+
+	PRIMARY KEY (user_id, idempotency_key),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idempotency_keys_created_idx ON idempotency_keys (date_created);
+
+-- Version: 2.6
+-- Description: Identify payments by their own ID
+ALTER TABLE payments DROP CONSTRAINT payments_pkey;
+ALTER TABLE payments ADD PRIMARY KEY (payment_id);
+CREATE INDEX payments_wallet_idx ON payments (wallet_id, date_created);
+
+-- Version: 2.7
+-- Description: Exact amounts of money for payment batches
+ALTER TABLE scopes ALTER COLUMN amount TYPE NUMERIC(14,2) USING amount::numeric;
+ALTER TABLE wallets ALTER COLUMN amount TYPE NUMERIC(14,2) USING amount::numeric;
+ALTER TABLE payments ALTER COLUMN amount TYPE NUMERIC(14,2) USING amount::numeric;
+
+-- Version: 2.8
+-- Description: Drop the payments:approve permission nothing checks
+DELETE FROM grants WHERE permission = 'payments:approve';
+UPDATE api_keys SET permissions = array_remove(permissions, 'payments:approve');
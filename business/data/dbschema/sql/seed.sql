@@ -7,6 +7,16 @@ INSERT INTO scopes (scope_id, user_id, title, amount, date_created, date_updated
 	('79ee821f-0a5b-4416-a77c-176cbfa14e4d', '45b5fbd3-755f-4379-8f07-a58d4a30fa2f', 'Домашняя бухгалтерия', 0, '2022-06-17 00:00:00', '2022-06-17 00:00:00')
 	ON CONFLICT DO NOTHING;
 
+INSERT INTO scope_members (scope_id, user_id, role, date_created) VALUES
+	('79ee821f-0a5b-4416-a77c-176cbfa14e4d', '45b5fbd3-755f-4379-8f07-a58d4a30fa2f', 'OWNER', '2022-06-17 00:00:00')
+	ON CONFLICT DO NOTHING;
+
 INSERT INTO wallets (wallet_id, scope_id, user_id, title, amount, date_created, date_updated) VALUES
 	('a11af2a9-9b3c-4950-bf8e-bf0d3c6399f2', '79ee821f-0a5b-4416-a77c-176cbfa14e4d', '45b5fbd3-755f-4379-8f07-a58d4a30fa2f', 'Наличные', 0, '2022-06-17 00:00:00', '2022-06-17 00:00:00')
 	ON CONFLICT DO NOTHING;
+
+INSERT INTO grants (grant_id, user_id, resource_id, permission, date_created) VALUES
+	('0b6c4f4e-6a8e-4d55-b5a9-1b4a6f0f5d01', '45b5fbd3-755f-4379-8f07-a58d4a30fa2f', '79ee821f-0a5b-4416-a77c-176cbfa14e4d', 'scope:read', '2022-06-17 00:00:00'),
+	('0b6c4f4e-6a8e-4d55-b5a9-1b4a6f0f5d02', '45b5fbd3-755f-4379-8f07-a58d4a30fa2f', '79ee821f-0a5b-4416-a77c-176cbfa14e4d', 'scope:write', '2022-06-17 00:00:00'),
+	('0b6c4f4e-6a8e-4d55-b5a9-1b4a6f0f5d04', '45b5fbd3-755f-4379-8f07-a58d4a30fa2f', '79ee821f-0a5b-4416-a77c-176cbfa14e4d', 'scope:manage', '2022-06-17 00:00:00')
+	ON CONFLICT DO NOTHING;
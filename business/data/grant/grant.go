@@ -0,0 +1,163 @@
+// Package grant contains the storage of per-resource permissions given to users.
+package grant
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/audit"
+	"github.com/egorovdmi/financify/foundation/database"
+	"github.com/egorovdmi/financify/foundation/logger"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Set of error variables for CRUD operations.
+var (
+	ErrNotFound  = errors.New("grant not found")
+	ErrInvalidID = errors.New("ID is not in its proper form")
+)
+
+// Entity names grants in the audit log.
+const Entity = "grant"
+
+type GrantRepository struct {
+	log *logger.Logger
+	db  *sqlx.DB
+}
+
+func NewGrantRepository(log *logger.Logger, db *sqlx.DB) GrantRepository {
+	return GrantRepository{
+		log: log,
+		db:  db,
+	}
+}
+
+// Create gives the user the permission on the resource. Granting a permission
+// that is already held is not an error.
+func (r GrantRepository) Create(ctx context.Context, traceID string, ng NewGrant, now time.Time) (Grant, error) {
+	if _, err := uuid.Parse(ng.UserID); err != nil {
+		return Grant{}, ErrInvalidID
+	}
+	if _, err := uuid.Parse(ng.ResourceID); err != nil {
+		return Grant{}, ErrInvalidID
+	}
+
+	g := Grant{
+		ID:          uuid.New().String(),
+		UserID:      ng.UserID,
+		ResourceID:  ng.ResourceID,
+		Permission:  ng.Permission,
+		DateCreated: now.UTC(),
+	}
+
+	const q = `INSERT INTO grants
+		(grant_id, user_id, resource_id, permission, date_created)
+		VALUES($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, resource_id, permission) DO UPDATE SET permission=EXCLUDED.permission
+		RETURNING grant_id, date_created`
+
+	err := database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "GrantRepository.Create",
+			"query", database.Log(q, g.ID, g.UserID, g.ResourceID, g.Permission, g.DateCreated))
+
+		id := g.ID
+		row := tx.QueryRowxContext(ctx, q, g.ID, g.UserID, g.ResourceID, g.Permission, g.DateCreated)
+		if err := row.Scan(&g.ID, &g.DateCreated); err != nil {
+			return errors.Wrap(err, "inserting grant")
+		}
+
+		// An existing grant was returned, nothing changed.
+		if g.ID != id {
+			return nil
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionCreate,
+			Entity:   Entity,
+			EntityID: g.ID,
+			After:    g,
+		}, now)
+	})
+	if err != nil {
+		return Grant{}, err
+	}
+
+	return g, nil
+}
+
+// Delete revokes the specified grant.
+func (r GrantRepository) Delete(ctx context.Context, traceID string, grantID string, now time.Time) error {
+	if _, err := uuid.Parse(grantID); err != nil {
+		return ErrInvalidID
+	}
+
+	const q = `DELETE FROM grants WHERE grant_id=$1 RETURNING *`
+
+	return database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "GrantRepository.Delete",
+			"query", database.Log(q, grantID))
+
+		var g Grant
+		if err := tx.GetContext(ctx, &g, q, grantID); err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return errors.Wrap(err, "deleting grant")
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionDelete,
+			Entity:   Entity,
+			EntityID: g.ID,
+			Before:   g,
+		}, now)
+	})
+}
+
+// QueryByResource retrieves all grants given on the specified resource.
+func (r GrantRepository) QueryByResource(ctx context.Context, traceID string, resourceID string) ([]Grant, error) {
+	if _, err := uuid.Parse(resourceID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	const q = `SELECT * FROM grants WHERE resource_id=$1 ORDER BY date_created`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "GrantRepository.QueryByResource",
+		"query", database.Log(q, resourceID))
+
+	grants := []Grant{}
+	if err := r.db.SelectContext(ctx, &grants, q, resourceID); err != nil {
+		return nil, errors.Wrapf(err, "selecting grants for resource %q", resourceID)
+	}
+
+	return grants, nil
+}
+
+// Exists checks if the user holds the permission on the resource.
+func (r GrantRepository) Exists(ctx context.Context, traceID string, userID string, resourceID string, perm auth.Permission) (bool, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return false, ErrInvalidID
+	}
+	if _, err := uuid.Parse(resourceID); err != nil {
+		return false, ErrInvalidID
+	}
+
+	const q = `SELECT grant_id FROM grants WHERE user_id=$1 AND resource_id=$2 AND permission=$3`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "GrantRepository.Exists",
+		"query", database.Log(q, userID, resourceID, string(perm)))
+
+	var id string
+	if err := r.db.GetContext(ctx, &id, q, userID, resourceID, string(perm)); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "selecting grant")
+	}
+
+	return true, nil
+}
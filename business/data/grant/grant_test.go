@@ -0,0 +1,96 @@
+package grant_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/dbschema"
+	"github.com/egorovdmi/financify/business/data/grant"
+	"github.com/egorovdmi/financify/business/tests"
+)
+
+func TestGrant(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	ctx := tests.Context()
+	if err := dbschema.Seed(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	gr := grant.NewGrantRepository(log, db)
+
+	t.Log("Given the need to work with Grant records.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a single Grant.", testID)
+		{
+			now := time.Date(2022, time.October, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+			const scopeID = "79ee821f-0a5b-4416-a77c-176cbfa14e4d"
+
+			exists, err := gr.Exists(ctx, traceID, tests.AdminID, scopeID, auth.PermScopeRead)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to check a grant: %s.", tests.Failed, testID, err)
+			}
+			if exists {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT find a grant that was never given.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT find a grant that was never given.", tests.Success, testID)
+
+			ng := grant.NewGrant{
+				UserID:     tests.AdminID,
+				ResourceID: scopeID,
+				Permission: string(auth.PermScopeRead),
+			}
+
+			g, err := gr.Create(ctx, traceID, ng, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a grant: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create a grant.", tests.Success, testID)
+
+			again, err := gr.Create(ctx, traceID, ng, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to grant the same permission twice: %s.", tests.Failed, testID, err)
+			}
+			if again.ID != g.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the existing grant : got %q want %q.", tests.Failed, testID, again.ID, g.ID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the existing grant.", tests.Success, testID)
+
+			exists, err = gr.Exists(ctx, traceID, tests.AdminID, scopeID, auth.PermScopeRead)
+			if err != nil || !exists {
+				t.Fatalf("\t%s\tTest %d:\tShould find the created grant: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould find the created grant.", tests.Success, testID)
+
+			exists, err = gr.Exists(ctx, traceID, tests.AdminID, scopeID, auth.PermScopeWrite)
+			if err != nil || exists {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT find a grant for another permission: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT find a grant for another permission.", tests.Success, testID)
+
+			grants, err := gr.QueryByResource(ctx, traceID, scopeID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query grants by resource: %s.", tests.Failed, testID, err)
+			}
+			if len(grants) != 5 {
+				t.Fatalf("\t%s\tTest %d:\tShould get the seeded and the created grants : got %d want %d.", tests.Failed, testID, len(grants), 5)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the seeded and the created grants.", tests.Success, testID)
+
+			if err := gr.Delete(ctx, traceID, g.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to delete a grant: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to delete a grant.", tests.Success, testID)
+
+			exists, err = gr.Exists(ctx, traceID, tests.AdminID, scopeID, auth.PermScopeRead)
+			if err != nil || exists {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT find the deleted grant: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT find the deleted grant.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package grant
+
+import "time"
+
+// Grant represents a permission given to a user on a single resource.
+type Grant struct {
+	ID          string    `db:"grant_id" json:"id"`
+	UserID      string    `db:"user_id" json:"user_id"`
+	ResourceID  string    `db:"resource_id" json:"resource_id"`
+	Permission  string    `db:"permission" json:"permission"`
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+}
+
+// NewGrant contains information needed to grant a permission.
+type NewGrant struct {
+	UserID     string `json:"user_id" validate:"required,uuid"`
+	ResourceID string `json:"resource_id" validate:"required,uuid"`
+	Permission string `json:"permission" validate:"required"`
+}
@@ -0,0 +1,159 @@
+// Package idempotency contains the storage of idempotency keys which let
+// clients safely retry requests.
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/egorovdmi/financify/foundation/database"
+	"github.com/egorovdmi/financify/foundation/logger"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Set of error variables for idempotency keys.
+var (
+	ErrInvalidKey = errors.New("idempotency key must be between 1 and 255 characters")
+)
+
+// TTL is how long a key is remembered. A key older than that can be reused
+// for a new request.
+const TTL = 24 * time.Hour
+
+// maxKeyLen is the longest key accepted from a client.
+const maxKeyLen = 255
+
+type IdempotencyRepository struct {
+	log *logger.Logger
+	db  *sqlx.DB
+}
+
+func NewIdempotencyRepository(log *logger.Logger, db *sqlx.DB) IdempotencyRepository {
+	return IdempotencyRepository{
+		log: log,
+		db:  db,
+	}
+}
+
+// Reserve claims the key of the user for the request with the given hash. It
+// returns true when the key was claimed and the request should be processed.
+// Otherwise the key is in use and the existing key is returned so its
+// response can be replayed. Keys older than the TTL are claimed again.
+func (r IdempotencyRepository) Reserve(ctx context.Context, traceID string, userID string, key string, requestHash string, now time.Time) (Key, bool, error) {
+	if key == "" || len(key) > maxKeyLen {
+		return Key{}, false, ErrInvalidKey
+	}
+
+	k := Key{
+		Key:         key,
+		UserID:      userID,
+		RequestHash: requestHash,
+		Header:      json.RawMessage("{}"),
+		Body:        []byte{},
+		DateCreated: now.UTC(),
+	}
+	expired := k.DateCreated.Add(-TTL)
+
+	const qi = `INSERT INTO idempotency_keys
+		(idempotency_key, user_id, request_hash, date_created)
+		VALUES($1, $2, $3, $4)
+		ON CONFLICT (user_id, idempotency_key) DO UPDATE SET
+			request_hash=EXCLUDED.request_hash, status_code=0, header='{}', body='', date_created=EXCLUDED.date_created
+		WHERE idempotency_keys.date_created < $5`
+
+	const qs = `SELECT * FROM idempotency_keys WHERE user_id=$1 AND idempotency_key=$2`
+
+	// The existing key can be released between the insert and the select,
+	// in which case the key is claimed again.
+	for attempt := 0; attempt < 2; attempt++ {
+		r.log.Debug("query", "trace_id", traceID, "op", "IdempotencyRepository.Reserve",
+			"query", database.Log(qi, k.Key, k.UserID, k.RequestHash, k.DateCreated, expired))
+
+		res, err := r.db.ExecContext(ctx, qi, k.Key, k.UserID, k.RequestHash, k.DateCreated, expired)
+		if err != nil {
+			return Key{}, false, errors.Wrap(err, "reserving idempotency key")
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return Key{}, false, errors.Wrap(err, "reserving idempotency key")
+		}
+		if n == 1 {
+			return k, true, nil
+		}
+
+		r.log.Debug("query", "trace_id", traceID, "op", "IdempotencyRepository.Reserve",
+			"query", database.Log(qs, userID, key))
+
+		var existing Key
+		if err := r.db.GetContext(ctx, &existing, qs, userID, key); err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			return Key{}, false, errors.Wrapf(err, "selecting idempotency key %q", key)
+		}
+
+		return existing, false, nil
+	}
+
+	return Key{}, false, errors.Errorf("reserving idempotency key %q: key keeps being released", key)
+}
+
+// Complete records the response of the request made with the key so retries
+// can be answered with it.
+func (r IdempotencyRepository) Complete(ctx context.Context, traceID string, userID string, key string, statusCode int, header http.Header, body []byte) error {
+	data, err := json.Marshal(header)
+	if err != nil {
+		return errors.Wrap(err, "marshaling response header")
+	}
+
+	const q = `UPDATE idempotency_keys SET status_code=$3, header=$4, body=$5
+		WHERE user_id=$1 AND idempotency_key=$2`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "IdempotencyRepository.Complete",
+		"query", database.Log(q, userID, key, statusCode, string(data), body))
+
+	if _, err := r.db.ExecContext(ctx, q, userID, key, statusCode, data, body); err != nil {
+		return errors.Wrapf(err, "completing idempotency key %q", key)
+	}
+
+	return nil
+}
+
+// Release forgets a key whose request wasn't completed so the request can be
+// retried.
+func (r IdempotencyRepository) Release(ctx context.Context, traceID string, userID string, key string) error {
+	const q = `DELETE FROM idempotency_keys WHERE user_id=$1 AND idempotency_key=$2 AND status_code=0`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "IdempotencyRepository.Release",
+		"query", database.Log(q, userID, key))
+
+	if _, err := r.db.ExecContext(ctx, q, userID, key); err != nil {
+		return errors.Wrapf(err, "releasing idempotency key %q", key)
+	}
+
+	return nil
+}
+
+// Purge removes keys created before the cutoff and returns how many were
+// removed.
+func (r IdempotencyRepository) Purge(ctx context.Context, traceID string, before time.Time) (int, error) {
+	const q = `DELETE FROM idempotency_keys WHERE date_created < $1`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "IdempotencyRepository.Purge",
+		"query", database.Log(q, before))
+
+	res, err := r.db.ExecContext(ctx, q, before.UTC())
+	if err != nil {
+		return 0, errors.Wrap(err, "purging idempotency keys")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "purging idempotency keys")
+	}
+
+	return int(n), nil
+}
@@ -0,0 +1,83 @@
+package idempotency_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/egorovdmi/financify/business/data/dbschema"
+	"github.com/egorovdmi/financify/business/data/idempotency"
+	"github.com/egorovdmi/financify/business/tests"
+)
+
+func TestIdempotency(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	ctx := tests.Context()
+	if err := dbschema.Seed(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	ir := idempotency.NewIdempotencyRepository(log, db)
+
+	t.Log("Given the need to remember the responses of retried requests.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a request is made twice with the same key.", testID)
+		{
+			now := time.Date(2022, time.October, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			_, reserved, err := ir.Reserve(ctx, traceID, tests.UserID, "key-1", "hash", now)
+			if err != nil || !reserved {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reserve a new key : got %v, %v.", tests.Failed, testID, reserved, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to reserve a new key.", tests.Success, testID)
+
+			k, reserved, err := ir.Reserve(ctx, traceID, tests.UserID, "key-1", "hash", now)
+			if err != nil || reserved || k.Completed() {
+				t.Fatalf("\t%s\tTest %d:\tShould get the key in progress : got %v, %+v, %v.", tests.Failed, testID, reserved, k, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the key in progress.", tests.Success, testID)
+
+			header := http.Header{"Content-Type": {"application/json"}}
+			if err := ir.Complete(ctx, traceID, tests.UserID, "key-1", http.StatusCreated, header, []byte(`{"id":1}`)); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to complete the key: %s.", tests.Failed, testID, err)
+			}
+
+			k, reserved, err = ir.Reserve(ctx, traceID, tests.UserID, "key-1", "hash", now.Add(time.Minute))
+			if err != nil || reserved || k.StatusCode != http.StatusCreated || string(k.Body) != `{"id":1}` {
+				t.Fatalf("\t%s\tTest %d:\tShould get the recorded response : got %v, %+v, %v.", tests.Failed, testID, reserved, k, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the recorded response.", tests.Success, testID)
+
+			_, reserved, err = ir.Reserve(ctx, traceID, tests.AdminID, "key-1", "hash", now)
+			if err != nil || !reserved {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reserve the key of another user : got %v, %v.", tests.Failed, testID, reserved, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to reserve the key of another user.", tests.Success, testID)
+
+			if err := ir.Release(ctx, traceID, tests.AdminID, "key-1"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to release the key: %s.", tests.Failed, testID, err)
+			}
+			_, reserved, err = ir.Reserve(ctx, traceID, tests.AdminID, "key-1", "other", now)
+			if err != nil || !reserved {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reserve a released key : got %v, %v.", tests.Failed, testID, reserved, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to reserve a released key.", tests.Success, testID)
+
+			_, reserved, err = ir.Reserve(ctx, traceID, tests.UserID, "key-1", "other", now.Add(idempotency.TTL+time.Second))
+			if err != nil || !reserved {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reserve an expired key : got %v, %v.", tests.Failed, testID, reserved, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to reserve an expired key.", tests.Success, testID)
+
+			n, err := ir.Purge(ctx, traceID, now.Add(time.Second))
+			if err != nil || n != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould purge keys created before the cutoff : got %d, %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould purge keys created before the cutoff.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package idempotency
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Key represents a request made with an Idempotency-Key header together with
+// the response it produced. A StatusCode of zero means the request is still
+// being processed.
+type Key struct {
+	Key         string          `db:"idempotency_key" json:"key"`
+	UserID      string          `db:"user_id" json:"user_id"`
+	RequestHash string          `db:"request_hash" json:"request_hash"`
+	StatusCode  int             `db:"status_code" json:"status_code"`
+	Header      json.RawMessage `db:"header" json:"header"`
+	Body        []byte          `db:"body" json:"body"`
+	DateCreated time.Time       `db:"date_created" json:"date_created"`
+}
+
+// Completed reports whether the response of the request was recorded.
+func (k Key) Completed() bool {
+	return k.StatusCode != 0
+}
@@ -0,0 +1,154 @@
+// Package identity contains the storage of external identities and the state
+// of logins in progress at external providers.
+package identity
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/egorovdmi/financify/business/data/audit"
+	"github.com/egorovdmi/financify/business/sys/secret"
+	"github.com/egorovdmi/financify/foundation/database"
+	"github.com/egorovdmi/financify/foundation/logger"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Set of error variables for CRUD operations.
+var (
+	ErrNotFound      = errors.New("identity not found")
+	ErrInvalidID     = errors.New("ID is not in its proper form")
+	ErrStateNotFound = errors.New("login state not found")
+	ErrStateExpired  = errors.New("login state expired")
+)
+
+// Entity names external identities in the audit log.
+const Entity = "identity"
+
+// StateTTL is how long a user has to log in at the provider.
+const StateTTL = 10 * time.Minute
+
+type IdentityRepository struct {
+	log *logger.Logger
+	db  *sqlx.DB
+}
+
+func NewIdentityRepository(log *logger.Logger, db *sqlx.DB) IdentityRepository {
+	return IdentityRepository{
+		log: log,
+		db:  db,
+	}
+}
+
+// Create links the external identity to the user.
+func (r IdentityRepository) Create(ctx context.Context, traceID string, issuer string, subject string, userID string, email string, now time.Time) (Identity, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return Identity{}, ErrInvalidID
+	}
+
+	id := Identity{
+		Issuer:      issuer,
+		Subject:     subject,
+		UserID:      userID,
+		Email:       email,
+		DateCreated: now.UTC(),
+	}
+
+	const q = `INSERT INTO user_identities
+		(issuer, subject, user_id, email, date_created)
+		VALUES($1, $2, $3, $4, $5)`
+
+	err := database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "IdentityRepository.Create",
+			"query", database.Log(q, id.Issuer, id.Subject, id.UserID, id.Email, id.DateCreated))
+
+		if _, err := tx.ExecContext(ctx, q, id.Issuer, id.Subject, id.UserID, id.Email, id.DateCreated); err != nil {
+			return errors.Wrap(err, "inserting identity")
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionCreate,
+			Entity:   Entity,
+			EntityID: id.Issuer + "|" + id.Subject,
+			After:    id,
+		}, now)
+	})
+	if err != nil {
+		return Identity{}, err
+	}
+
+	return id, nil
+}
+
+// QueryByExternal finds the identity the provider knows by the subject.
+func (r IdentityRepository) QueryByExternal(ctx context.Context, traceID string, issuer string, subject string) (Identity, error) {
+	const q = `SELECT * FROM user_identities WHERE issuer=$1 AND subject=$2`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "IdentityRepository.QueryByExternal",
+		"query", database.Log(q, issuer, subject))
+
+	var id Identity
+	if err := r.db.GetContext(ctx, &id, q, issuer, subject); err != nil {
+		if err == sql.ErrNoRows {
+			return Identity{}, ErrNotFound
+		}
+		return Identity{}, errors.Wrapf(err, "selecting identity %q at %q", subject, issuer)
+	}
+
+	return id, nil
+}
+
+// CreateState stores the PKCE verifier and nonce of a new login and returns
+// the random state identifying it. Only the hash of the state is stored.
+func (r IdentityRepository) CreateState(ctx context.Context, traceID string, verifier string, nonce string, now time.Time) (string, error) {
+	state, hash, err := secret.New()
+	if err != nil {
+		return "", errors.Wrap(err, "generating state")
+	}
+
+	s := State{
+		StateHash:    hash,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    now.Add(StateTTL).UTC(),
+		DateCreated:  now.UTC(),
+	}
+
+	const q = `INSERT INTO oidc_states
+		(state_hash, code_verifier, nonce, expires_at, date_created)
+		VALUES($1, $2, $3, $4, $5)`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "IdentityRepository.CreateState",
+		"query", database.Log(q, s.StateHash, s.CodeVerifier, s.Nonce, s.ExpiresAt, s.DateCreated))
+
+	if _, err := r.db.ExecContext(ctx, q, s.StateHash, s.CodeVerifier, s.Nonce, s.ExpiresAt, s.DateCreated); err != nil {
+		return "", errors.Wrap(err, "inserting state")
+	}
+
+	return state, nil
+}
+
+// ConsumeState removes the login identified by the state and returns it, so
+// every state can be used only once.
+func (r IdentityRepository) ConsumeState(ctx context.Context, traceID string, state string, now time.Time) (State, error) {
+	const q = `DELETE FROM oidc_states WHERE state_hash=$1 RETURNING *`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "IdentityRepository.ConsumeState",
+		"query", database.Log(q, database.Redact(state)))
+
+	var s State
+	if err := r.db.GetContext(ctx, &s, q, secret.Hash(state)); err != nil {
+		if err == sql.ErrNoRows {
+			return State{}, ErrStateNotFound
+		}
+		return State{}, errors.Wrap(err, "deleting state")
+	}
+
+	if now.After(s.ExpiresAt) {
+		return State{}, ErrStateExpired
+	}
+
+	return s, nil
+}
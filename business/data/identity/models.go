@@ -0,0 +1,22 @@
+package identity
+
+import "time"
+
+// Identity links a user at an external provider to a local user.
+type Identity struct {
+	Issuer      string    `db:"issuer" json:"issuer"`
+	Subject     string    `db:"subject" json:"subject"`
+	UserID      string    `db:"user_id" json:"user_id"`
+	Email       string    `db:"email" json:"email"`
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+}
+
+// State is what must be remembered between sending a user to the provider
+// and receiving them back.
+type State struct {
+	StateHash    string    `db:"state_hash" json:"-"`
+	CodeVerifier string    `db:"code_verifier" json:"-"`
+	Nonce        string    `db:"nonce" json:"-"`
+	ExpiresAt    time.Time `db:"expires_at" json:"expires_at"`
+	DateCreated  time.Time `db:"date_created" json:"date_created"`
+}
@@ -0,0 +1,250 @@
+// Package mfa contains the storage of second authentication factors.
+package mfa
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/egorovdmi/financify/business/data/audit"
+	"github.com/egorovdmi/financify/business/sys/secret"
+	"github.com/egorovdmi/financify/foundation/database"
+	"github.com/egorovdmi/financify/foundation/logger"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Set of error variables for CRUD operations.
+var (
+	ErrNotFound             = errors.New("second factor not found")
+	ErrInvalidID            = errors.New("ID is not in its proper form")
+	ErrStepUsed             = errors.New("one-time password already used")
+	ErrRecoveryCodeNotFound = errors.New("recovery code not found")
+)
+
+// Entity names second factors in the audit log.
+const Entity = "totp"
+
+type MFARepository struct {
+	log *logger.Logger
+	db  *sqlx.DB
+}
+
+func NewMFARepository(log *logger.Logger, db *sqlx.DB) MFARepository {
+	return MFARepository{
+		log: log,
+		db:  db,
+	}
+}
+
+// SaveTOTP stores a new unconfirmed secret for the user replacing any
+// previous one.
+func (r MFARepository) SaveTOTP(ctx context.Context, traceID string, userID string, totpSecret string, now time.Time) (TOTP, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return TOTP{}, ErrInvalidID
+	}
+
+	t := TOTP{
+		UserID:      userID,
+		Secret:      totpSecret,
+		DateCreated: now.UTC(),
+		DateUpdated: now.UTC(),
+	}
+
+	const q = `INSERT INTO user_totp
+		(user_id, secret, confirmed, last_step, date_created, date_updated)
+		VALUES($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE SET
+			secret=EXCLUDED.secret,
+			confirmed=EXCLUDED.confirmed,
+			last_step=EXCLUDED.last_step,
+			date_updated=EXCLUDED.date_updated`
+
+	err := database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "MFARepository.SaveTOTP",
+			"query", database.Log(q, t.UserID, t.Secret, t.Confirmed, t.LastStep, t.DateCreated, t.DateUpdated))
+
+		if _, err := tx.ExecContext(ctx, q, t.UserID, t.Secret, t.Confirmed, t.LastStep, t.DateCreated, t.DateUpdated); err != nil {
+			return errors.Wrap(err, "inserting totp")
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionCreate,
+			Entity:   Entity,
+			EntityID: t.UserID,
+			After:    t,
+		}, now)
+	})
+	if err != nil {
+		return TOTP{}, err
+	}
+
+	return t, nil
+}
+
+// QueryTOTP gets the secret of the user.
+func (r MFARepository) QueryTOTP(ctx context.Context, traceID string, userID string) (TOTP, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return TOTP{}, ErrInvalidID
+	}
+
+	const q = `SELECT * FROM user_totp WHERE user_id=$1`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "MFARepository.QueryTOTP",
+		"query", database.Log(q, userID))
+
+	var t TOTP
+	if err := r.db.GetContext(ctx, &t, q, userID); err != nil {
+		if err == sql.ErrNoRows {
+			return TOTP{}, ErrNotFound
+		}
+		return TOTP{}, errors.Wrapf(err, "selecting totp of user %q", userID)
+	}
+
+	return t, nil
+}
+
+// ConfirmTOTP enables the second factor for the user and replaces their
+// recovery codes with the provided ones.
+func (r MFARepository) ConfirmTOTP(ctx context.Context, traceID string, userID string, step int64, recoveryCodes []string, now time.Time) error {
+	if _, err := uuid.Parse(userID); err != nil {
+		return ErrInvalidID
+	}
+
+	const qu = `UPDATE user_totp SET
+		"confirmed"=true,
+		"last_step"=$2,
+		"date_updated"=$3
+		WHERE user_id=$1`
+	const qd = `DELETE FROM user_recovery_codes WHERE user_id=$1`
+	const qi = `INSERT INTO user_recovery_codes
+		(code_hash, user_id, date_created)
+		VALUES($1, $2, $3)`
+
+	return database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "MFARepository.ConfirmTOTP",
+			"query", database.Log(qu, userID, step, now.UTC()))
+
+		res, err := tx.ExecContext(ctx, qu, userID, step, now.UTC())
+		if err != nil {
+			return errors.Wrap(err, "confirming totp")
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrNotFound
+		}
+
+		r.log.Debug("query", "trace_id", traceID, "op", "MFARepository.ConfirmTOTP",
+			"query", database.Log(qd, userID))
+
+		if _, err := tx.ExecContext(ctx, qd, userID); err != nil {
+			return errors.Wrap(err, "deleting recovery codes")
+		}
+
+		for _, code := range recoveryCodes {
+			r.log.Debug("query", "trace_id", traceID, "op", "MFARepository.ConfirmTOTP",
+				"query", database.Log(qi, database.Redact(code), userID, now.UTC()))
+
+			if _, err := tx.ExecContext(ctx, qi, secret.Hash(code), userID, now.UTC()); err != nil {
+				return errors.Wrap(err, "inserting recovery code")
+			}
+		}
+
+		type confirmation struct {
+			Confirmed bool `json:"confirmed"`
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionUpdate,
+			Entity:   Entity,
+			EntityID: userID,
+			Before:   confirmation{Confirmed: false},
+			After:    confirmation{Confirmed: true},
+		}, now)
+	})
+}
+
+// UseStep records the time step of a successfully validated one-time password
+// so the same password can't be used again.
+func (r MFARepository) UseStep(ctx context.Context, traceID string, userID string, step int64, now time.Time) error {
+	if _, err := uuid.Parse(userID); err != nil {
+		return ErrInvalidID
+	}
+
+	const q = `UPDATE user_totp SET
+		"last_step"=$2,
+		"date_updated"=$3
+		WHERE user_id=$1 AND last_step < $2`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "MFARepository.UseStep",
+		"query", database.Log(q, userID, step, now.UTC()))
+
+	res, err := r.db.ExecContext(ctx, q, userID, step, now.UTC())
+	if err != nil {
+		return errors.Wrap(err, "updating totp step")
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrStepUsed
+	}
+
+	return nil
+}
+
+// UseRecoveryCode consumes one of the recovery codes of the user.
+func (r MFARepository) UseRecoveryCode(ctx context.Context, traceID string, userID string, code string) error {
+	if _, err := uuid.Parse(userID); err != nil {
+		return ErrInvalidID
+	}
+
+	const q = `DELETE FROM user_recovery_codes WHERE code_hash=$1 AND user_id=$2`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "MFARepository.UseRecoveryCode",
+		"query", database.Log(q, database.Redact(code), userID))
+
+	res, err := r.db.ExecContext(ctx, q, secret.Hash(code), userID)
+	if err != nil {
+		return errors.Wrap(err, "deleting recovery code")
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrRecoveryCodeNotFound
+	}
+
+	return nil
+}
+
+// DeleteTOTP removes the second factor of the user with all recovery codes.
+func (r MFARepository) DeleteTOTP(ctx context.Context, traceID string, userID string, now time.Time) error {
+	if _, err := uuid.Parse(userID); err != nil {
+		return ErrInvalidID
+	}
+
+	const qt = `DELETE FROM user_totp WHERE user_id=$1 RETURNING *`
+	const qc = `DELETE FROM user_recovery_codes WHERE user_id=$1`
+
+	return database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "MFARepository.DeleteTOTP",
+			"query", database.Log(qt, userID))
+
+		var t TOTP
+		if err := tx.GetContext(ctx, &t, qt, userID); err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return errors.Wrap(err, "deleting totp")
+		}
+
+		r.log.Debug("query", "trace_id", traceID, "op", "MFARepository.DeleteTOTP",
+			"query", database.Log(qc, userID))
+
+		if _, err := tx.ExecContext(ctx, qc, userID); err != nil {
+			return errors.Wrap(err, "deleting recovery codes")
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionDelete,
+			Entity:   Entity,
+			EntityID: t.UserID,
+			Before:   t,
+		}, now)
+	})
+}
@@ -0,0 +1,79 @@
+package mfa_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/egorovdmi/financify/business/data/dbschema"
+	"github.com/egorovdmi/financify/business/data/mfa"
+	"github.com/egorovdmi/financify/business/tests"
+)
+
+func TestMFA(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	ctx := tests.Context()
+	if err := dbschema.Seed(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	mr := mfa.NewMFARepository(log, db)
+
+	t.Log("Given the need to work with second factor records.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a single TOTP secret.", testID)
+		{
+			now := time.Date(2022, time.October, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			if _, err := mr.QueryTOTP(ctx, traceID, tests.UserID); err != mfa.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT find a secret before enrollment: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT find a secret before enrollment.", tests.Success, testID)
+
+			if _, err := mr.SaveTOTP(ctx, traceID, tests.UserID, "JBSWY3DPEHPK3PXP", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to save a secret: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to save a secret.", tests.Success, testID)
+
+			if err := mr.ConfirmTOTP(ctx, traceID, tests.UserID, 100, []string{"one", "two"}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to confirm the secret: %s.", tests.Failed, testID, err)
+			}
+
+			saved, err := mr.QueryTOTP(ctx, traceID, tests.UserID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the secret: %s.", tests.Failed, testID, err)
+			}
+			if !saved.Confirmed || saved.LastStep != 100 {
+				t.Fatalf("\t%s\tTest %d:\tShould see the secret confirmed : %+v.", tests.Failed, testID, saved)
+			}
+			t.Logf("\t%s\tTest %d:\tShould see the secret confirmed.", tests.Success, testID)
+
+			if err := mr.UseStep(ctx, traceID, tests.UserID, 100, now); err != mfa.ErrStepUsed {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT reuse a time step: %v.", tests.Failed, testID, err)
+			}
+			if err := mr.UseStep(ctx, traceID, tests.UserID, 101, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould use a later time step: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould use every time step only once.", tests.Success, testID)
+
+			if err := mr.UseRecoveryCode(ctx, traceID, tests.UserID, "one"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to use a recovery code: %s.", tests.Failed, testID, err)
+			}
+			if err := mr.UseRecoveryCode(ctx, traceID, tests.UserID, "one"); err != mfa.ErrRecoveryCodeNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT use a recovery code twice: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould use every recovery code only once.", tests.Success, testID)
+
+			if err := mr.DeleteTOTP(ctx, traceID, tests.UserID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to delete the secret: %s.", tests.Failed, testID, err)
+			}
+			if err := mr.UseRecoveryCode(ctx, traceID, tests.UserID, "two"); err != mfa.ErrRecoveryCodeNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould remove the recovery codes with the secret: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to delete the secret.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package mfa
+
+import "time"
+
+// TOTP represents the time-based one-time password secret of a user. The
+// second factor is only enforced once the user confirmed the enrollment.
+type TOTP struct {
+	UserID      string    `db:"user_id" json:"user_id"`
+	Secret      string    `db:"secret" json:"-"`
+	Confirmed   bool      `db:"confirmed" json:"confirmed"`
+	LastStep    int64     `db:"last_step" json:"-"`
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+	DateUpdated time.Time `db:"date_updated" json:"date_updated"`
+}
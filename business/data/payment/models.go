@@ -0,0 +1,63 @@
+package payment
+
+import (
+	"time"
+
+	"github.com/egorovdmi/financify/business/sys/money"
+	"github.com/egorovdmi/financify/business/sys/validate"
+)
+
+// Payment represents money spent or received through a Wallet. Spending has a
+// negative amount.
+type Payment struct {
+	ID              string       `db:"payment_id" json:"id"`
+	TransactionID   *string      `db:"transaction_id" json:"transaction_id,omitempty"`
+	UserID          string       `db:"user_id" json:"user_id"`
+	ScopeID         string       `db:"scope_id" json:"scope_id"`
+	WalletID        string       `db:"wallet_id" json:"wallet_id"`
+	ProductName     string       `db:"product_name" json:"product_name"`
+	ProductQuantity int          `db:"product_quantity" json:"product_quantity"`
+	ProductType     string       `db:"product_type" json:"product_type"`
+	Amount          money.Amount `db:"amount" json:"amount"`
+	DateCreated     time.Time    `db:"date_created" json:"date_created"`
+	DateUpdated     time.Time    `db:"date_updated" json:"date_updated"`
+}
+
+// BatchItem contains information needed to create a Payment or, when it
+// carries an ID, to update an existing one.
+type BatchItem struct {
+	ID              string       `json:"id" validate:"omitempty,uuid"`
+	TransactionID   *string      `json:"transaction_id" validate:"omitempty,uuid"`
+	ProductName     string       `json:"product_name" validate:"required"`
+	ProductQuantity int          `json:"product_quantity" validate:"min=1"`
+	ProductType     string       `json:"product_type"`
+	Amount          money.Amount `json:"amount" validate:"required"`
+}
+
+// NewBatch contains the payments to apply to a Wallet at once. The items are
+// validated one by one when the batch is applied, which also rejects batches
+// of more than MaxBatch items.
+type NewBatch struct {
+	Mode  string      `json:"mode" validate:"omitempty,oneof=atomic best_effort"`
+	Items []BatchItem `json:"items" validate:"required,min=1"`
+}
+
+// Result describes what happened to a single item of a batch.
+type Result struct {
+	Index   int                  `json:"index"`
+	Status  string               `json:"status"`
+	Payment *Payment             `json:"payment,omitempty"`
+	Error   string               `json:"error,omitempty"`
+	Fields  validate.FieldErrors `json:"fields,omitempty"`
+}
+
+// Batch is the outcome of applying a NewBatch. Balance is the amount of the
+// wallet once the batch was applied.
+type Batch struct {
+	WalletID string       `json:"wallet_id"`
+	Mode     string       `json:"mode"`
+	Applied  int          `json:"applied"`
+	Failed   int          `json:"failed"`
+	Balance  money.Amount `json:"balance"`
+	Results  []Result     `json:"results"`
+}
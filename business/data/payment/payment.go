@@ -0,0 +1,314 @@
+// Package payment contains payment related CRUD functionality.
+package payment
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/audit"
+	"github.com/egorovdmi/financify/business/sys/money"
+	"github.com/egorovdmi/financify/business/sys/validate"
+	"github.com/egorovdmi/financify/foundation/database"
+	"github.com/egorovdmi/financify/foundation/logger"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Set of error variables for CRUD operations.
+var (
+	ErrNotFound       = errors.New("payment not found")
+	ErrWalletNotFound = errors.New("wallet not found")
+	ErrInvalidID      = errors.New("ID is not in its proper form")
+)
+
+// Set of modes a batch can be applied in. An atomic batch is applied only if
+// every item is valid, a best effort batch applies the valid items.
+const (
+	ModeAtomic     = "atomic"
+	ModeBestEffort = "best_effort"
+)
+
+// Set of statuses of the items of a batch.
+const (
+	StatusCreated    = "created"
+	StatusUpdated    = "updated"
+	StatusFailed     = "failed"
+	StatusRolledBack = "rolled_back"
+)
+
+// MaxBatch is the most items a batch can contain.
+const MaxBatch = 100
+
+// Entity names payments in the audit log.
+const Entity = "payment"
+
+// errRollback undoes an atomic batch with failed items.
+var errRollback = errors.New("rolling back batch")
+
+type PaymentRepository struct {
+	log *logger.Logger
+	db  *sqlx.DB
+}
+
+func NewPaymentRepository(log *logger.Logger, db *sqlx.DB) PaymentRepository {
+	return PaymentRepository{
+		log: log,
+		db:  db,
+	}
+}
+
+// Batch creates and updates the payments of the wallet in one transaction and
+// recomputes the balances of the wallet and its scope once at the end. Every
+// item gets a result. Items failing validation or referring to payments of
+// other wallets fail on their own, any other error fails the whole batch.
+// Access to the scope of the wallet must be checked by the caller.
+func (r PaymentRepository) Batch(ctx context.Context, traceID string, claims auth.Claims, walletID string, nb NewBatch, now time.Time) (Batch, error) {
+	if _, err := uuid.Parse(walletID); err != nil {
+		return Batch{}, ErrInvalidID
+	}
+	if len(nb.Items) > MaxBatch {
+		return Batch{}, validate.FieldErrors{{
+			Field: "items",
+			Error: fmt.Sprintf("items must contain at most %d items", MaxBatch),
+		}}
+	}
+
+	b := Batch{
+		WalletID: walletID,
+		Mode:     nb.Mode,
+		Results:  make([]Result, len(nb.Items)),
+	}
+	if b.Mode == "" {
+		b.Mode = ModeAtomic
+	}
+
+	// The wallet is locked so concurrent batches recompute its balance in turn.
+	const q = `SELECT w.scope_id, w.amount FROM wallets w
+		JOIN scopes s ON s.scope_id=w.scope_id
+		WHERE w.wallet_id=$1 AND w.date_deleted IS NULL AND s.date_deleted IS NULL
+		FOR UPDATE OF w`
+
+	err := database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "PaymentRepository.Batch",
+			"query", database.Log(q, walletID))
+
+		var w struct {
+			ScopeID string       `db:"scope_id"`
+			Amount  money.Amount `db:"amount"`
+		}
+		if err := tx.GetContext(ctx, &w, q, walletID); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrWalletNotFound
+			}
+			return errors.Wrapf(err, "selecting wallet %q", walletID)
+		}
+		b.Balance = w.Amount
+
+		for i, item := range nb.Items {
+			res, err := r.apply(ctx, tx, traceID, claims, w.ScopeID, walletID, item, now)
+			if err != nil {
+				return errors.Wrapf(err, "item %d", i)
+			}
+			res.Index = i
+			b.Results[i] = res
+
+			if res.Status == StatusFailed {
+				b.Failed++
+				continue
+			}
+			b.Applied++
+		}
+
+		if b.Mode == ModeAtomic && b.Failed > 0 {
+			for i := range b.Results {
+				if b.Results[i].Status != StatusFailed {
+					b.Results[i].Status = StatusRolledBack
+					b.Results[i].Payment = nil
+				}
+			}
+			b.Applied = 0
+			return errRollback
+		}
+
+		if b.Applied == 0 {
+			return nil
+		}
+
+		balance, err := r.recompute(ctx, tx, traceID, w.ScopeID, walletID, now)
+		if err != nil {
+			return err
+		}
+		b.Balance = balance
+
+		return nil
+	})
+	if err != nil && err != errRollback {
+		return Batch{}, err
+	}
+
+	return b, nil
+}
+
+// apply validates a single item of a batch and creates or updates its
+// payment.
+func (r PaymentRepository) apply(ctx context.Context, tx *sqlx.Tx, traceID string, claims auth.Claims, scopeID string, walletID string, item BatchItem, now time.Time) (Result, error) {
+	if err := validate.Check(item); err != nil {
+		if !validate.IsFieldErrors(err) {
+			return Result{}, err
+		}
+		return Result{
+			Status: StatusFailed,
+			Error:  "data validation error",
+			Fields: validate.GetFieldErrors(err),
+		}, nil
+	}
+
+	if item.ID == "" {
+		p := Payment{
+			ID:              uuid.New().String(),
+			TransactionID:   item.TransactionID,
+			UserID:          claims.Subject,
+			ScopeID:         scopeID,
+			WalletID:        walletID,
+			ProductName:     item.ProductName,
+			ProductQuantity: item.ProductQuantity,
+			ProductType:     item.ProductType,
+			Amount:          item.Amount,
+			DateCreated:     now.UTC(),
+			DateUpdated:     now.UTC(),
+		}
+
+		const q = `INSERT INTO payments
+			(payment_id, transaction_id, user_id, scope_id, wallet_id, product_name, product_quantity, product_type, amount, date_created, date_updated)
+			VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+		r.log.Debug("query", "trace_id", traceID, "op", "PaymentRepository.Batch",
+			"query", database.Log(q, p.ID, p.TransactionID, p.UserID, p.ScopeID, p.WalletID, p.ProductName, p.ProductQuantity, p.ProductType, p.Amount, p.DateCreated, p.DateUpdated))
+
+		if _, err := tx.ExecContext(ctx, q, p.ID, p.TransactionID, p.UserID, p.ScopeID, p.WalletID, p.ProductName, p.ProductQuantity, p.ProductType, p.Amount, p.DateCreated, p.DateUpdated); err != nil {
+			return Result{}, errors.Wrap(err, "inserting payment")
+		}
+
+		err := audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionCreate,
+			Entity:   Entity,
+			EntityID: p.ID,
+			After:    p,
+		}, now)
+		if err != nil {
+			return Result{}, err
+		}
+
+		return Result{Status: StatusCreated, Payment: &p}, nil
+	}
+
+	const qs = `SELECT * FROM payments WHERE payment_id=$1 AND wallet_id=$2 FOR UPDATE`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "PaymentRepository.Batch",
+		"query", database.Log(qs, item.ID, walletID))
+
+	var p Payment
+	if err := tx.GetContext(ctx, &p, qs, item.ID, walletID); err != nil {
+		if err == sql.ErrNoRows {
+			return Result{Status: StatusFailed, Error: ErrNotFound.Error()}, nil
+		}
+		return Result{}, errors.Wrapf(err, "selecting payment %q", item.ID)
+	}
+
+	before := p
+
+	p.TransactionID = item.TransactionID
+	p.ProductName = item.ProductName
+	p.ProductQuantity = item.ProductQuantity
+	p.ProductType = item.ProductType
+	p.Amount = item.Amount
+	p.DateUpdated = now.UTC()
+
+	const qu = `UPDATE payments SET
+		"transaction_id"=$2,
+		"product_name"=$3,
+		"product_quantity"=$4,
+		"product_type"=$5,
+		"amount"=$6,
+		"date_updated"=$7
+		WHERE payment_id=$1`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "PaymentRepository.Batch",
+		"query", database.Log(qu, p.ID, p.TransactionID, p.ProductName, p.ProductQuantity, p.ProductType, p.Amount, p.DateUpdated))
+
+	if _, err := tx.ExecContext(ctx, qu, p.ID, p.TransactionID, p.ProductName, p.ProductQuantity, p.ProductType, p.Amount, p.DateUpdated); err != nil {
+		return Result{}, errors.Wrapf(err, "updating payment %q", p.ID)
+	}
+
+	err := audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+		Action:   audit.ActionUpdate,
+		Entity:   Entity,
+		EntityID: p.ID,
+		Before:   before,
+		After:    p,
+	}, now)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{Status: StatusUpdated, Payment: &p}, nil
+}
+
+// recompute sets the amount of the wallet to the sum of its payments and the
+// amount of the scope to the sum of its wallets. It returns the new amount of
+// the wallet.
+func (r PaymentRepository) recompute(ctx context.Context, tx *sqlx.Tx, traceID string, scopeID string, walletID string, now time.Time) (money.Amount, error) {
+	const qw = `UPDATE wallets SET
+		"amount"=(SELECT COALESCE(SUM(amount), 0) FROM payments WHERE wallet_id=$1),
+		"date_updated"=$2,
+		"version"=version+1
+		WHERE wallet_id=$1
+		RETURNING amount`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "PaymentRepository.recompute",
+		"query", database.Log(qw, walletID, now.UTC()))
+
+	var balance money.Amount
+	if err := tx.GetContext(ctx, &balance, qw, walletID, now.UTC()); err != nil {
+		return 0, errors.Wrapf(err, "recomputing balance of wallet %q", walletID)
+	}
+
+	const qs = `UPDATE scopes SET
+		"amount"=(SELECT COALESCE(SUM(amount), 0) FROM wallets WHERE scope_id=$1 AND date_deleted IS NULL),
+		"date_updated"=$2,
+		"version"=version+1
+		WHERE scope_id=$1`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "PaymentRepository.recompute",
+		"query", database.Log(qs, scopeID, now.UTC()))
+
+	if _, err := tx.ExecContext(ctx, qs, scopeID, now.UTC()); err != nil {
+		return 0, errors.Wrapf(err, "recomputing balance of scope %q", scopeID)
+	}
+
+	return balance, nil
+}
+
+// QueryByWallet retrieves the payments of the wallet, the newest first.
+// Access to the scope of the wallet must be checked by the caller.
+func (r PaymentRepository) QueryByWallet(ctx context.Context, traceID string, walletID string) ([]Payment, error) {
+	if _, err := uuid.Parse(walletID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	const q = `SELECT * FROM payments WHERE wallet_id=$1 ORDER BY date_created DESC, payment_id`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "PaymentRepository.QueryByWallet",
+		"query", database.Log(q, walletID))
+
+	payments := []Payment{}
+	if err := r.db.SelectContext(ctx, &payments, q, walletID); err != nil {
+		return nil, errors.Wrapf(err, "selecting payments of wallet %q", walletID)
+	}
+
+	return payments, nil
+}
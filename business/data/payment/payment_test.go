@@ -0,0 +1,118 @@
+package payment_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/dbschema"
+	"github.com/egorovdmi/financify/business/data/payment"
+	"github.com/egorovdmi/financify/business/data/scope"
+	"github.com/egorovdmi/financify/business/data/wallet"
+	"github.com/egorovdmi/financify/business/sys/validate"
+	"github.com/egorovdmi/financify/business/tests"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestBatch(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	ctx := tests.Context()
+	if err := dbschema.Seed(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	pr := payment.NewPaymentRepository(log, db)
+	wr := wallet.NewWalletRepository(log, db)
+	sr := scope.NewScopeRepository(log, db)
+
+	const scopeID = "79ee821f-0a5b-4416-a77c-176cbfa14e4d"
+	const walletID = "a11af2a9-9b3c-4950-bf8e-bf0d3c6399f2"
+	claims := auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: tests.UserID},
+		Roles:            []string{auth.RoleUser},
+	}
+	ctx = context.WithValue(ctx, auth.Key, claims)
+
+	t.Log("Given the need to enter many payments at once.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen applying batches to a wallet.", testID)
+		{
+			now := time.Date(2022, time.October, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			nb := payment.NewBatch{
+				Items: []payment.BatchItem{
+					{ProductName: "Bread", ProductQuantity: 1, Amount: -250},
+					{ProductName: "", ProductQuantity: 1, Amount: -300},
+					{ProductName: "Salary", ProductQuantity: 1, Amount: 10000},
+				},
+			}
+
+			b, err := pr.Batch(ctx, traceID, claims, walletID, nb, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to apply an atomic batch: %s.", tests.Failed, testID, err)
+			}
+			if b.Applied != 0 || b.Failed != 1 || b.Results[0].Status != payment.StatusRolledBack || b.Results[1].Status != payment.StatusFailed || len(b.Results[1].Fields) == 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould apply nothing of an atomic batch with an invalid item : got %+v.", tests.Failed, testID, b)
+			}
+			if payments, err := pr.QueryByWallet(ctx, traceID, walletID); err != nil || len(payments) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould store no payments : got %d, %v.", tests.Failed, testID, len(payments), err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould apply nothing of an atomic batch with an invalid item.", tests.Success, testID)
+
+			nb.Mode = payment.ModeBestEffort
+			b, err = pr.Batch(ctx, traceID, claims, walletID, nb, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to apply a best effort batch: %s.", tests.Failed, testID, err)
+			}
+			if b.Applied != 2 || b.Failed != 1 || b.Results[0].Status != payment.StatusCreated || b.Balance != 9750 {
+				t.Fatalf("\t%s\tTest %d:\tShould apply the valid items of a best effort batch : got %+v.", tests.Failed, testID, b)
+			}
+			t.Logf("\t%s\tTest %d:\tShould apply the valid items of a best effort batch.", tests.Success, testID)
+
+			w, err := wr.QueryByID(ctx, traceID, claims, walletID)
+			if err != nil || w.Amount != 9750 {
+				t.Fatalf("\t%s\tTest %d:\tShould recompute the balance of the wallet : got %v, %v.", tests.Failed, testID, w.Amount, err)
+			}
+			s, err := sr.QueryByID(ctx, traceID, claims, scopeID)
+			if err != nil || s.Amount != 9750 {
+				t.Fatalf("\t%s\tTest %d:\tShould recompute the balance of the scope : got %v, %v.", tests.Failed, testID, s.Amount, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould recompute the balances.", tests.Success, testID)
+
+			nb = payment.NewBatch{
+				Items: []payment.BatchItem{
+					{ID: b.Results[0].Payment.ID, ProductName: "Bread", ProductQuantity: 2, Amount: -500},
+				},
+			}
+			b, err = pr.Batch(ctx, traceID, claims, walletID, nb, now)
+			if err != nil || b.Results[0].Status != payment.StatusUpdated || b.Balance != 9500 {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to update a payment : got %+v, %v.", tests.Failed, testID, b, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to update a payment.", tests.Success, testID)
+
+			nb.Items[0].ID = "5cf37266-3473-4006-984f-9325122678b7"
+			nb.Mode = payment.ModeBestEffort
+			b, err = pr.Batch(ctx, traceID, claims, walletID, nb, now)
+			if err != nil || b.Results[0].Status != payment.StatusFailed || b.Results[0].Error != payment.ErrNotFound.Error() {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to update an unknown payment : got %+v, %v.", tests.Failed, testID, b, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to update an unknown payment.", tests.Success, testID)
+
+			if _, err := pr.Batch(ctx, traceID, claims, scopeID, nb, now); err != payment.ErrWalletNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to apply a batch to an unknown wallet : got %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to apply a batch to an unknown wallet.", tests.Success, testID)
+
+			nb.Items = make([]payment.BatchItem, payment.MaxBatch+1)
+			if _, err := pr.Batch(ctx, traceID, claims, walletID, nb, now); !validate.IsFieldErrors(err) {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to apply more than %d items : got %v.", tests.Failed, testID, payment.MaxBatch, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to apply more than %d items.", tests.Success, testID, payment.MaxBatch)
+		}
+	}
+}
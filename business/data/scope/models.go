@@ -0,0 +1,65 @@
+package scope
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/egorovdmi/financify/business/sys/money"
+)
+
+// Scope represents a ledger shared by its members.
+type Scope struct {
+	ID          string       `db:"scope_id" json:"id"`
+	UserID      string       `db:"user_id" json:"user_id"`
+	Title       string       `db:"title" json:"title"`
+	Amount      money.Amount `db:"amount" json:"amount"`
+	DateCreated time.Time    `db:"date_created" json:"date_created"`
+	DateUpdated time.Time    `db:"date_updated" json:"date_updated"`
+	DateDeleted *time.Time   `db:"date_deleted" json:"date_deleted,omitempty"`
+	Version     int          `db:"version" json:"-"`
+}
+
+// ETag identifies the version of the scope. It changes with every update.
+func (s Scope) ETag() string {
+	return strconv.Itoa(s.Version)
+}
+
+// NewScope contains information needed to create a new Scope.
+type NewScope struct {
+	Title string `json:"title" validate:"required"`
+}
+
+// UpdateScope defines what information may be provided to modify an existing
+// Scope. All fields are optional so clients can send just the fields they want
+// changed.
+type UpdateScope struct {
+	Title *string `json:"title" validate:"omitempty,min=1"`
+}
+
+// Member represents a user who has access to a Scope.
+type Member struct {
+	ScopeID     string    `db:"scope_id" json:"scope_id"`
+	UserID      string    `db:"user_id" json:"user_id"`
+	Role        string    `db:"role" json:"role"`
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+}
+
+// Invitation represents an offer to join a Scope sent to an email address.
+type Invitation struct {
+	ID          string    `db:"invitation_id" json:"id"`
+	ScopeID     string    `db:"scope_id" json:"scope_id"`
+	Email       string    `db:"email" json:"email"`
+	Role        string    `db:"role" json:"role"`
+	TokenHash   string    `db:"token_hash" json:"-"`
+	InvitedBy   string    `db:"invited_by" json:"invited_by"`
+	Status      string    `db:"status" json:"status"`
+	ExpiresAt   time.Time `db:"expires_at" json:"expires_at"`
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+	DateUpdated time.Time `db:"date_updated" json:"date_updated"`
+}
+
+// NewInvitation contains information needed to invite somebody to a Scope.
+type NewInvitation struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=OWNER EDITOR VIEWER"`
+}
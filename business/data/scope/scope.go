@@ -0,0 +1,721 @@
+// Package scope contains the storage of scopes, the ledgers shared between
+// their members, together with membership and invitations.
+package scope
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/audit"
+	"github.com/egorovdmi/financify/business/data/grant"
+	"github.com/egorovdmi/financify/business/sys/secret"
+	"github.com/egorovdmi/financify/foundation/database"
+	"github.com/egorovdmi/financify/foundation/logger"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Set of error variables for CRUD operations.
+var (
+	ErrNotFound           = errors.New("scope not found")
+	ErrInvalidID          = errors.New("ID is not in its proper form")
+	ErrMemberNotFound     = errors.New("member not found")
+	ErrLastOwner          = errors.New("scope must keep at least one owner")
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvitationExpired  = errors.New("invitation expired")
+	ErrInvitationMismatch = errors.New("invitation was sent to another email")
+	ErrAlreadyMember      = errors.New("user is already a member of the scope")
+	ErrVersionMismatch    = errors.New("scope was modified by another request")
+)
+
+// Set of roles a member can have in a scope.
+const (
+	RoleOwner  = "OWNER"
+	RoleEditor = "EDITOR"
+	RoleViewer = "VIEWER"
+)
+
+// Set of states an invitation goes through.
+const (
+	InvitationPending  = "PENDING"
+	InvitationAccepted = "ACCEPTED"
+	InvitationDeclined = "DECLINED"
+)
+
+// Set of entity names the repository records in the audit log.
+const (
+	Entity           = "scope"
+	EntityMember     = "scope_member"
+	EntityInvitation = "scope_invitation"
+)
+
+// InvitationTTL is how long an invitation can be accepted after it is sent.
+const InvitationTTL = 7 * 24 * time.Hour
+
+// memberPermissions maps member roles to the grants a member gets on the scope.
+var memberPermissions = map[string][]auth.Permission{
+	RoleOwner:  {auth.PermScopeRead, auth.PermScopeWrite, auth.PermScopeManage},
+	RoleEditor: {auth.PermScopeRead, auth.PermScopeWrite},
+	RoleViewer: {auth.PermScopeRead},
+}
+
+type ScopeRepository struct {
+	log *logger.Logger
+	db  *sqlx.DB
+}
+
+func NewScopeRepository(log *logger.Logger, db *sqlx.DB) ScopeRepository {
+	return ScopeRepository{
+		log: log,
+		db:  db,
+	}
+}
+
+// Create adds a new scope and makes the calling user its owner.
+func (r ScopeRepository) Create(ctx context.Context, traceID string, claims auth.Claims, ns NewScope, now time.Time) (Scope, error) {
+	s := Scope{
+		ID:          uuid.New().String(),
+		UserID:      claims.Subject,
+		Title:       ns.Title,
+		DateCreated: now.UTC(),
+		DateUpdated: now.UTC(),
+		Version:     1,
+	}
+
+	const q = `INSERT INTO scopes
+		(scope_id, user_id, title, amount, date_created, date_updated)
+		VALUES($1, $2, $3, $4, $5, $6)`
+
+	err := database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.Create",
+			"query", database.Log(q, s.ID, s.UserID, s.Title, s.Amount, s.DateCreated, s.DateUpdated))
+
+		if _, err := tx.ExecContext(ctx, q, s.ID, s.UserID, s.Title, s.Amount, s.DateCreated, s.DateUpdated); err != nil {
+			return errors.Wrap(err, "inserting scope")
+		}
+
+		ne := audit.NewEvent{
+			Action:   audit.ActionCreate,
+			Entity:   Entity,
+			EntityID: s.ID,
+			After:    s,
+		}
+		if err := audit.Record(ctx, tx, r.log, traceID, ne, now); err != nil {
+			return err
+		}
+
+		return r.addMember(ctx, tx, traceID, s.ID, s.UserID, RoleOwner, now)
+	})
+	if err != nil {
+		return Scope{}, err
+	}
+
+	return s, nil
+}
+
+// Update modifies the title of the scope. A non-empty etag must match the
+// current version of the scope, otherwise ErrVersionMismatch is returned.
+func (r ScopeRepository) Update(ctx context.Context, traceID string, claims auth.Claims, scopeID string, us UpdateScope, etag string, now time.Time) error {
+	s, err := r.QueryByID(ctx, traceID, claims, scopeID)
+	if err != nil {
+		return err
+	}
+
+	if etag != "" && etag != s.ETag() {
+		return ErrVersionMismatch
+	}
+
+	before := s
+
+	if us.Title != nil {
+		s.Title = *us.Title
+	}
+	s.DateUpdated = now.UTC()
+
+	const q = `UPDATE scopes SET
+		"title"=$2,
+		"date_updated"=$3,
+		"version"=version+1
+		WHERE scope_id=$1 AND version=$4 AND date_deleted IS NULL`
+
+	return database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.Update",
+			"query", database.Log(q, s.ID, s.Title, s.DateUpdated, before.Version))
+
+		res, err := tx.ExecContext(ctx, q, s.ID, s.Title, s.DateUpdated, before.Version)
+		if err != nil {
+			return errors.Wrap(err, "updating scope")
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrVersionMismatch
+		}
+		s.Version++
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionUpdate,
+			Entity:   Entity,
+			EntityID: s.ID,
+			Before:   before,
+			After:    s,
+		}, now)
+	})
+}
+
+// Delete hides the scope together with its wallets and payments until it's
+// restored or purged. Members and grants are kept for a restore. A non-empty
+// etag must match the current version of the scope, otherwise
+// ErrVersionMismatch is returned.
+func (r ScopeRepository) Delete(ctx context.Context, traceID string, scopeID string, etag string, now time.Time) error {
+	if _, err := uuid.Parse(scopeID); err != nil {
+		return ErrInvalidID
+	}
+
+	const qs = `SELECT * FROM scopes WHERE scope_id=$1 AND date_deleted IS NULL FOR UPDATE`
+	const q = `UPDATE scopes SET
+		"date_deleted"=$2,
+		"version"=version+1
+		WHERE scope_id=$1`
+
+	return database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.Delete",
+			"query", database.Log(qs, scopeID))
+
+		var s Scope
+		if err := tx.GetContext(ctx, &s, qs, scopeID); err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return errors.Wrapf(err, "selecting scope %q", scopeID)
+		}
+
+		if etag != "" && etag != s.ETag() {
+			return ErrVersionMismatch
+		}
+
+		r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.Delete",
+			"query", database.Log(q, scopeID, now.UTC()))
+
+		if _, err := tx.ExecContext(ctx, q, scopeID, now.UTC()); err != nil {
+			return errors.Wrap(err, "deleting scope")
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionDelete,
+			Entity:   Entity,
+			EntityID: s.ID,
+			Before:   s,
+		}, now)
+	})
+}
+
+// Restore brings back a deleted scope that wasn't purged yet. It's meant for
+// admins and performs no authorization checks.
+func (r ScopeRepository) Restore(ctx context.Context, traceID string, scopeID string, now time.Time) (Scope, error) {
+	if _, err := uuid.Parse(scopeID); err != nil {
+		return Scope{}, ErrInvalidID
+	}
+
+	const q = `UPDATE scopes SET
+		"date_deleted"=NULL,
+		"date_updated"=$2,
+		"version"=version+1
+		WHERE scope_id=$1 AND date_deleted IS NOT NULL
+		RETURNING *`
+
+	var s Scope
+	err := database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.Restore",
+			"query", database.Log(q, scopeID, now.UTC()))
+
+		if err := tx.GetContext(ctx, &s, q, scopeID, now.UTC()); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return errors.Wrapf(err, "restoring scope %q", scopeID)
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionRestore,
+			Entity:   Entity,
+			EntityID: s.ID,
+			After:    s,
+		}, now)
+	})
+	if err != nil {
+		return Scope{}, err
+	}
+
+	return s, nil
+}
+
+// Purge permanently removes the scopes deleted before the specified time
+// together with their wallets, payments, members and grants and returns how
+// many were removed.
+func (r ScopeRepository) Purge(ctx context.Context, traceID string, before time.Time, now time.Time) (int, error) {
+	const q = `DELETE FROM scopes WHERE date_deleted < $1 RETURNING scope_id`
+	const qg = `DELETE FROM grants WHERE resource_id=$1`
+
+	var ids []string
+	err := database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.Purge",
+			"query", database.Log(q, before.UTC()))
+
+		if err := tx.SelectContext(ctx, &ids, q, before.UTC()); err != nil {
+			return errors.Wrap(err, "purging scopes")
+		}
+
+		for _, id := range ids {
+			r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.Purge",
+				"query", database.Log(qg, id))
+
+			if _, err := tx.ExecContext(ctx, qg, id); err != nil {
+				return errors.Wrap(err, "deleting scope grants")
+			}
+
+			ne := audit.NewEvent{
+				Action:   audit.ActionPurge,
+				Entity:   Entity,
+				EntityID: id,
+			}
+			if err := audit.Record(ctx, tx, r.log, traceID, ne, now); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
+}
+
+// Query retrieves the scopes the calling user is a member of. Admins get all
+// scopes.
+func (r ScopeRepository) Query(ctx context.Context, traceID string, claims auth.Claims) ([]Scope, error) {
+	const q = `SELECT s.* FROM scopes s
+		WHERE s.date_deleted IS NULL
+		AND ($1 OR EXISTS (SELECT 1 FROM scope_members m WHERE m.scope_id=s.scope_id AND m.user_id=$2))
+		ORDER BY s.date_created`
+
+	isAdmin := claims.Authorize(auth.RoleAdmin)
+	subject := subjectID(claims)
+
+	r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.Query",
+		"query", database.Log(q, isAdmin, subject))
+
+	scopes := []Scope{}
+	if err := r.db.SelectContext(ctx, &scopes, q, isAdmin, subject); err != nil {
+		return nil, errors.Wrap(err, "selecting scopes")
+	}
+
+	return scopes, nil
+}
+
+// QueryByID gets the specified scope if the calling user is one of its
+// members or an admin.
+func (r ScopeRepository) QueryByID(ctx context.Context, traceID string, claims auth.Claims, scopeID string) (Scope, error) {
+	if _, err := uuid.Parse(scopeID); err != nil {
+		return Scope{}, ErrInvalidID
+	}
+
+	const q = `SELECT s.* FROM scopes s
+		WHERE s.scope_id=$1 AND s.date_deleted IS NULL
+		AND ($2 OR EXISTS (SELECT 1 FROM scope_members m WHERE m.scope_id=s.scope_id AND m.user_id=$3))`
+
+	isAdmin := claims.Authorize(auth.RoleAdmin)
+	subject := subjectID(claims)
+
+	r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.QueryByID",
+		"query", database.Log(q, scopeID, isAdmin, subject))
+
+	var s Scope
+	if err := r.db.GetContext(ctx, &s, q, scopeID, isAdmin, subject); err != nil {
+		if err == sql.ErrNoRows {
+			return Scope{}, ErrNotFound
+		}
+		return Scope{}, errors.Wrapf(err, "selecting scope %q", scopeID)
+	}
+
+	return s, nil
+}
+
+// QueryMembers retrieves the members of the specified scope.
+func (r ScopeRepository) QueryMembers(ctx context.Context, traceID string, scopeID string) ([]Member, error) {
+	if _, err := uuid.Parse(scopeID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	const q = `SELECT m.* FROM scope_members m
+		JOIN scopes s ON s.scope_id=m.scope_id
+		WHERE m.scope_id=$1 AND s.date_deleted IS NULL
+		ORDER BY m.date_created`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.QueryMembers",
+		"query", database.Log(q, scopeID))
+
+	members := []Member{}
+	if err := r.db.SelectContext(ctx, &members, q, scopeID); err != nil {
+		return nil, errors.Wrapf(err, "selecting members of scope %q", scopeID)
+	}
+
+	return members, nil
+}
+
+// RemoveMember takes away access to the scope from the specified user. The
+// last owner of a scope can't be removed.
+func (r ScopeRepository) RemoveMember(ctx context.Context, traceID string, scopeID string, userID string, now time.Time) error {
+	if _, err := uuid.Parse(scopeID); err != nil {
+		return ErrInvalidID
+	}
+	if _, err := uuid.Parse(userID); err != nil {
+		return ErrInvalidID
+	}
+
+	const qr = `SELECT role FROM scope_members WHERE scope_id=$1 AND user_id=$2 FOR UPDATE`
+	const qo = `SELECT count(*) FROM scope_members WHERE scope_id=$1 AND role=$2`
+	const qd = `DELETE FROM scope_members WHERE scope_id=$1 AND user_id=$2`
+
+	return database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		if err := r.checkActive(ctx, tx, traceID, scopeID); err != nil {
+			return err
+		}
+
+		r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.RemoveMember",
+			"query", database.Log(qr, scopeID, userID))
+
+		var role string
+		if err := tx.GetContext(ctx, &role, qr, scopeID, userID); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrMemberNotFound
+			}
+			return errors.Wrap(err, "selecting member")
+		}
+
+		if role == RoleOwner {
+			r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.RemoveMember",
+				"query", database.Log(qo, scopeID, RoleOwner))
+
+			var owners int
+			if err := tx.GetContext(ctx, &owners, qo, scopeID, RoleOwner); err != nil {
+				return errors.Wrap(err, "counting owners")
+			}
+			if owners <= 1 {
+				return ErrLastOwner
+			}
+		}
+
+		r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.RemoveMember",
+			"query", database.Log(qd, scopeID, userID))
+
+		if _, err := tx.ExecContext(ctx, qd, scopeID, userID); err != nil {
+			return errors.Wrap(err, "deleting member")
+		}
+
+		ne := audit.NewEvent{
+			Action:   audit.ActionDelete,
+			Entity:   EntityMember,
+			EntityID: scopeID + "/" + userID,
+			Before:   map[string]string{"scope_id": scopeID, "user_id": userID, "role": role},
+		}
+		if err := audit.Record(ctx, tx, r.log, traceID, ne, now); err != nil {
+			return err
+		}
+
+		return r.syncGrants(ctx, tx, traceID, scopeID, userID, "", now)
+	})
+}
+
+// CreateInvitation invites the email to join the scope with the given role.
+// The returned token is the only way to accept the invitation and isn't
+// stored anywhere, so it must be handed to the invitee right away.
+func (r ScopeRepository) CreateInvitation(ctx context.Context, traceID string, claims auth.Claims, scopeID string, ni NewInvitation, now time.Time) (Invitation, string, error) {
+	if _, err := uuid.Parse(scopeID); err != nil {
+		return Invitation{}, "", ErrInvalidID
+	}
+
+	token, hash, err := secret.New()
+	if err != nil {
+		return Invitation{}, "", errors.Wrap(err, "generating invitation token")
+	}
+
+	inv := Invitation{
+		ID:          uuid.New().String(),
+		ScopeID:     scopeID,
+		Email:       ni.Email,
+		Role:        ni.Role,
+		TokenHash:   hash,
+		InvitedBy:   claims.Subject,
+		Status:      InvitationPending,
+		ExpiresAt:   now.Add(InvitationTTL).UTC(),
+		DateCreated: now.UTC(),
+		DateUpdated: now.UTC(),
+	}
+
+	const q = `INSERT INTO scope_invitations
+		(invitation_id, scope_id, email, role, token_hash, invited_by, status, expires_at, date_created, date_updated)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	err = database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		if err := r.checkActive(ctx, tx, traceID, scopeID); err != nil {
+			return err
+		}
+
+		r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.CreateInvitation",
+			"query", database.Log(q, inv.ID, inv.ScopeID, inv.Email, inv.Role, inv.TokenHash, inv.InvitedBy, inv.Status, inv.ExpiresAt, inv.DateCreated, inv.DateUpdated))
+
+		if _, err := tx.ExecContext(ctx, q, inv.ID, inv.ScopeID, inv.Email, inv.Role, inv.TokenHash, inv.InvitedBy, inv.Status, inv.ExpiresAt, inv.DateCreated, inv.DateUpdated); err != nil {
+			return errors.Wrap(err, "inserting invitation")
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionCreate,
+			Entity:   EntityInvitation,
+			EntityID: inv.ID,
+			After:    inv,
+		}, now)
+	})
+	if err != nil {
+		return Invitation{}, "", err
+	}
+
+	return inv, token, nil
+}
+
+// AcceptInvitation makes the calling user a member of the scope the invitation
+// was sent for. Only the user the invitation was sent to can accept it, and
+// members can't use an invitation to change their role.
+func (r ScopeRepository) AcceptInvitation(ctx context.Context, traceID string, claims auth.Claims, token string, now time.Time) (Member, error) {
+	var m Member
+	err := database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		inv, err := r.resolveInvitation(ctx, tx, traceID, claims, token, InvitationAccepted, now)
+		if err != nil {
+			return err
+		}
+
+		const q = `SELECT 1 FROM scope_members WHERE scope_id=$1 AND user_id=$2`
+
+		r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.AcceptInvitation",
+			"query", database.Log(q, inv.ScopeID, claims.Subject))
+
+		var exists int
+		err = tx.GetContext(ctx, &exists, q, inv.ScopeID, claims.Subject)
+		switch {
+		case err == nil:
+			return ErrAlreadyMember
+		case err != sql.ErrNoRows:
+			return errors.Wrap(err, "selecting member")
+		}
+
+		m = Member{
+			ScopeID:     inv.ScopeID,
+			UserID:      claims.Subject,
+			Role:        inv.Role,
+			DateCreated: now.UTC(),
+		}
+
+		return r.addMember(ctx, tx, traceID, m.ScopeID, m.UserID, m.Role, now)
+	})
+	if err != nil {
+		return Member{}, err
+	}
+
+	return m, nil
+}
+
+// DeclineInvitation marks the invitation as declined so it can't be used
+// anymore. Only the user the invitation was sent to can decline it.
+func (r ScopeRepository) DeclineInvitation(ctx context.Context, traceID string, claims auth.Claims, token string, now time.Time) error {
+	return database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		_, err := r.resolveInvitation(ctx, tx, traceID, claims, token, InvitationDeclined, now)
+		return err
+	})
+}
+
+// resolveInvitation finds the pending invitation for the token, makes sure it
+// was sent to the email of the calling user and moves it into the specified
+// status.
+func (r ScopeRepository) resolveInvitation(ctx context.Context, tx *sqlx.Tx, traceID string, claims auth.Claims, token string, status string, now time.Time) (Invitation, error) {
+	const q = `SELECT * FROM scope_invitations WHERE token_hash=$1 AND status=$2 FOR UPDATE`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.resolveInvitation",
+		"query", database.Log(q, database.Redact(token), InvitationPending))
+
+	var inv Invitation
+	if err := tx.GetContext(ctx, &inv, q, secret.Hash(token), InvitationPending); err != nil {
+		if err == sql.ErrNoRows {
+			return Invitation{}, ErrInvitationNotFound
+		}
+		return Invitation{}, errors.Wrap(err, "selecting invitation")
+	}
+
+	if now.After(inv.ExpiresAt) {
+		return Invitation{}, ErrInvitationExpired
+	}
+
+	const qe = `SELECT email FROM users WHERE user_id=$1 AND date_deleted IS NULL`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.resolveInvitation",
+		"query", database.Log(qe, claims.Subject))
+
+	var email string
+	if err := tx.GetContext(ctx, &email, qe, claims.Subject); err != nil {
+		if err == sql.ErrNoRows {
+			return Invitation{}, ErrInvitationMismatch
+		}
+		return Invitation{}, errors.Wrapf(err, "selecting user %q", claims.Subject)
+	}
+	if !strings.EqualFold(email, inv.Email) {
+		return Invitation{}, ErrInvitationMismatch
+	}
+
+	if err := r.checkActive(ctx, tx, traceID, inv.ScopeID); err != nil {
+		return Invitation{}, err
+	}
+
+	const qu = `UPDATE scope_invitations SET
+		"status"=$2,
+		"date_updated"=$3
+		WHERE invitation_id=$1`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.resolveInvitation",
+		"query", database.Log(qu, inv.ID, status, now.UTC()))
+
+	if _, err := tx.ExecContext(ctx, qu, inv.ID, status, now.UTC()); err != nil {
+		return Invitation{}, errors.Wrap(err, "updating invitation")
+	}
+	before := inv
+	inv.Status = status
+	inv.DateUpdated = now.UTC()
+
+	ne := audit.NewEvent{
+		Action:   audit.ActionUpdate,
+		Entity:   EntityInvitation,
+		EntityID: inv.ID,
+		Before:   before,
+		After:    inv,
+	}
+	if err := audit.Record(ctx, tx, r.log, traceID, ne, now); err != nil {
+		return Invitation{}, err
+	}
+
+	return inv, nil
+}
+
+// checkActive makes sure the scope exists and isn't deleted.
+func (r ScopeRepository) checkActive(ctx context.Context, tx *sqlx.Tx, traceID string, scopeID string) error {
+	const q = `SELECT 1 FROM scopes WHERE scope_id=$1 AND date_deleted IS NULL`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.checkActive",
+		"query", database.Log(q, scopeID))
+
+	var exists int
+	if err := tx.GetContext(ctx, &exists, q, scopeID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return errors.Wrapf(err, "selecting scope %q", scopeID)
+	}
+
+	return nil
+}
+
+// addMember stores the membership and the grants that come with the role.
+func (r ScopeRepository) addMember(ctx context.Context, tx *sqlx.Tx, traceID string, scopeID string, userID string, role string, now time.Time) error {
+	const q = `INSERT INTO scope_members
+		(scope_id, user_id, role, date_created)
+		VALUES($1, $2, $3, $4)`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.addMember",
+		"query", database.Log(q, scopeID, userID, role, now.UTC()))
+
+	if _, err := tx.ExecContext(ctx, q, scopeID, userID, role, now.UTC()); err != nil {
+		return errors.Wrap(err, "inserting member")
+	}
+
+	ne := audit.NewEvent{
+		Action:   audit.ActionCreate,
+		Entity:   EntityMember,
+		EntityID: scopeID + "/" + userID,
+		After:    Member{ScopeID: scopeID, UserID: userID, Role: role, DateCreated: now.UTC()},
+	}
+	if err := audit.Record(ctx, tx, r.log, traceID, ne, now); err != nil {
+		return err
+	}
+
+	return r.syncGrants(ctx, tx, traceID, scopeID, userID, role, now)
+}
+
+// syncGrants replaces the grants the user holds on the scope with the ones
+// the member role carries. An empty role revokes all of them. Every revoked
+// and given grant is recorded in the audit log.
+func (r ScopeRepository) syncGrants(ctx context.Context, tx *sqlx.Tx, traceID string, scopeID string, userID string, role string, now time.Time) error {
+	const qd = `DELETE FROM grants WHERE user_id=$1 AND resource_id=$2 RETURNING *`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.syncGrants",
+		"query", database.Log(qd, userID, scopeID))
+
+	var revoked []grant.Grant
+	if err := tx.SelectContext(ctx, &revoked, qd, userID, scopeID); err != nil {
+		return errors.Wrap(err, "deleting grants")
+	}
+
+	for _, g := range revoked {
+		ne := audit.NewEvent{
+			Action:   audit.ActionDelete,
+			Entity:   grant.Entity,
+			EntityID: g.ID,
+			Before:   g,
+		}
+		if err := audit.Record(ctx, tx, r.log, traceID, ne, now); err != nil {
+			return err
+		}
+	}
+
+	const qi = `INSERT INTO grants
+		(grant_id, user_id, resource_id, permission, date_created)
+		VALUES($1, $2, $3, $4, $5)`
+
+	for _, perm := range memberPermissions[role] {
+		g := grant.Grant{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			ResourceID:  scopeID,
+			Permission:  string(perm),
+			DateCreated: now.UTC(),
+		}
+
+		r.log.Debug("query", "trace_id", traceID, "op", "ScopeRepository.syncGrants",
+			"query", database.Log(qi, g.ID, g.UserID, g.ResourceID, g.Permission, g.DateCreated))
+
+		if _, err := tx.ExecContext(ctx, qi, g.ID, g.UserID, g.ResourceID, g.Permission, g.DateCreated); err != nil {
+			return errors.Wrap(err, "inserting grant")
+		}
+
+		ne := audit.NewEvent{
+			Action:   audit.ActionCreate,
+			Entity:   grant.Entity,
+			EntityID: g.ID,
+			After:    g,
+		}
+		if err := audit.Record(ctx, tx, r.log, traceID, ne, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// subjectID returns the user ID from the claims in a form that can always be
+// compared to a UUID column.
+func subjectID(claims auth.Claims) string {
+	if _, err := uuid.Parse(claims.Subject); err != nil {
+		return uuid.Nil.String()
+	}
+	return claims.Subject
+}
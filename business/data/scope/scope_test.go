@@ -0,0 +1,192 @@
+package scope_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/audit"
+	"github.com/egorovdmi/financify/business/data/dbschema"
+	"github.com/egorovdmi/financify/business/data/grant"
+	"github.com/egorovdmi/financify/business/data/scope"
+	"github.com/egorovdmi/financify/business/tests"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestScope(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	ctx := tests.Context()
+	if err := dbschema.Seed(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	sr := scope.NewScopeRepository(log, db)
+	gr := grant.NewGrantRepository(log, db)
+	ar := audit.NewAuditRepository(log, db)
+
+	ownerClaims := auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: tests.UserID},
+		Roles:            []string{auth.RoleUser},
+	}
+	memberClaims := auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: tests.AdminID},
+		Roles:            []string{auth.RoleUser},
+	}
+
+	t.Log("Given the need to share a Scope between users.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen inviting a second user to a new Scope.", testID)
+		{
+			now := time.Date(2022, time.October, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			s, err := sr.Create(ctx, traceID, ownerClaims, scope.NewScope{Title: "Household"}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a scope: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create a scope.", tests.Success, testID)
+
+			if ok, err := gr.Exists(ctx, traceID, tests.UserID, s.ID, auth.PermScopeManage); err != nil || !ok {
+				t.Fatalf("\t%s\tTest %d:\tShould grant the owner the right to manage the scope: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould grant the owner the right to manage the scope.", tests.Success, testID)
+
+			if _, err := sr.QueryByID(ctx, traceID, memberClaims, s.ID); err != scope.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT see the scope before becoming a member: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT see the scope before becoming a member.", tests.Success, testID)
+
+			ni := scope.NewInvitation{
+				Email: "Admin@Example.com",
+				Role:  scope.RoleViewer,
+			}
+
+			_, token, err := sr.CreateInvitation(ctx, traceID, ownerClaims, s.ID, ni, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to invite a user: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to invite a user.", tests.Success, testID)
+
+			if _, err := sr.AcceptInvitation(ctx, traceID, memberClaims, token, now.Add(scope.InvitationTTL+time.Minute)); err != scope.ErrInvitationExpired {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept an expired invitation: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT accept an expired invitation.", tests.Success, testID)
+
+			if _, err := sr.AcceptInvitation(ctx, traceID, ownerClaims, token, now); err != scope.ErrInvitationMismatch {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept an invitation sent to another email: %v.", tests.Failed, testID, err)
+			}
+			if err := sr.DeclineInvitation(ctx, traceID, ownerClaims, token, now); err != scope.ErrInvitationMismatch {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT decline an invitation sent to another email: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT resolve an invitation sent to another email.", tests.Success, testID)
+
+			m, err := sr.AcceptInvitation(ctx, traceID, memberClaims, token, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to accept the invitation whatever the case of its email: %s.", tests.Failed, testID, err)
+			}
+			if m.Role != scope.RoleViewer {
+				t.Fatalf("\t%s\tTest %d:\tShould become a member with the invited role : got %q want %q.", tests.Failed, testID, m.Role, scope.RoleViewer)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to accept the invitation whatever the case of its email.", tests.Success, testID)
+
+			if _, err := sr.AcceptInvitation(ctx, traceID, memberClaims, token, now); err != scope.ErrInvitationNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept the same invitation twice: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT accept the same invitation twice.", tests.Success, testID)
+
+			if _, err := sr.QueryByID(ctx, traceID, memberClaims, s.ID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould see the scope as a member: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould see the scope as a member.", tests.Success, testID)
+
+			if ok, err := gr.Exists(ctx, traceID, tests.AdminID, s.ID, auth.PermScopeWrite); err != nil || ok {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT grant a viewer the right to write: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT grant a viewer the right to write.", tests.Success, testID)
+
+			scopes, err := sr.Query(ctx, traceID, memberClaims)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query scopes: %s.", tests.Failed, testID, err)
+			}
+			if len(scopes) != 1 || scopes[0].ID != s.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould only get the shared scope : got %d scopes.", tests.Failed, testID, len(scopes))
+			}
+			t.Logf("\t%s\tTest %d:\tShould only get the shared scope.", tests.Success, testID)
+
+			members, err := sr.QueryMembers(ctx, traceID, s.ID)
+			if err != nil || len(members) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould get both members: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get both members.", tests.Success, testID)
+
+			oi := scope.NewInvitation{
+				Email: "user@example.com",
+				Role:  scope.RoleViewer,
+			}
+			_, ownerToken, err := sr.CreateInvitation(ctx, traceID, ownerClaims, s.ID, oi, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to invite an existing member: %s.", tests.Failed, testID, err)
+			}
+			if _, err := sr.AcceptInvitation(ctx, traceID, ownerClaims, ownerToken, now); err != scope.ErrAlreadyMember {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT change the role of a member through an invitation: %v.", tests.Failed, testID, err)
+			}
+			if ok, err := gr.Exists(ctx, traceID, tests.UserID, s.ID, auth.PermScopeManage); err != nil || !ok {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the owner an owner: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT change the role of a member through an invitation.", tests.Success, testID)
+
+			if err := sr.RemoveMember(ctx, traceID, s.ID, tests.UserID, now); err != scope.ErrLastOwner {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to remove the last owner: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to remove the last owner.", tests.Success, testID)
+
+			if err := sr.RemoveMember(ctx, traceID, s.ID, tests.AdminID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to remove a member: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to remove a member.", tests.Success, testID)
+
+			if ok, err := gr.Exists(ctx, traceID, tests.AdminID, s.ID, auth.PermScopeRead); err != nil || ok {
+				t.Fatalf("\t%s\tTest %d:\tShould revoke the grants of a removed member: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould revoke the grants of a removed member.", tests.Success, testID)
+
+			events, err := ar.Query(ctx, traceID, audit.Filter{Entity: grant.Entity})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query grant events: %s.", tests.Failed, testID, err)
+			}
+			var created, deleted int
+			for _, e := range events {
+				switch e.Action {
+				case audit.ActionCreate:
+					created++
+				case audit.ActionDelete:
+					deleted++
+				}
+			}
+
+			// Three grants for the owner and one for the viewer, which was revoked.
+			if created != 4 || deleted != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould audit every given and revoked grant : got %d created, %d deleted.", tests.Failed, testID, created, deleted)
+			}
+			t.Logf("\t%s\tTest %d:\tShould audit every given and revoked grant.", tests.Success, testID)
+
+			_, token, err = sr.CreateInvitation(ctx, traceID, ownerClaims, s.ID, ni, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to invite a user again: %s.", tests.Failed, testID, err)
+			}
+
+			if err := sr.DeclineInvitation(ctx, traceID, memberClaims, token, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to decline an invitation: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to decline an invitation.", tests.Success, testID)
+
+			if _, err := sr.AcceptInvitation(ctx, traceID, memberClaims, token, now); err != scope.ErrInvitationNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept a declined invitation: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT accept a declined invitation.", tests.Success, testID)
+		}
+	}
+}
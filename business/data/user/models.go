@@ -1,6 +1,7 @@
 package user
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/lib/pq"
@@ -8,20 +9,30 @@ import (
 
 // User represents an individual user.
 type User struct {
-	ID           string         `db:"user_id" json:"id"`
-	Name         string         `db:"name" json:"name"`
-	Email        string         `db:"email" json:"email"`
-	Roles        pq.StringArray `db:"roles" json:"roles"`
-	PasswordHash []byte         `db:"password_hash" json:"-"`
-	DateCreated  time.Time      `db:"date_created" json:"date_created"`
-	DateUpdated  time.Time      `db:"date_updated" json:"date_updated"`
+	ID              string         `db:"user_id" json:"id"`
+	Name            string         `db:"name" json:"name"`
+	Email           string         `db:"email" json:"email"`
+	Roles           pq.StringArray `db:"roles" json:"roles"`
+	PasswordHash    []byte         `db:"password_hash" json:"-"`
+	Verified        bool           `db:"verified" json:"verified"`
+	SessionsRevoked *time.Time     `db:"date_sessions_revoked" json:"-"`
+	DateCreated     time.Time      `db:"date_created" json:"date_created"`
+	DateUpdated     time.Time      `db:"date_updated" json:"date_updated"`
+	DateDeleted     *time.Time     `db:"date_deleted" json:"date_deleted,omitempty"`
+	Version         int            `db:"version" json:"-"`
 }
 
+// ETag identifies the version of the user. It changes with every update.
+func (u User) ETag() string {
+	return strconv.Itoa(u.Version)
+}
+
+// NewUser contains information needed to create a new User.
 type NewUser struct {
 	Name            string   `json:"name" validate:"required"`
 	Email           string   `json:"email" validate:"required,email"`
-	Roles           []string `json:"roles" validate:"required"`
-	Password        string   `json:"password" validate:"required"`
+	Roles           []string `json:"roles" validate:"required,dive,oneof=ADMIN USER"`
+	Password        string   `json:"password" validate:"required,password,nefold=Email"`
 	PasswordConfirm string   `json:"password_confirm" validate:"eqfield=Password"`
 }
 
@@ -34,7 +45,63 @@ type NewUser struct {
 type UpdateUser struct {
 	Name            *string  `json:"name"`
 	Email           *string  `json:"email" validate:"omitempty,email"`
-	Roles           []string `json:"roles"`
-	Password        *string  `json:"password"`
+	Roles           []string `json:"roles" validate:"omitempty,dive,oneof=ADMIN USER"`
+	Password        *string  `json:"password" validate:"omitempty,password,nefold=Email"`
 	PasswordConfirm *string  `json:"password_confirm" validate:"omitempty,eqfield=Password"`
+	CurrentPassword *string  `json:"current_password"`
+}
+
+// PatchUser is the representation of a User that merge patches are applied
+// to. Passwords aren't part of a User so they're only present when a patch
+// sets them.
+type PatchUser struct {
+	Name            string   `json:"name" validate:"required"`
+	Email           string   `json:"email" validate:"required,email"`
+	Roles           []string `json:"roles" validate:"required,dive,oneof=ADMIN USER"`
+	Password        string   `json:"password,omitempty" validate:"omitempty,password,nefold=Email"`
+	PasswordConfirm string   `json:"password_confirm,omitempty" validate:"eqfield=Password"`
+	CurrentPassword string   `json:"current_password,omitempty"`
+}
+
+// NewPatchUser returns the representation of the user for a merge patch.
+func NewPatchUser(u User) PatchUser {
+	return PatchUser{
+		Name:  u.Name,
+		Email: u.Email,
+		Roles: u.Roles,
+	}
+}
+
+// Changes returns the update turning the user into the patched one. Fields
+// that weren't changed are left out so they need no authorization.
+func (pu PatchUser) Changes(u User) UpdateUser {
+	var uu UpdateUser
+	if pu.Name != u.Name {
+		uu.Name = &pu.Name
+	}
+	if pu.Email != u.Email {
+		uu.Email = &pu.Email
+	}
+	if !equalRoles(pu.Roles, u.Roles) {
+		uu.Roles = pu.Roles
+	}
+	if pu.Password != "" {
+		uu.Password = &pu.Password
+		uu.PasswordConfirm = &pu.PasswordConfirm
+		uu.CurrentPassword = &pu.CurrentPassword
+	}
+	return uu
+}
+
+// equalRoles reports whether both sets of roles are the same.
+func equalRoles(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
@@ -3,33 +3,64 @@ package user
 import (
 	"context"
 	"database/sql"
-	"log"
 	"time"
 
 	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/audit"
+	"github.com/egorovdmi/financify/business/sys/pwhash"
+	"github.com/egorovdmi/financify/business/sys/secret"
+	"github.com/egorovdmi/financify/business/sys/validate"
 	"github.com/egorovdmi/financify/foundation/database"
-	"github.com/golang-jwt/jwt/v4"
+	"github.com/egorovdmi/financify/foundation/logger"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/trace"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // Set of error variables for CRUD operations.
 var (
-	ErrNotFound              = errors.New("user not found")
-	ErrInvalidID             = errors.New("ID is not in its proper form")
-	ErrForbidden             = errors.New("authorization failed")
-	ErrAuthenticationFailure = errors.New("authentication failed")
+	ErrNotFound             = errors.New("user not found")
+	ErrInvalidID            = errors.New("ID is not in its proper form")
+	ErrForbidden            = errors.New("authorization failed")
+	ErrEmailTaken           = errors.New("email is already in use")
+	ErrVersionMismatch      = errors.New("user was modified by another request")
+	ErrVerificationNotFound = errors.New("verification not found")
+	ErrVerificationExpired  = errors.New("verification expired")
+
+	ErrPasswordResetNotFound = errors.New("password reset not found")
+	ErrPasswordResetExpired  = errors.New("password reset expired")
+
+	// ErrWrongPassword occurs when users changing their own password don't
+	// confirm it with the current one.
+	ErrWrongPassword = errors.New("current password is wrong")
+
+	// ErrLastOwner occurs when deleting a user who is the only owner of a
+	// scope shared with other members, who would be left without one.
+	ErrLastOwner = errors.New("user is the last owner of a shared scope")
 )
 
+const (
+	// VerificationTTL is how long a self-registered user has to verify their email.
+	VerificationTTL = 48 * time.Hour
+
+	// PasswordResetTTL is how long a password reset token can be used.
+	PasswordResetTTL = time.Hour
+)
+
+// Entity names users in the audit log.
+const Entity = "user"
+
+// uniqueViolation is the postgres error code for unique constraint violations.
+const uniqueViolation = "23505"
+
 type UserRepository struct {
-	log *log.Logger
+	log *logger.Logger
 	db  *sqlx.DB
 }
 
-func NewUserRepository(log *log.Logger, db *sqlx.DB) UserRepository {
+func NewUserRepository(log *logger.Logger, db *sqlx.DB) UserRepository {
 	return UserRepository{
 		log: log,
 		db:  db,
@@ -37,7 +68,125 @@ func NewUserRepository(log *log.Logger, db *sqlx.DB) UserRepository {
 }
 
 func (r UserRepository) Create(ctx context.Context, traceID string, nu NewUser, now time.Time) (User, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(nu.Password), bcrypt.DefaultCost)
+	u, err := newUser(nu, true, now)
+	if err != nil {
+		return User{}, err
+	}
+
+	err = database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		return r.insert(ctx, tx, traceID, "UserRepository.Create", u, now)
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return u, nil
+}
+
+// Register adds a new user who must verify their email before being able to
+// sign in. The returned token verifies the email and isn't stored anywhere,
+// so it must be delivered to the user right away.
+func (r UserRepository) Register(ctx context.Context, traceID string, nu NewUser, now time.Time) (User, string, error) {
+	u, err := newUser(nu, false, now)
+	if err != nil {
+		return User{}, "", err
+	}
+
+	token, hash, err := secret.New()
+	if err != nil {
+		return User{}, "", errors.Wrap(err, "generating verification token")
+	}
+
+	const q = `INSERT INTO user_verifications
+		(token_hash, user_id, expires_at, date_created)
+		VALUES($1, $2, $3, $4)`
+
+	expires := now.Add(VerificationTTL).UTC()
+
+	err = database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		if err := r.insert(ctx, tx, traceID, "UserRepository.Register", u, now); err != nil {
+			return err
+		}
+
+		r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.Register",
+			"query", database.Log(q, hash, u.ID, expires, u.DateCreated))
+
+		if _, err := tx.ExecContext(ctx, q, hash, u.ID, expires, u.DateCreated); err != nil {
+			return errors.Wrap(err, "inserting verification")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return User{}, "", err
+	}
+
+	return u, token, nil
+}
+
+// Verify marks the email of the user the token was issued for as verified.
+// Every token can be used only once.
+func (r UserRepository) Verify(ctx context.Context, traceID string, token string, now time.Time) (User, error) {
+	const qd = `DELETE FROM user_verifications WHERE token_hash=$1 RETURNING user_id, expires_at`
+	const qu = `UPDATE users SET
+		"verified"=true,
+		"date_updated"=$2,
+		"version"=version+1
+		WHERE user_id=$1 AND date_deleted IS NULL
+		RETURNING *`
+
+	var u User
+	err := database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.Verify",
+			"query", database.Log(qd, database.Redact(token)))
+
+		var v struct {
+			UserID    string    `db:"user_id"`
+			ExpiresAt time.Time `db:"expires_at"`
+		}
+		if err := tx.GetContext(ctx, &v, qd, secret.Hash(token)); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrVerificationNotFound
+			}
+			return errors.Wrap(err, "deleting verification")
+		}
+
+		if now.After(v.ExpiresAt) {
+			return ErrVerificationExpired
+		}
+
+		r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.Verify",
+			"query", database.Log(qu, v.UserID, now.UTC()))
+
+		if err := tx.GetContext(ctx, &u, qu, v.UserID, now.UTC()); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return errors.Wrapf(err, "verifying user %q", v.UserID)
+		}
+
+		type verification struct {
+			Verified bool `json:"verified"`
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionUpdate,
+			Entity:   Entity,
+			EntityID: u.ID,
+			Before:   verification{Verified: false},
+			After:    verification{Verified: true},
+		}, now)
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return u, nil
+}
+
+// newUser constructs the user to be stored from the provided information.
+func newUser(nu NewUser, verified bool, now time.Time) (User, error) {
+	hash, err := pwhash.Generate(nu.Password)
 	if err != nil {
 		return User{}, errors.Wrap(err, "generation password hash")
 	}
@@ -48,45 +197,99 @@ func (r UserRepository) Create(ctx context.Context, traceID string, nu NewUser,
 		Email:        nu.Email,
 		PasswordHash: hash,
 		Roles:        nu.Roles,
+		Verified:     verified,
 		DateCreated:  now.UTC(),
 		DateUpdated:  now.UTC(),
+		Version:      1,
 	}
 
+	return u, nil
+}
+
+// insert stores the user and records its creation within the transaction.
+func (r UserRepository) insert(ctx context.Context, tx sqlx.ExtContext, traceID string, op string, u User, now time.Time) error {
 	const q = `INSERT INTO users
-		(user_id, name, email, roles, password_hash, date_created, date_updated)
-		VALUES($1, $2, $3, $4, $5, $6, $7)`
+		(user_id, name, email, roles, password_hash, verified, date_created, date_updated)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8)`
 
-	r.log.Printf("%s : %s : query : %s", traceID, "UserRepository.Create",
-		database.Log(q, u.ID, u.Name, u.Email, u.Roles, u.PasswordHash, u.DateCreated, u.DateUpdated))
+	r.log.Debug("query", "trace_id", traceID, "op", op,
+		"query", database.Log(q, u.ID, u.Name, u.Email, u.Roles, u.PasswordHash, u.Verified, u.DateCreated, u.DateUpdated))
 
-	if _, err = r.db.ExecContext(ctx, q, u.ID, u.Name, u.Email, u.Roles, u.PasswordHash, u.DateCreated, u.DateUpdated); err != nil {
-		return User{}, errors.Wrap(err, "inserting user")
+	if _, err := tx.ExecContext(ctx, q, u.ID, u.Name, u.Email, u.Roles, u.PasswordHash, u.Verified, u.DateCreated, u.DateUpdated); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation {
+			return ErrEmailTaken
+		}
+		return errors.Wrap(err, "inserting user")
 	}
 
-	return u, nil
+	return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+		Action:   audit.ActionCreate,
+		Entity:   Entity,
+		EntityID: u.ID,
+		After:    u,
+	}, now)
 }
 
-func (r UserRepository) Update(ctx context.Context, traceID string, claims auth.Claims, userID string, uu UpdateUser, now time.Time) error {
+// Update modifies the user. A non-empty etag must match the current version
+// of the user, otherwise ErrVersionMismatch is returned. Concurrent updates
+// are detected even without one. Changing the email marks it unverified.
+// Users changing their own password must
+// confirm it with the current one, and every session of the user issued
+// before a password change is revoked.
+func (r UserRepository) Update(ctx context.Context, traceID string, claims auth.Claims, userID string, uu UpdateUser, etag string, now time.Time) error {
 	u, err := r.QueryByID(ctx, traceID, claims, userID)
 	if err != nil {
 		return err
 	}
 
+	if etag != "" && etag != u.ETag() {
+		return ErrVersionMismatch
+	}
+
+	// Only admins can change roles, otherwise users could promote themselves.
+	if uu.Roles != nil && !claims.Authorize(auth.RoleAdmin) {
+		return ErrForbidden
+	}
+
+	before := u
+
 	if uu.Name != nil {
 		u.Name = *uu.Name
 	}
 	if uu.Email != nil {
+
+		// A new email must be proven to belong to the user like the first one.
+		if *uu.Email != u.Email {
+			u.Verified = false
+		}
 		u.Email = *uu.Email
 	}
 	if uu.Roles != nil {
 		u.Roles = uu.Roles
 	}
 	if uu.Password != nil {
-		hash, err := bcrypt.GenerateFromPassword([]byte(*uu.Password), bcrypt.DefaultCost)
+
+		// A stolen session mustn't be enough to lock the owner out. Admins
+		// setting the password of somebody else can't know the current one.
+		if claims.Subject == u.ID {
+			if uu.CurrentPassword == nil || pwhash.Compare(u.PasswordHash, *uu.CurrentPassword) != nil {
+				return ErrWrongPassword
+			}
+		}
+
+		// The email may not be part of the update, so it's checked here.
+		if err := validate.CheckPassword(*uu.Password, u.Email); err != nil {
+			return err
+		}
+
+		hash, err := pwhash.Generate(*uu.Password)
 		if err != nil {
 			return errors.Wrap(err, "generation password hash")
 		}
 		u.PasswordHash = hash
+
+		revoked := now.UTC()
+		u.SessionsRevoked = &revoked
 	}
 	u.DateUpdated = now.UTC()
 
@@ -95,34 +298,226 @@ func (r UserRepository) Update(ctx context.Context, traceID string, claims auth.
 		"email"=$3,
 		"roles"=$4,
 		"password_hash"=$5,
-		"date_updated"=$6
-		WHERE user_id=$1`
+		"verified"=$6,
+		"date_sessions_revoked"=$7,
+		"date_updated"=$8,
+		"version"=version+1
+		WHERE user_id=$1 AND version=$9 AND date_deleted IS NULL`
 
-	r.log.Printf("%s : %s : query : %s", traceID, "UserRepository.Update",
-		database.Log(q, u.ID, u.Name, u.Email, u.Roles, u.PasswordHash, u.DateUpdated))
+	return database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.Update",
+			"query", database.Log(q, u.ID, u.Name, u.Email, u.Roles, u.PasswordHash, u.Verified, u.SessionsRevoked, u.DateUpdated, before.Version))
 
-	if _, err = r.db.ExecContext(ctx, q, u.ID, u.Name, u.Email, u.Roles, u.PasswordHash, u.DateUpdated); err != nil {
-		return errors.Wrap(err, "updating user")
-	}
+		res, err := tx.ExecContext(ctx, q, u.ID, u.Name, u.Email, u.Roles, u.PasswordHash, u.Verified, u.SessionsRevoked, u.DateUpdated, before.Version)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation {
+				return ErrEmailTaken
+			}
+			return errors.Wrap(err, "updating user")
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrVersionMismatch
+		}
+		u.Version++
+
+		// The hash is hidden from JSON, so a marker records the password change.
+		var after interface{} = u
+		if uu.Password != nil {
+			after = struct {
+				User
+				PasswordChanged bool       `json:"password_changed"`
+				SessionsRevoked *time.Time `json:"date_sessions_revoked"`
+			}{u, true, u.SessionsRevoked}
+		}
 
-	return nil
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionUpdate,
+			Entity:   Entity,
+			EntityID: u.ID,
+			Before:   before,
+			After:    after,
+		}, now)
+	})
 }
 
-func (r UserRepository) Delete(ctx context.Context, traceID string, userID string) error {
+// soleOwner holds for users, aliased u, owning a scope shared with other
+// members without another active owner.
+const soleOwner = `EXISTS (
+	SELECT 1 FROM scope_members m
+	WHERE m.user_id = u.user_id AND m.role = 'OWNER'
+	AND EXISTS (SELECT 1 FROM scope_members o WHERE o.scope_id = m.scope_id AND o.user_id <> m.user_id)
+	AND NOT EXISTS (
+		SELECT 1 FROM scope_members o JOIN users ou ON ou.user_id = o.user_id
+		WHERE o.scope_id = m.scope_id AND o.user_id <> m.user_id AND o.role = 'OWNER' AND ou.date_deleted IS NULL))`
+
+// Delete marks the user as deleted until it's restored or purged. A non-empty
+// etag must match the current version of the user, otherwise
+// ErrVersionMismatch is returned. The last owner of a shared scope can't be
+// deleted, ownership must be handed over first.
+func (r UserRepository) Delete(ctx context.Context, traceID string, claims auth.Claims, userID string, etag string, now time.Time) error {
 	if _, err := uuid.Parse(userID); err != nil {
 		return ErrInvalidID
 	}
 
-	const q = `DELETE FROM users WHERE user_id=$1`
+	if !claims.Authorize(auth.RoleAdmin) && claims.Subject != userID {
+		return ErrForbidden
+	}
+
+	const qs = `SELECT * FROM users WHERE user_id=$1 AND date_deleted IS NULL FOR UPDATE`
+	const qo = `SELECT ` + soleOwner + ` FROM users u WHERE u.user_id=$1`
+	const q = `UPDATE users SET
+		"date_deleted"=$2,
+		"version"=version+1
+		WHERE user_id=$1`
+
+	return database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.Delete",
+			"query", database.Log(qs, userID))
+
+		var u User
+		if err := tx.GetContext(ctx, &u, qs, userID); err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return errors.Wrapf(err, "selecting user %q", userID)
+		}
+
+		if etag != "" && etag != u.ETag() {
+			return ErrVersionMismatch
+		}
+
+		r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.Delete",
+			"query", database.Log(qo, userID))
+
+		var owner bool
+		if err := tx.GetContext(ctx, &owner, qo, userID); err != nil {
+			return errors.Wrapf(err, "checking scopes owned by user %q", userID)
+		}
+		if owner {
+			return ErrLastOwner
+		}
+
+		r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.Delete",
+			"query", database.Log(q, userID, now.UTC()))
 
-	r.log.Printf("%s : %s : query : %s", traceID, "UserRepository.Delete",
-		database.Log(q, userID))
+		if _, err := tx.ExecContext(ctx, q, userID, now.UTC()); err != nil {
+			return errors.Wrap(err, "deleting user")
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionDelete,
+			Entity:   Entity,
+			EntityID: u.ID,
+			Before:   u,
+		}, now)
+	})
+}
 
-	if _, err := r.db.ExecContext(ctx, q, userID); err != nil {
-		return errors.Wrap(err, "deleting user")
+// Restore brings back a deleted user that wasn't purged yet. It's meant for
+// admins and performs no authorization checks.
+func (r UserRepository) Restore(ctx context.Context, traceID string, userID string, now time.Time) (User, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return User{}, ErrInvalidID
 	}
 
-	return nil
+	const q = `UPDATE users SET
+		"date_deleted"=NULL,
+		"date_updated"=$2,
+		"version"=version+1
+		WHERE user_id=$1 AND date_deleted IS NOT NULL
+		RETURNING *`
+
+	var u User
+	err := database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.Restore",
+			"query", database.Log(q, userID, now.UTC()))
+
+		if err := tx.GetContext(ctx, &u, q, userID, now.UTC()); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation {
+				return ErrEmailTaken
+			}
+			return errors.Wrapf(err, "restoring user %q", userID)
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionRestore,
+			Entity:   Entity,
+			EntityID: u.ID,
+			After:    u,
+		}, now)
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return u, nil
+}
+
+// Purge permanently removes the users deleted before the specified time and
+// returns how many were removed. Scopes only they are a member of go with
+// them. What they created in scopes shared with others is handed over to the
+// remaining owner, or the earliest member when there is none, so it survives.
+// Users who are still the last owner of a shared scope are kept.
+func (r UserRepository) Purge(ctx context.Context, traceID string, before time.Time, now time.Time) (int, error) {
+	const qs = `SELECT user_id FROM users u WHERE date_deleted < $1 AND NOT ` + soleOwner + ` FOR UPDATE`
+
+	// successors picks who takes over the records of the purged users in
+	// every scope with other members.
+	const successors = `(SELECT DISTINCT ON (m.scope_id) m.scope_id, m.user_id
+		FROM scope_members m
+		WHERE m.user_id <> ALL($1)
+		ORDER BY m.scope_id, m.role = 'OWNER' DESC, m.date_created) h`
+
+	handovers := []string{
+		`UPDATE scopes s SET user_id = h.user_id FROM ` + successors + ` WHERE h.scope_id = s.scope_id AND s.user_id = ANY($1)`,
+		`UPDATE wallets w SET user_id = h.user_id FROM ` + successors + ` WHERE h.scope_id = w.scope_id AND w.user_id = ANY($1)`,
+		`UPDATE payments p SET user_id = h.user_id FROM ` + successors + ` WHERE h.scope_id = p.scope_id AND p.user_id = ANY($1)`,
+	}
+
+	const qd = `DELETE FROM users WHERE user_id = ANY($1)`
+
+	var ids []string
+	err := database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.Purge",
+			"query", database.Log(qs, before.UTC()))
+
+		if err := tx.SelectContext(ctx, &ids, qs, before.UTC()); err != nil {
+			return errors.Wrap(err, "selecting users to purge")
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		for _, q := range append(handovers, qd) {
+			r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.Purge",
+				"query", database.Log(q, ids))
+
+			if _, err := tx.ExecContext(ctx, q, pq.Array(ids)); err != nil {
+				return errors.Wrap(err, "purging users")
+			}
+		}
+
+		for _, id := range ids {
+			ne := audit.NewEvent{
+				Action:   audit.ActionPurge,
+				Entity:   Entity,
+				EntityID: id,
+			}
+			if err := audit.Record(ctx, tx, r.log, traceID, ne, now); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
 }
 
 func (r UserRepository) Query(ctx context.Context, traceID string) ([]User, error) {
@@ -130,10 +525,10 @@ func (r UserRepository) Query(ctx context.Context, traceID string) ([]User, erro
 	ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "UserRepository.Query")
 	defer span.End()
 
-	const q = `SELECT * FROM users`
+	const q = `SELECT * FROM users WHERE date_deleted IS NULL`
 
-	r.log.Printf("%s : %s : query : %s", traceID, "UserRepository.Query",
-		database.Log(q))
+	r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.Query",
+		"query", database.Log(q))
 
 	users := []User{}
 	if err := r.db.SelectContext(ctx, &users, q); err != nil {
@@ -152,80 +547,232 @@ func (r UserRepository) QueryByID(ctx context.Context, traceID string, claims au
 		return User{}, ErrForbidden
 	}
 
-	const q = `SELECT * FROM users WHERE user_id=$1`
+	return r.LookupByID(ctx, traceID, userID)
+}
+
+func (r UserRepository) QueryByEmail(ctx context.Context, traceID string, claims auth.Claims, email string) (User, error) {
+	u, err := r.LookupByEmail(ctx, traceID, email)
+	if err != nil {
+		return User{}, err
+	}
+
+	if !claims.Authorize(auth.RoleAdmin) && claims.Subject != u.ID {
+		return User{}, ErrForbidden
+	}
+
+	return u, nil
+}
+
+// LookupByEmail gets the specified user from the database without performing
+// any authorization checks. It exists for the business layer to check
+// credentials and must never be exposed to clients directly.
+func (r UserRepository) LookupByEmail(ctx context.Context, traceID string, email string) (User, error) {
+	const q = `SELECT * FROM users WHERE email=$1 AND date_deleted IS NULL`
 
-	r.log.Printf("%s : %s : query : %s", traceID, "UserRepository.QueryByID",
-		database.Log(q, userID))
+	r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.LookupByEmail",
+		"query", database.Log(q, email))
 
 	var u User
-	if err := r.db.GetContext(ctx, &u, q, userID); err != nil {
+	if err := r.db.GetContext(ctx, &u, q, email); err != nil {
 		if err == sql.ErrNoRows {
 			return User{}, ErrNotFound
 		}
-		return User{}, errors.Wrapf(err, "selecting user %q", userID)
+		return User{}, errors.Wrap(err, "selecting user by email")
 	}
 
 	return u, nil
 }
 
-func (r UserRepository) QueryByEmail(ctx context.Context, traceID string, claims auth.Claims, email string) (User, error) {
-	const q = `SELECT * FROM users WHERE email=$1`
+// LookupByID gets the specified user from the database without performing any
+// authorization checks. It exists for the business layer to validate sessions
+// and must never be exposed to clients directly.
+func (r UserRepository) LookupByID(ctx context.Context, traceID string, userID string) (User, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return User{}, ErrInvalidID
+	}
+
+	const q = `SELECT * FROM users WHERE user_id=$1 AND date_deleted IS NULL`
 
-	r.log.Printf("%s : %s : query : %s", traceID, "UserRepository.QueryByEmail",
-		database.Log(q, email))
+	r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.LookupByID",
+		"query", database.Log(q, userID))
 
 	var u User
-	if err := r.db.GetContext(ctx, &u, q, email); err != nil {
+	if err := r.db.GetContext(ctx, &u, q, userID); err != nil {
 		if err == sql.ErrNoRows {
 			return User{}, ErrNotFound
 		}
-		return User{}, errors.Wrapf(err, "selecting user %q", email)
-	}
-
-	if !claims.Authorize(auth.RoleAdmin) && claims.Subject != u.ID {
-		return User{}, ErrForbidden
+		return User{}, errors.Wrapf(err, "selecting user %q", userID)
 	}
 
 	return u, nil
 }
 
-func (r UserRepository) Authenticate(ctx context.Context, traceID string, email string, password string, now time.Time) (auth.Claims, error) {
-	adminClaims := auth.Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    "service project",
-			Audience:  jwt.ClaimStrings{"students"},
-			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(now),
-		},
-		Roles: []string{auth.RoleAdmin},
+// CreateVerification issues a new token verifying the email of the user. Any
+// token issued for the user before stops being valid. The returned token isn't
+// stored anywhere, so it must be delivered to the user right away.
+func (r UserRepository) CreateVerification(ctx context.Context, traceID string, userID string, now time.Time) (string, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return "", ErrInvalidID
 	}
 
-	usr, err := r.QueryByEmail(ctx, traceID, adminClaims, email)
+	token, hash, err := secret.New()
 	if err != nil {
-		switch err {
-		case ErrNotFound:
-			return auth.Claims{}, ErrAuthenticationFailure
-		case ErrForbidden:
-			return auth.Claims{}, ErrAuthenticationFailure
-		default:
-			return auth.Claims{}, errors.Wrap(err, "unable to query user by email")
+		return "", errors.Wrap(err, "generating verification token")
+	}
+
+	const qd = `DELETE FROM user_verifications WHERE user_id=$1`
+	const q = `INSERT INTO user_verifications
+		(token_hash, user_id, expires_at, date_created)
+		VALUES($1, $2, $3, $4)`
+
+	expires := now.Add(VerificationTTL).UTC()
+
+	err = database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.CreateVerification",
+			"query", database.Log(qd, userID))
+
+		if _, err := tx.ExecContext(ctx, qd, userID); err != nil {
+			return errors.Wrap(err, "deleting verifications")
 		}
+
+		r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.CreateVerification",
+			"query", database.Log(q, hash, userID, expires, now.UTC()))
+
+		if _, err := tx.ExecContext(ctx, q, hash, userID, expires, now.UTC()); err != nil {
+			return errors.Wrap(err, "inserting verification")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
 	}
 
-	if err := bcrypt.CompareHashAndPassword(usr.PasswordHash, []byte(password)); err != nil {
-		return auth.Claims{}, ErrAuthenticationFailure
+	return token, nil
+}
+
+// CreatePasswordReset issues a token allowing the user to set a new password
+// without knowing the current one. The returned token isn't stored anywhere,
+// so it must be delivered to the user right away.
+func (r UserRepository) CreatePasswordReset(ctx context.Context, traceID string, userID string, now time.Time) (string, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return "", ErrInvalidID
+	}
+
+	token, hash, err := secret.New()
+	if err != nil {
+		return "", errors.Wrap(err, "generating reset token")
+	}
+
+	const q = `INSERT INTO password_resets
+		(token_hash, user_id, expires_at, date_created)
+		VALUES($1, $2, $3, $4)`
+
+	expires := now.Add(PasswordResetTTL).UTC()
+
+	r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.CreatePasswordReset",
+		"query", database.Log(q, hash, userID, expires, now.UTC()))
+
+	if _, err := r.db.ExecContext(ctx, q, hash, userID, expires, now.UTC()); err != nil {
+		return "", errors.Wrap(err, "inserting password reset")
 	}
 
-	claims := auth.Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    "service project",
-			Subject:   usr.ID,
-			Audience:  jwt.ClaimStrings{"students"},
-			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(now),
-		},
-		Roles: usr.Roles,
+	return token, nil
+}
+
+// ResetPassword sets a new password for the user the reset token was issued
+// for. The token can be used only once, every other outstanding reset token
+// of the user is discarded and all sessions issued before are revoked.
+func (r UserRepository) ResetPassword(ctx context.Context, traceID string, token string, password string, now time.Time) error {
+	hash, err := pwhash.Generate(password)
+	if err != nil {
+		return errors.Wrap(err, "generation password hash")
 	}
 
-	return claims, nil
+	const qd = `DELETE FROM password_resets WHERE token_hash=$1 RETURNING user_id, expires_at`
+	const qa = `DELETE FROM password_resets WHERE user_id=$1`
+	const qu = `UPDATE users SET
+		"password_hash"=$2,
+		"date_sessions_revoked"=$3,
+		"date_updated"=$3,
+		"version"=version+1
+		WHERE user_id=$1 AND date_deleted IS NULL
+		RETURNING email`
+
+	return database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.ResetPassword",
+			"query", database.Log(qd, database.Redact(token)))
+
+		var pr struct {
+			UserID    string    `db:"user_id"`
+			ExpiresAt time.Time `db:"expires_at"`
+		}
+		if err := tx.GetContext(ctx, &pr, qd, secret.Hash(token)); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrPasswordResetNotFound
+			}
+			return errors.Wrap(err, "deleting password reset")
+		}
+
+		if now.After(pr.ExpiresAt) {
+			return ErrPasswordResetExpired
+		}
+
+		r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.ResetPassword",
+			"query", database.Log(qa, pr.UserID))
+
+		if _, err := tx.ExecContext(ctx, qa, pr.UserID); err != nil {
+			return errors.Wrap(err, "deleting password resets")
+		}
+
+		r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.ResetPassword",
+			"query", database.Log(qu, pr.UserID, hash, now.UTC()))
+
+		var email string
+		if err := tx.GetContext(ctx, &email, qu, pr.UserID, hash, now.UTC()); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return errors.Wrapf(err, "updating password of user %q", pr.UserID)
+		}
+
+		// The email is only known now, rolling back keeps the token usable.
+		if err := validate.CheckPassword(password, email); err != nil {
+			return err
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionUpdate,
+			Entity:   Entity,
+			EntityID: pr.UserID,
+			After: map[string]interface{}{
+				"password_reset":        true,
+				"date_sessions_revoked": now.UTC(),
+			},
+		}, now)
+	})
+}
+
+// UpdatePasswordHash replaces the stored hash of the user's password, e.g.
+// when it's upgraded to the configured algorithm on login. It doesn't revoke
+// any sessions since the password itself is unchanged.
+func (r UserRepository) UpdatePasswordHash(ctx context.Context, traceID string, userID string, hash []byte, now time.Time) error {
+	if _, err := uuid.Parse(userID); err != nil {
+		return ErrInvalidID
+	}
+
+	const q = `UPDATE users SET
+		"password_hash"=$2,
+		"date_updated"=$3,
+		"version"=version+1
+		WHERE user_id=$1 AND date_deleted IS NULL`
+
+	r.log.Debug("query", "trace_id", traceID, "op", "UserRepository.UpdatePasswordHash",
+		"query", database.Log(q, userID, hash, now.UTC()))
+
+	if _, err := r.db.ExecContext(ctx, q, userID, hash, now.UTC()); err != nil {
+		return errors.Wrapf(err, "updating password hash of user %q", userID)
+	}
+
+	return nil
 }
@@ -5,7 +5,10 @@ import (
 	"time"
 
 	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/dbschema"
+	"github.com/egorovdmi/financify/business/data/scope"
 	"github.com/egorovdmi/financify/business/data/user"
+	"github.com/egorovdmi/financify/business/data/wallet"
 	"github.com/egorovdmi/financify/business/tests"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/go-cmp/cmp"
@@ -78,11 +81,16 @@ func TestUser(t *testing.T) {
 				Roles: []string{auth.RoleAdmin},
 			}
 
-			if err := ur.Update(ctx, traceID, claims, usr.ID, upd, now); err != nil {
+			if err := ur.Update(ctx, traceID, claims, usr.ID, upd, usr.ETag(), now); err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to update user: %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to update user.", tests.Success, testID)
 
+			if err := ur.Update(ctx, traceID, claims, usr.ID, upd, usr.ETag(), now); err != user.ErrVersionMismatch {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to update a stale version of the user: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to update a stale version of the user.", tests.Success, testID)
+
 			saved, err = ur.QueryByEmail(ctx, traceID, claims, "anna@example.com")
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve user by email: %s.", tests.Failed, testID, err)
@@ -105,7 +113,39 @@ func TestUser(t *testing.T) {
 				t.Logf("\t%s\tTest %d:\tShould be able to see updates to Email.", tests.Success, testID)
 			}
 
-			if err := ur.Delete(ctx, traceID, usr.ID); err != nil {
+			if saved.Verified {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT keep a changed email verified.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT keep a changed email verified.", tests.Success, testID)
+
+			self := auth.Claims{
+				RegisteredClaims: jwt.RegisteredClaims{Subject: usr.ID},
+				Roles:            []string{auth.RoleUser},
+			}
+			pwd := user.UpdateUser{
+				Password:        tests.StringPointer("gophers-reunite"),
+				PasswordConfirm: tests.StringPointer("gophers-reunite"),
+			}
+			if err := ur.Update(ctx, traceID, self, usr.ID, pwd, "", now); err != user.ErrWrongPassword {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT change the password without the current one: %v.", tests.Failed, testID, err)
+			}
+			pwd.CurrentPassword = tests.StringPointer("wrong")
+			if err := ur.Update(ctx, traceID, self, usr.ID, pwd, "", now); err != user.ErrWrongPassword {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT change the password with a wrong current one: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT change the password without the current one.", tests.Success, testID)
+
+			pwd.CurrentPassword = tests.StringPointer("gophers")
+			if err := ur.Update(ctx, traceID, self, usr.ID, pwd, "", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to change the password: %s.", tests.Failed, testID, err)
+			}
+			saved, err = ur.LookupByID(ctx, traceID, usr.ID)
+			if err != nil || saved.SessionsRevoked == nil || !saved.SessionsRevoked.Equal(now) {
+				t.Fatalf("\t%s\tTest %d:\tShould revoke the sessions of the user : got %v, %v.", tests.Failed, testID, saved.SessionsRevoked, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to change the password and revoke the sessions.", tests.Success, testID)
+
+			if err := ur.Delete(ctx, traceID, claims, usr.ID, "", now); err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to delete user: %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to delete user.", tests.Success, testID)
@@ -115,6 +155,120 @@ func TestUser(t *testing.T) {
 				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to retrieve user: %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould NOT be able to retrieve user.", tests.Success, testID)
+
+			if _, err := ur.Restore(ctx, traceID, usr.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to restore user: %s.", tests.Failed, testID, err)
+			}
+			if _, err := ur.QueryByID(ctx, traceID, claims, usr.ID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the restored user: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve the restored user.", tests.Success, testID)
+
+			if err := ur.Delete(ctx, traceID, claims, usr.ID, "", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to delete user: %s.", tests.Failed, testID, err)
+			}
+
+			n, err := ur.Purge(ctx, traceID, now, now)
+			if err != nil || n != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT purge users deleted after the cutoff : got %d, %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT purge users deleted after the cutoff.", tests.Success, testID)
+
+			n, err = ur.Purge(ctx, traceID, now.Add(time.Second), now)
+			if err != nil || n != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould purge users deleted before the cutoff : got %d, %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould purge users deleted before the cutoff.", tests.Success, testID)
+
+			if _, err := ur.Restore(ctx, traceID, usr.ID, now); err != user.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to restore a purged user: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to restore a purged user.", tests.Success, testID)
+		}
+	}
+}
+
+func TestPurgeSharedScope(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	ctx := tests.Context()
+	if err := dbschema.Seed(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	ur := user.NewUserRepository(log, db)
+	sr := scope.NewScopeRepository(log, db)
+	wr := wallet.NewWalletRepository(log, db)
+
+	ownerClaims := auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: tests.UserID},
+		Roles:            []string{auth.RoleUser},
+	}
+	memberClaims := auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: tests.AdminID},
+		Roles:            []string{auth.RoleUser},
+	}
+
+	t.Log("Given the need to purge a user sharing a Scope.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the creator of a shared Scope is purged.", testID)
+		{
+			now := time.Date(2022, time.October, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			s, err := sr.Create(ctx, traceID, ownerClaims, scope.NewScope{Title: "Household"}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a scope: %s.", tests.Failed, testID, err)
+			}
+			w, err := wr.Create(ctx, traceID, ownerClaims, s.ID, wallet.NewWallet{Title: "Groceries"}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a wallet: %s.", tests.Failed, testID, err)
+			}
+
+			invite := func(role string) {
+				_, token, err := sr.CreateInvitation(ctx, traceID, ownerClaims, s.ID, scope.NewInvitation{Email: "admin@example.com", Role: role}, now)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to invite a user: %s.", tests.Failed, testID, err)
+				}
+				if _, err := sr.AcceptInvitation(ctx, traceID, memberClaims, token, now); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to accept the invitation: %s.", tests.Failed, testID, err)
+				}
+			}
+
+			invite(scope.RoleViewer)
+
+			if err := ur.Delete(ctx, traceID, ownerClaims, tests.UserID, "", now); err != user.ErrLastOwner {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT delete the last owner of a shared scope: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT delete the last owner of a shared scope.", tests.Success, testID)
+
+			if err := sr.RemoveMember(ctx, traceID, s.ID, tests.AdminID, now); err != nil {
+				t.Fatal(err)
+			}
+			invite(scope.RoleOwner)
+
+			if err := ur.Delete(ctx, traceID, ownerClaims, tests.UserID, "", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould delete an owner once another one exists: %s.", tests.Failed, testID, err)
+			}
+
+			n, err := ur.Purge(ctx, traceID, now.Add(time.Second), now)
+			if err != nil || n != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould purge the user : got %d, %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould purge the user.", tests.Success, testID)
+
+			got, err := sr.QueryByID(ctx, traceID, memberClaims, s.ID)
+			if err != nil || got.UserID != tests.AdminID {
+				t.Fatalf("\t%s\tTest %d:\tShould hand the scope over to the remaining owner : got %q, %v.", tests.Failed, testID, got.UserID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould hand the scope over to the remaining owner.", tests.Success, testID)
+
+			if _, err := wr.QueryByID(ctx, traceID, memberClaims, w.ID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the wallets of the scope: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the wallets of the scope.", tests.Success, testID)
 		}
 	}
 }
@@ -0,0 +1,39 @@
+package wallet
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/egorovdmi/financify/business/sys/money"
+)
+
+// Wallet represents a source of money, like cash or a bank account, inside
+// a Scope.
+type Wallet struct {
+	ID          string       `db:"wallet_id" json:"id"`
+	ScopeID     string       `db:"scope_id" json:"scope_id"`
+	UserID      string       `db:"user_id" json:"user_id"`
+	Title       string       `db:"title" json:"title"`
+	Amount      money.Amount `db:"amount" json:"amount"`
+	DateCreated time.Time    `db:"date_created" json:"date_created"`
+	DateUpdated time.Time    `db:"date_updated" json:"date_updated"`
+	DateDeleted *time.Time   `db:"date_deleted" json:"date_deleted,omitempty"`
+	Version     int          `db:"version" json:"-"`
+}
+
+// ETag identifies the version of the wallet. It changes with every update.
+func (w Wallet) ETag() string {
+	return strconv.Itoa(w.Version)
+}
+
+// NewWallet contains information needed to create a new Wallet.
+type NewWallet struct {
+	Title string `json:"title" validate:"required"`
+}
+
+// UpdateWallet defines what information may be provided to modify an existing
+// Wallet. All fields are optional so clients can send just the fields they
+// want changed.
+type UpdateWallet struct {
+	Title *string `json:"title" validate:"omitempty,min=1"`
+}
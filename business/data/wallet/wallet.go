@@ -0,0 +1,335 @@
+// Package wallet contains the storage of wallets kept inside scopes.
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/audit"
+	"github.com/egorovdmi/financify/foundation/database"
+	"github.com/egorovdmi/financify/foundation/logger"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Set of error variables for CRUD operations.
+var (
+	ErrNotFound        = errors.New("wallet not found")
+	ErrInvalidID       = errors.New("ID is not in its proper form")
+	ErrScopeNotFound   = errors.New("scope not found")
+	ErrVersionMismatch = errors.New("wallet was modified by another request")
+)
+
+// Entity names wallets in the audit log.
+const Entity = "wallet"
+
+type WalletRepository struct {
+	log *logger.Logger
+	db  *sqlx.DB
+}
+
+func NewWalletRepository(log *logger.Logger, db *sqlx.DB) WalletRepository {
+	return WalletRepository{
+		log: log,
+		db:  db,
+	}
+}
+
+// Create adds a new wallet to the scope. Access to the scope must be checked
+// by the caller.
+func (r WalletRepository) Create(ctx context.Context, traceID string, claims auth.Claims, scopeID string, nw NewWallet, now time.Time) (Wallet, error) {
+	if _, err := uuid.Parse(scopeID); err != nil {
+		return Wallet{}, ErrInvalidID
+	}
+
+	w := Wallet{
+		ID:          uuid.New().String(),
+		ScopeID:     scopeID,
+		UserID:      claims.Subject,
+		Title:       nw.Title,
+		DateCreated: now.UTC(),
+		DateUpdated: now.UTC(),
+		Version:     1,
+	}
+
+	// A deleted scope can't get new wallets.
+	const q = `INSERT INTO wallets
+		(wallet_id, scope_id, user_id, title, amount, date_created, date_updated)
+		SELECT $1, $2, $3, $4, $5, $6, $7
+		WHERE EXISTS (SELECT 1 FROM scopes WHERE scope_id=$2 AND date_deleted IS NULL)`
+
+	err := database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "WalletRepository.Create",
+			"query", database.Log(q, w.ID, w.ScopeID, w.UserID, w.Title, w.Amount, w.DateCreated, w.DateUpdated))
+
+		res, err := tx.ExecContext(ctx, q, w.ID, w.ScopeID, w.UserID, w.Title, w.Amount, w.DateCreated, w.DateUpdated)
+		if err != nil {
+			return errors.Wrap(err, "inserting wallet")
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrScopeNotFound
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionCreate,
+			Entity:   Entity,
+			EntityID: w.ID,
+			After:    w,
+		}, now)
+	})
+	if err != nil {
+		return Wallet{}, err
+	}
+
+	return w, nil
+}
+
+// Update modifies the wallet of the scope. Access to the scope must be checked
+// by the caller. A non-empty etag must match the current version of the
+// wallet, otherwise ErrVersionMismatch is returned.
+func (r WalletRepository) Update(ctx context.Context, traceID string, scopeID string, walletID string, uw UpdateWallet, etag string, now time.Time) error {
+	if _, err := uuid.Parse(scopeID); err != nil {
+		return ErrInvalidID
+	}
+	if _, err := uuid.Parse(walletID); err != nil {
+		return ErrInvalidID
+	}
+
+	const qs = `SELECT * FROM wallets WHERE wallet_id=$1 AND scope_id=$2 AND date_deleted IS NULL FOR UPDATE`
+	const q = `UPDATE wallets SET
+		"title"=$2,
+		"date_updated"=$3,
+		"version"=version+1
+		WHERE wallet_id=$1`
+
+	return database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "WalletRepository.Update",
+			"query", database.Log(qs, walletID, scopeID))
+
+		var w Wallet
+		if err := tx.GetContext(ctx, &w, qs, walletID, scopeID); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return errors.Wrapf(err, "selecting wallet %q", walletID)
+		}
+
+		if etag != "" && etag != w.ETag() {
+			return ErrVersionMismatch
+		}
+
+		before := w
+
+		if uw.Title != nil {
+			w.Title = *uw.Title
+		}
+		w.DateUpdated = now.UTC()
+		w.Version++
+
+		r.log.Debug("query", "trace_id", traceID, "op", "WalletRepository.Update",
+			"query", database.Log(q, w.ID, w.Title, w.DateUpdated))
+
+		if _, err := tx.ExecContext(ctx, q, w.ID, w.Title, w.DateUpdated); err != nil {
+			return errors.Wrapf(err, "updating wallet %q", walletID)
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionUpdate,
+			Entity:   Entity,
+			EntityID: w.ID,
+			Before:   before,
+			After:    w,
+		}, now)
+	})
+}
+
+// Delete hides the wallet of the scope until it's restored or purged. Access
+// to the scope must be checked by the caller. A non-empty etag must match the
+// current version of the wallet, otherwise ErrVersionMismatch is returned.
+func (r WalletRepository) Delete(ctx context.Context, traceID string, scopeID string, walletID string, etag string, now time.Time) error {
+	if _, err := uuid.Parse(scopeID); err != nil {
+		return ErrInvalidID
+	}
+	if _, err := uuid.Parse(walletID); err != nil {
+		return ErrInvalidID
+	}
+
+	const qs = `SELECT * FROM wallets WHERE wallet_id=$1 AND scope_id=$2 AND date_deleted IS NULL FOR UPDATE`
+	const q = `UPDATE wallets SET
+		"date_deleted"=$2,
+		"version"=version+1
+		WHERE wallet_id=$1`
+
+	return database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "WalletRepository.Delete",
+			"query", database.Log(qs, walletID, scopeID))
+
+		var w Wallet
+		if err := tx.GetContext(ctx, &w, qs, walletID, scopeID); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return errors.Wrapf(err, "selecting wallet %q", walletID)
+		}
+
+		if etag != "" && etag != w.ETag() {
+			return ErrVersionMismatch
+		}
+
+		r.log.Debug("query", "trace_id", traceID, "op", "WalletRepository.Delete",
+			"query", database.Log(q, walletID, now.UTC()))
+
+		if _, err := tx.ExecContext(ctx, q, walletID, now.UTC()); err != nil {
+			return errors.Wrapf(err, "deleting wallet %q", walletID)
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionDelete,
+			Entity:   Entity,
+			EntityID: w.ID,
+			Before:   w,
+		}, now)
+	})
+}
+
+// Restore brings back a deleted wallet that wasn't purged yet. It's meant for
+// admins and performs no authorization checks.
+func (r WalletRepository) Restore(ctx context.Context, traceID string, walletID string, now time.Time) (Wallet, error) {
+	if _, err := uuid.Parse(walletID); err != nil {
+		return Wallet{}, ErrInvalidID
+	}
+
+	const q = `UPDATE wallets SET
+		"date_deleted"=NULL,
+		"date_updated"=$2,
+		"version"=version+1
+		WHERE wallet_id=$1 AND date_deleted IS NOT NULL
+		RETURNING *`
+
+	var w Wallet
+	err := database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "WalletRepository.Restore",
+			"query", database.Log(q, walletID, now.UTC()))
+
+		if err := tx.GetContext(ctx, &w, q, walletID, now.UTC()); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return errors.Wrapf(err, "restoring wallet %q", walletID)
+		}
+
+		return audit.Record(ctx, tx, r.log, traceID, audit.NewEvent{
+			Action:   audit.ActionRestore,
+			Entity:   Entity,
+			EntityID: w.ID,
+			After:    w,
+		}, now)
+	})
+	if err != nil {
+		return Wallet{}, err
+	}
+
+	return w, nil
+}
+
+// Purge permanently removes the wallets deleted before the specified time
+// together with their payments and returns how many were removed.
+func (r WalletRepository) Purge(ctx context.Context, traceID string, before time.Time, now time.Time) (int, error) {
+	const q = `DELETE FROM wallets WHERE date_deleted < $1 RETURNING wallet_id`
+
+	var ids []string
+	err := database.WithinTran(ctx, r.db, func(tx *sqlx.Tx) error {
+		r.log.Debug("query", "trace_id", traceID, "op", "WalletRepository.Purge",
+			"query", database.Log(q, before.UTC()))
+
+		if err := tx.SelectContext(ctx, &ids, q, before.UTC()); err != nil {
+			return errors.Wrap(err, "purging wallets")
+		}
+
+		for _, id := range ids {
+			ne := audit.NewEvent{
+				Action:   audit.ActionPurge,
+				Entity:   Entity,
+				EntityID: id,
+			}
+			if err := audit.Record(ctx, tx, r.log, traceID, ne, now); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
+}
+
+// QueryByScope retrieves the wallets of the scope if the calling user is one
+// of its members or an admin.
+func (r WalletRepository) QueryByScope(ctx context.Context, traceID string, claims auth.Claims, scopeID string) ([]Wallet, error) {
+	if _, err := uuid.Parse(scopeID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	const q = `SELECT w.* FROM wallets w
+		JOIN scopes s ON s.scope_id=w.scope_id
+		WHERE w.scope_id=$1 AND w.date_deleted IS NULL AND s.date_deleted IS NULL
+		AND ($2 OR EXISTS (SELECT 1 FROM scope_members m WHERE m.scope_id=w.scope_id AND m.user_id=$3))
+		ORDER BY w.date_created`
+
+	isAdmin := claims.Authorize(auth.RoleAdmin)
+	subject := subjectID(claims)
+
+	r.log.Debug("query", "trace_id", traceID, "op", "WalletRepository.QueryByScope",
+		"query", database.Log(q, scopeID, isAdmin, subject))
+
+	wallets := []Wallet{}
+	if err := r.db.SelectContext(ctx, &wallets, q, scopeID, isAdmin, subject); err != nil {
+		return nil, errors.Wrapf(err, "selecting wallets of scope %q", scopeID)
+	}
+
+	return wallets, nil
+}
+
+// QueryByID gets the specified wallet if the calling user is a member of its
+// scope or an admin.
+func (r WalletRepository) QueryByID(ctx context.Context, traceID string, claims auth.Claims, walletID string) (Wallet, error) {
+	if _, err := uuid.Parse(walletID); err != nil {
+		return Wallet{}, ErrInvalidID
+	}
+
+	const q = `SELECT w.* FROM wallets w
+		JOIN scopes s ON s.scope_id=w.scope_id
+		WHERE w.wallet_id=$1 AND w.date_deleted IS NULL AND s.date_deleted IS NULL
+		AND ($2 OR EXISTS (SELECT 1 FROM scope_members m WHERE m.scope_id=w.scope_id AND m.user_id=$3))`
+
+	isAdmin := claims.Authorize(auth.RoleAdmin)
+	subject := subjectID(claims)
+
+	r.log.Debug("query", "trace_id", traceID, "op", "WalletRepository.QueryByID",
+		"query", database.Log(q, walletID, isAdmin, subject))
+
+	var w Wallet
+	if err := r.db.GetContext(ctx, &w, q, walletID, isAdmin, subject); err != nil {
+		if err == sql.ErrNoRows {
+			return Wallet{}, ErrNotFound
+		}
+		return Wallet{}, errors.Wrapf(err, "selecting wallet %q", walletID)
+	}
+
+	return w, nil
+}
+
+// subjectID returns the user ID from the claims in a form that can always be
+// compared to a UUID column.
+func subjectID(claims auth.Claims) string {
+	if _, err := uuid.Parse(claims.Subject); err != nil {
+		return uuid.Nil.String()
+	}
+	return claims.Subject
+}
@@ -0,0 +1,120 @@
+package wallet_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/dbschema"
+	"github.com/egorovdmi/financify/business/data/wallet"
+	"github.com/egorovdmi/financify/business/tests"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWallet(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	ctx := tests.Context()
+	if err := dbschema.Seed(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	wr := wallet.NewWalletRepository(log, db)
+
+	const scopeID = "79ee821f-0a5b-4416-a77c-176cbfa14e4d"
+	memberClaims := auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: tests.UserID},
+		Roles:            []string{auth.RoleUser},
+	}
+	strangerClaims := auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: tests.AdminID},
+		Roles:            []string{auth.RoleUser},
+	}
+
+	t.Log("Given the need to work with Wallet records.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a single Wallet.", testID)
+		{
+			now := time.Date(2022, time.October, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			w, err := wr.Create(ctx, traceID, memberClaims, scopeID, wallet.NewWallet{Title: "Card"}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a wallet: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create a wallet.", tests.Success, testID)
+
+			saved, err := wr.QueryByID(ctx, traceID, memberClaims, w.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the wallet by ID: %s.", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff(w, saved); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the same wallet. Diff:\n%s.", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the same wallet.", tests.Success, testID)
+
+			if _, err := wr.QueryByID(ctx, traceID, strangerClaims, w.ID); err != wallet.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT see the wallet of a scope without membership: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT see the wallet of a scope without membership.", tests.Success, testID)
+
+			wallets, err := wr.QueryByScope(ctx, traceID, memberClaims, scopeID)
+			if err != nil || len(wallets) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould get the seeded and the created wallets: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the seeded and the created wallets.", tests.Success, testID)
+
+			wallets, err = wr.QueryByScope(ctx, traceID, strangerClaims, scopeID)
+			if err != nil || len(wallets) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould get no wallets without membership: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get no wallets without membership.", tests.Success, testID)
+
+			uw := wallet.UpdateWallet{Title: tests.StringPointer("Debit card")}
+			if err := wr.Update(ctx, traceID, scopeID, w.ID, uw, w.ETag(), now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to update the wallet: %s.", tests.Failed, testID, err)
+			}
+			if err := wr.Update(ctx, traceID, scopeID, w.ID, uw, w.ETag(), now); err != wallet.ErrVersionMismatch {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to update a stale version of the wallet: %v.", tests.Failed, testID, err)
+			}
+			if saved, err := wr.QueryByID(ctx, traceID, memberClaims, w.ID); err != nil || saved.Title != "Debit card" {
+				t.Fatalf("\t%s\tTest %d:\tShould see updates to Title : got %q, %v.", tests.Failed, testID, saved.Title, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to update the wallet.", tests.Success, testID)
+
+			if err := wr.Delete(ctx, traceID, scopeID, w.ID, "", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to delete the wallet: %s.", tests.Failed, testID, err)
+			}
+			if _, err := wr.QueryByID(ctx, traceID, memberClaims, w.ID); err != wallet.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT see the deleted wallet: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT see the deleted wallet.", tests.Success, testID)
+
+			if _, err := wr.Restore(ctx, traceID, w.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to restore the wallet: %s.", tests.Failed, testID, err)
+			}
+			if _, err := wr.QueryByID(ctx, traceID, memberClaims, w.ID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould see the restored wallet: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould see the restored wallet.", tests.Success, testID)
+
+			if err := wr.Delete(ctx, traceID, scopeID, w.ID, "", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to delete the wallet: %s.", tests.Failed, testID, err)
+			}
+			n, err := wr.Purge(ctx, traceID, now.Add(time.Second), now)
+			if err != nil || n != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould purge the deleted wallet : got %d, %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould purge the deleted wallet.", tests.Success, testID)
+
+			wallets, err = wr.QueryByScope(ctx, traceID, memberClaims, scopeID)
+			if err != nil || len(wallets) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the seeded wallet: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the seeded wallet.", tests.Success, testID)
+		}
+	}
+}
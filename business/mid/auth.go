@@ -6,6 +6,8 @@ import (
 	"strings"
 
 	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/core/session"
+	"github.com/egorovdmi/financify/business/data/grant"
 	"github.com/egorovdmi/financify/foundation/web"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/trace"
@@ -15,30 +17,59 @@ var ErrForbidden = web.NewRequestError(
 	errors.New("you are not authorized for that action"),
 	http.StatusForbidden)
 
-func Authenticate(a *auth.Auth) web.Middleware {
+// errAuthHeader is returned when the authorization header can't be parsed.
+var errAuthHeader = errors.New("expected authorization header format: Bearer <token> or ApiKey <key>")
+
+func Authenticate(sess session.Core) web.Middleware {
 	m := func(handler web.Handler) web.Handler {
 		h := func(ctx context.Context, rw http.ResponseWriter, r *http.Request) (err error) {
 			currentSpan := trace.SpanFromContext(ctx)
 			ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.mid.authenticate")
 			defer span.End()
 
+			v, ok := ctx.Value(web.KeyValues).(*web.Values)
+			if !ok {
+				return web.NewShutdownError("web value missing from context")
+			}
+
 			// Parse the authorization header.
-			// Expected: `Bearer <token>`.
+			// Expected: `Bearer <token>` or `ApiKey <key>`.
 			authHeaderValue := r.Header.Get("Authorization")
 			parts := strings.Split(authHeaderValue, " ")
-			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-				err := errors.New("expected authorization header format: Bearer <token>")
-				return web.NewRequestError(err, http.StatusUnauthorized)
+			if len(parts) != 2 {
+				return web.NewRequestError(errAuthHeader, http.StatusUnauthorized)
 			}
 
-			// Validate the token is signed by us.
-			claims, err := a.ValidateToken(parts[1])
+			var claims auth.Claims
+			switch strings.ToLower(parts[0]) {
+			case "bearer":
+
+				// Validate the token is signed by us and the session is still active.
+				claims, err = sess.Validate(ctx, v.TraceID, parts[1])
+
+			case "apikey":
+
+				// Validate the key exists, matches and hasn't expired.
+				claims, err = sess.ValidateAPIKey(ctx, v.TraceID, parts[1], v.Now)
+
+			default:
+				return web.NewRequestError(errAuthHeader, http.StatusUnauthorized)
+			}
 			if err != nil {
-				return web.NewRequestError(err, http.StatusUnauthorized)
+
+				// Only failed credentials are the client's fault, anything else
+				// is an internal error that mustn't be reported to it.
+				switch errors.Cause(err) {
+				case session.ErrAuthenticationFailure, session.ErrSessionRevoked:
+					return web.NewRequestError(err, http.StatusUnauthorized)
+				default:
+					return errors.Wrap(err, "authenticating")
+				}
 			}
 
 			// Add claims to the context so they can be retrieved later.
 			ctx = context.WithValue(ctx, auth.Key, claims)
+			v.UserID = claims.Subject
 
 			return handler(ctx, rw, r)
 		}
@@ -74,3 +105,90 @@ func Authorize(roles ...string) web.Middleware {
 
 	return m
 }
+
+// DenyAPIKey rejects requests authenticated with an API key. It guards routes
+// managing the account itself, which keys must never reach regardless of
+// their permissions.
+func DenyAPIKey() web.Middleware {
+	m := func(handler web.Handler) web.Handler {
+		h := func(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+			claims, ok := ctx.Value(auth.Key).(auth.Claims)
+			if !ok {
+				return errors.New("missing claims in the context: DenyAPIKey called without/before Authenticate middleware")
+			}
+
+			if claims.APIKey {
+				return ErrForbidden
+			}
+
+			return handler(ctx, rw, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// Require checks that the authenticated user may perform the action described
+// by the permission on the resource identified by the route parameter. The
+// roles in the token must carry the permission and, unless the user is an
+// admin, a grant for that resource must exist.
+func Require(gr grant.GrantRepository, perm auth.Permission, resourceParam string) web.Middleware {
+	resource := func(ctx context.Context, r *http.Request) (string, error) {
+		return web.Param(r, resourceParam), nil
+	}
+
+	return RequireFunc(gr, perm, resource)
+}
+
+// RequireFunc works like Require for routes that don't carry the ID of the
+// resource holding the grants, like a scope, but of something inside it. The
+// resource function finds the ID, an error it returns is returned as is.
+func RequireFunc(gr grant.GrantRepository, perm auth.Permission, resource func(ctx context.Context, r *http.Request) (string, error)) web.Middleware {
+	m := func(handler web.Handler) web.Handler {
+		h := func(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+			currentSpan := trace.SpanFromContext(ctx)
+			ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.mid.require")
+			defer span.End()
+
+			v, ok := ctx.Value(web.KeyValues).(*web.Values)
+			if !ok {
+				return web.NewShutdownError("web value missing from context")
+			}
+
+			claims, ok := ctx.Value(auth.Key).(auth.Claims)
+			if !ok {
+				return errors.New("missing claims in the context: Require called without/before Authenticate middleware")
+			}
+
+			if !claims.HasPermission(perm) {
+				return ErrForbidden
+			}
+
+			resourceID, err := resource(ctx, r)
+			if err != nil {
+				return err
+			}
+
+			if !claims.Authorize(auth.RoleAdmin) {
+				exists, err := gr.Exists(ctx, v.TraceID, claims.Subject, resourceID, perm)
+				if err != nil {
+					if err == grant.ErrInvalidID {
+						return web.NewRequestError(err, http.StatusBadRequest)
+					}
+					return errors.Wrapf(err, "checking grant %s on %s", perm, resourceID)
+				}
+				if !exists {
+					return ErrForbidden
+				}
+			}
+
+			return handler(ctx, rw, r)
+		}
+
+		return h
+	}
+
+	return m
+}
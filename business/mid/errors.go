@@ -2,14 +2,20 @@ package mid
 
 import (
 	"context"
-	"log"
 	"net/http"
 
+	"github.com/egorovdmi/financify/business/sys/validate"
+	"github.com/egorovdmi/financify/foundation/logger"
 	"github.com/egorovdmi/financify/foundation/web"
+	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/trace"
 )
 
-func Errors(log *log.Logger) web.Middleware {
+// ErrValidation is the error of requests failing validation. The offending
+// fields are sent along with it.
+var ErrValidation = errors.New("data validation error")
+
+func Errors(log *logger.Logger) web.Middleware {
 	m := func(handler web.Handler) web.Handler {
 		h := func(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
 			currentSpan := trace.SpanFromContext(ctx)
@@ -24,9 +30,24 @@ func Errors(log *log.Logger) web.Middleware {
 
 			// execute core handler
 			if err := handler(ctx, rw, r); err != nil {
-				log.Printf("%s : ERROR     : %v", v.TraceID, err)
+				// The response was already started, there is nothing left to
+				// tell the client.
+				if web.IsWriteError(err) {
+					log.Warn("response not sent", "trace_id", v.TraceID, "request_id", v.RequestID, "error", err)
+					return err
+				}
+
+				log.Error("request failed", "trace_id", v.TraceID, "request_id", v.RequestID, "user_id", v.UserID, "error", err)
+
+				// Validation failures are client errors carrying the offending fields.
+				if validate.IsFieldErrors(err) {
+					err = newFieldsError(validate.GetFieldErrors(err))
+				}
 
 				if err := web.RespondError(ctx, rw, err); err != nil {
+					if web.IsWriteError(err) {
+						log.Warn("response not sent", "trace_id", v.TraceID, "request_id", v.RequestID, "error", err)
+					}
 					return err
 				}
 
@@ -43,3 +64,17 @@ func Errors(log *log.Logger) web.Middleware {
 
 	return m
 }
+
+// newFieldsError converts validation failures into a request error.
+func newFieldsError(fe validate.FieldErrors) error {
+	fields := make([]web.FieldError, len(fe))
+	for i, f := range fe {
+		fields[i] = web.FieldError{Field: f.Field, Error: f.Error}
+	}
+
+	return &web.Error{
+		Err:    ErrValidation,
+		Status: http.StatusBadRequest,
+		Fields: fields,
+	}
+}
@@ -0,0 +1,191 @@
+package mid
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/data/idempotency"
+	"github.com/egorovdmi/financify/foundation/logger"
+	"github.com/egorovdmi/financify/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Set of errors returned for requests carrying an Idempotency-Key header.
+var (
+	errKeyReused = errors.New("idempotency key was already used for a different request")
+	errKeyInUse  = errors.New("a request with this idempotency key is still in progress")
+)
+
+// Idempotent lets clients retry a request by sending the same Idempotency-Key
+// header. The first request with a key is processed and its response is
+// recorded, retries get the recorded response replayed. Reusing a key for a
+// different request is rejected. Requests without the header are processed
+// as usual.
+//
+// A response the handler started is recorded even when sending it failed,
+// since the request was already processed and a retry must not process it
+// again. The key is released so the request can be retried when the handler
+// returned an error before responding, like a validation failure, or responded
+// with a status of 500 or above.
+func Idempotent(log *logger.Logger, repo idempotency.IdempotencyRepository) web.Middleware {
+	m := func(handler web.Handler) web.Handler {
+		h := func(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" {
+				return handler(ctx, rw, r)
+			}
+
+			currentSpan := trace.SpanFromContext(ctx)
+			ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.mid.idempotent")
+			defer span.End()
+
+			v, ok := ctx.Value(web.KeyValues).(*web.Values)
+			if !ok {
+				return web.NewShutdownError("web value missing from context")
+			}
+
+			claims, ok := ctx.Value(auth.Key).(auth.Claims)
+			if !ok {
+				return errors.New("missing claims in the context: Idempotent called without/before Authenticate middleware")
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				return errors.Wrap(err, "reading request body")
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			hash := requestHash(r, body)
+
+			k, reserved, err := repo.Reserve(ctx, v.TraceID, claims.Subject, key, hash, v.Now)
+			if err != nil {
+				if err == idempotency.ErrInvalidKey {
+					return web.NewRequestError(err, http.StatusBadRequest)
+				}
+				return errors.Wrapf(err, "reserving idempotency key %q", key)
+			}
+
+			if !reserved {
+				switch {
+				case k.RequestHash != hash:
+					return web.NewRequestError(errKeyReused, http.StatusUnprocessableEntity)
+				case !k.Completed():
+					return web.NewRequestError(errKeyInUse, http.StatusConflict)
+				}
+				return replay(v, rw, k)
+			}
+
+			rec := recorder{ResponseWriter: rw}
+			err = handler(ctx, &rec, r)
+
+			// The outcome must be stored even when the client went away and
+			// canceled the request, or the key stays in progress until it
+			// expires.
+			sctx, cancel := context.WithTimeout(detach(ctx), storeTimeout)
+			defer cancel()
+
+			if rec.status == 0 || rec.status >= http.StatusInternalServerError {
+				if err := repo.Release(sctx, v.TraceID, claims.Subject, key); err != nil {
+					log.Error("releasing idempotency key", "trace_id", v.TraceID, "user_id", v.UserID, "error", err)
+				}
+				return err
+			}
+
+			// The response was already started so a failure to record it can
+			// only be logged. Retries get a conflict until the key expires.
+			if err := repo.Complete(sctx, v.TraceID, claims.Subject, key, rec.status, rw.Header(), rec.body.Bytes()); err != nil {
+				log.Error("recording idempotent response", "trace_id", v.TraceID, "user_id", v.UserID, "error", err)
+			}
+
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// storeTimeout bounds recording or releasing a key after the request.
+const storeTimeout = 5 * time.Second
+
+// detached carries the values of a context, like its span, without its
+// deadline and cancellation.
+type detached struct {
+	context.Context
+}
+
+// detach returns a context with the values of ctx that is never canceled.
+func detach(ctx context.Context) context.Context {
+	return detached{ctx}
+}
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+// requestHash identifies the request by its method, path and body.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// perRequestHeaders identify the original request and aren't replayed.
+var perRequestHeaders = map[string]bool{
+	web.RequestIDHeader: true,
+	"Traceparent":       true,
+	"Tracestate":        true,
+}
+
+// replay sends the recorded response of the key.
+func replay(v *web.Values, rw http.ResponseWriter, k idempotency.Key) error {
+	var header http.Header
+	if err := json.Unmarshal(k.Header, &header); err != nil {
+		return errors.Wrapf(err, "unmarshaling header of idempotency key %q", k.Key)
+	}
+	for name, values := range header {
+		if perRequestHeaders[name] {
+			continue
+		}
+		rw.Header()[name] = values
+	}
+	rw.Header().Set("Idempotent-Replayed", "true")
+
+	v.StatusCode = k.StatusCode
+	rw.WriteHeader(k.StatusCode)
+
+	if _, err := rw.Write(k.Body); err != nil {
+		return web.NewWriteError(err)
+	}
+
+	return nil
+}
+
+// recorder keeps a copy of the response written through it.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
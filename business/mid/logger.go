@@ -2,15 +2,15 @@ package mid
 
 import (
 	"context"
-	"log"
 	"net/http"
 	"time"
 
+	"github.com/egorovdmi/financify/foundation/logger"
 	"github.com/egorovdmi/financify/foundation/web"
 	"go.opentelemetry.io/otel/trace"
 )
 
-func Logger(log *log.Logger) web.Middleware {
+func Logger(log *logger.Logger) web.Middleware {
 	m := func(handler web.Handler) web.Handler {
 		h := func(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
 			currentSpan := trace.SpanFromContext(ctx)
@@ -23,14 +23,14 @@ func Logger(log *log.Logger) web.Middleware {
 				return web.NewShutdownError("missing KeyValues in the context")
 			}
 
-			log.Printf("%s : started   : %s %s -> %s", v.TraceID, r.Method, r.URL.Path,
-				r.RemoteAddr)
+			log.Info("request started", "trace_id", v.TraceID, "request_id", v.RequestID, "method", r.Method, "route", web.Route(r),
+				"path", r.URL.Path, "remote_addr", r.RemoteAddr)
 
 			// wrapped core handler
 			err := handler(ctx, rw, r)
 
-			log.Printf("%s : completed : %s %s -> %s (%d) (%s)", v.TraceID, r.Method, r.URL.Path,
-				r.RemoteAddr, v.StatusCode, time.Since(v.Now))
+			log.Info("request completed", "trace_id", v.TraceID, "request_id", v.RequestID, "user_id", v.UserID, "method", r.Method, "route", web.Route(r),
+				"path", r.URL.Path, "remote_addr", r.RemoteAddr, "status", v.StatusCode, "latency", time.Since(v.Now))
 
 			return err
 		}
@@ -5,7 +5,10 @@ import (
 	"expvar"
 	"net/http"
 	"runtime"
+	"strconv"
+	"time"
 
+	"github.com/egorovdmi/financify/foundation/metrics"
 	"github.com/egorovdmi/financify/foundation/web"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -14,12 +17,27 @@ var m = struct {
 	err *expvar.Int
 	req *expvar.Int
 	gr  *expvar.Int
+
+	requests *metrics.CounterVec
+	latency  *metrics.HistogramVec
 }{
 	err: expvar.NewInt("errors"),
 	req: expvar.NewInt("requests"),
 	gr:  expvar.NewInt("goroutines"),
+
+	requests: metrics.Default.NewCounterVec("http_requests_total",
+		"Number of handled requests.", "method", "route", "status"),
+	latency: metrics.Default.NewHistogramVec("http_request_duration_seconds",
+		"Latency of handled requests.", metrics.DefaultBuckets, "method", "route", "status"),
 }
 
+func init() {
+	metrics.Default.NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.",
+		func() float64 { return float64(runtime.NumGoroutine()) })
+}
+
+// Metrics counts requests and their latency by method, route template and
+// status. It must run outside of Errors to see the status of failed requests.
 func Metrics() web.Middleware {
 	m := func(handler web.Handler) web.Handler {
 		h := func(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
@@ -27,11 +45,29 @@ func Metrics() web.Middleware {
 			ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "business.mid.metrics")
 			defer span.End()
 
+			v, ok := ctx.Value(web.KeyValues).(*web.Values)
+			if !ok {
+				return web.NewShutdownError("missing KeyValues in the context")
+			}
+
+			start := time.Now()
 			err := handler(ctx, rw, r)
 
+			status := v.StatusCode
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+			route := web.Route(r)
+			if route == "" {
+				route = "unmatched"
+			}
+
+			m.requests.Inc(r.Method, route, strconv.Itoa(status))
+			m.latency.Observe(time.Since(start).Seconds(), r.Method, route, strconv.Itoa(status))
+
 			m.req.Add(1)
 
-			if err != nil {
+			if err != nil || status >= http.StatusBadRequest {
 				m.err.Add(1)
 			}
 
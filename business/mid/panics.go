@@ -2,16 +2,16 @@ package mid
 
 import (
 	"context"
-	"log"
 	"net/http"
 	"runtime/debug"
 
+	"github.com/egorovdmi/financify/foundation/logger"
 	"github.com/egorovdmi/financify/foundation/web"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/trace"
 )
 
-func Panics(log *log.Logger) web.Middleware {
+func Panics(log *logger.Logger) web.Middleware {
 	m := func(handler web.Handler) web.Handler {
 		h := func(ctx context.Context, rw http.ResponseWriter, r *http.Request) (err error) {
 			currentSpan := trace.SpanFromContext(ctx)
@@ -28,7 +28,7 @@ func Panics(log *log.Logger) web.Middleware {
 				if r := recover(); r != nil {
 					err = errors.Errorf("panic: %v", r)
 
-					log.Printf("%s : FATAL     : %s", v.TraceID, debug.Stack())
+					log.Error("panic", "trace_id", v.TraceID, "user_id", v.UserID, "error", r, "stack", string(debug.Stack()))
 				}
 			}()
 
@@ -0,0 +1,213 @@
+// Package lockout provides support for throttling repeated failures, like
+// wrong passwords, with an exponentially growing lockout period.
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Record is the failure history of a single key.
+type Record struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Store persists failure records. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	Get(ctx context.Context, key string) (Record, bool, error)
+
+	// Update replaces the record of the key with the one returned by fn,
+	// which gets the current record if there is one. Concurrent updates of a
+	// key must not get the same record, so no failure is lost.
+	Update(ctx context.Context, key string, fn func(rec Record, ok bool) Record) (Record, error)
+
+	Delete(ctx context.Context, key string) error
+}
+
+// Policy defines when and for how long a key is locked.
+type Policy struct {
+
+	// Threshold is the number of failures allowed before the first lockout.
+	Threshold int
+
+	// Delay is the first lockout period which doubles with every following
+	// failure up to MaxDelay.
+	Delay    time.Duration
+	MaxDelay time.Duration
+
+	// Window is the quiet period after which failures are forgotten.
+	Window time.Duration
+}
+
+// Limiter tracks failures per key according to its policy. A nil Limiter
+// never locks anything.
+type Limiter struct {
+	store  Store
+	policy Policy
+}
+
+// New constructs a Limiter using the store and policy.
+func New(store Store, policy Policy) *Limiter {
+	return &Limiter{
+		store:  store,
+		policy: policy,
+	}
+}
+
+// Wait returns how long the key remains locked, zero when it isn't.
+func (l *Limiter) Wait(ctx context.Context, key string, now time.Time) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+
+	rec, ok, err := l.store.Get(ctx, key)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	if now.Before(rec.LockedUntil) {
+		return rec.LockedUntil.Sub(now), nil
+	}
+
+	return 0, nil
+}
+
+// Fail records a failure for the key and returns how long it's locked for as
+// a consequence, zero when the threshold isn't reached yet.
+func (l *Limiter) Fail(ctx context.Context, key string, now time.Time) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+
+	rec, err := l.store.Update(ctx, key, func(rec Record, ok bool) Record {
+		if !ok || (l.policy.Window > 0 && now.Sub(rec.LastFailure) > l.policy.Window) {
+			rec = Record{}
+		}
+
+		rec.Failures++
+		rec.LastFailure = now
+
+		if wait := l.lockout(rec.Failures); wait > 0 {
+			rec.LockedUntil = now.Add(wait)
+		}
+
+		return rec
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return l.lockout(rec.Failures), nil
+}
+
+// lockout returns how long a key is locked for after the number of failures.
+func (l *Limiter) lockout(failures int) time.Duration {
+	over := failures - l.policy.Threshold
+	if over <= 0 {
+		return 0
+	}
+
+	wait := l.policy.Delay
+	for i := 1; i < over && wait < l.policy.MaxDelay; i++ {
+		wait *= 2
+	}
+	if l.policy.MaxDelay > 0 && wait > l.policy.MaxDelay {
+		wait = l.policy.MaxDelay
+	}
+
+	return wait
+}
+
+// Reset forgets all failures of the key, unlocking it.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	if l == nil {
+		return nil
+	}
+
+	return l.store.Delete(ctx, key)
+}
+
+// =============================================================================
+
+// MemoryStore keeps records in process memory. Records which haven't seen a
+// failure for the retention period are dropped by Sweep.
+type MemoryStore struct {
+	retention time.Duration
+
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+// NewMemoryStore constructs an empty in-memory store.
+func NewMemoryStore(retention time.Duration) *MemoryStore {
+	return &MemoryStore{
+		retention: retention,
+		records:   make(map[string]Record),
+	}
+}
+
+// Get returns the record of the key if there is one.
+func (s *MemoryStore) Get(ctx context.Context, key string) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[key]
+	return rec, ok, nil
+}
+
+// Update replaces the record of the key while holding the lock of the store.
+func (s *MemoryStore) Update(ctx context.Context, key string, fn func(rec Record, ok bool) Record) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[key]
+	rec = fn(rec, ok)
+	s.records[key] = rec
+
+	return rec, nil
+}
+
+// Delete removes the record of the key.
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
+
+// Sweep drops the records which haven't seen a failure for the retention
+// period and aren't locked anymore. It returns the number of records dropped.
+func (s *MemoryStore) Sweep(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+	for k, r := range s.records {
+		if now.Sub(r.LastFailure) > s.retention && now.After(r.LockedUntil) {
+			delete(s.records, k)
+			n++
+		}
+	}
+
+	return n
+}
+
+// Run sweeps on every tick of the interval until the context is canceled.
+func (s *MemoryStore) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.Sweep(now)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package lockout_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/egorovdmi/financify/business/sys/lockout"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestLockout(t *testing.T) {
+	ctx := context.Background()
+	policy := lockout.Policy{
+		Threshold: 3,
+		Delay:     time.Second,
+		MaxDelay:  4 * time.Second,
+		Window:    time.Hour,
+	}
+
+	t.Log("Given the need to lock keys after repeated failures.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen failing again and again.", testID)
+		{
+			l := lockout.New(lockout.NewMemoryStore(time.Hour), policy)
+			now := time.Date(2022, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			want := []time.Duration{0, 0, 0, time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}
+			for i, exp := range want {
+				got, err := l.Fail(ctx, "key", now)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to record a failure: %v", failed, testID, err)
+				}
+				if got != exp {
+					t.Fatalf("\t%s\tTest %d:\tShould lock for %v after %d failures : got %v.", failed, testID, exp, i+1, got)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould back off exponentially up to the maximum.", success, testID)
+
+			wait, err := l.Wait(ctx, "key", now.Add(time.Second))
+			if err != nil || wait != 3*time.Second {
+				t.Fatalf("\t%s\tTest %d:\tShould report the remaining lockout : got %v, %v.", failed, testID, wait, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould report the remaining lockout.", success, testID)
+
+			if wait, _ := l.Wait(ctx, "other", now); wait != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT lock other keys : got %v.", failed, testID, wait)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT lock other keys.", success, testID)
+
+			if err := l.Reset(ctx, "key"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reset the key: %v", failed, testID, err)
+			}
+			if wait, _ := l.Wait(ctx, "key", now); wait != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould unlock the key on reset : got %v.", failed, testID, wait)
+			}
+			t.Logf("\t%s\tTest %d:\tShould unlock the key on reset.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen failing after a quiet period.", testID)
+		{
+			l := lockout.New(lockout.NewMemoryStore(time.Hour), policy)
+			now := time.Date(2022, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			for i := 0; i < policy.Threshold; i++ {
+				l.Fail(ctx, "key", now)
+			}
+
+			wait, err := l.Fail(ctx, "key", now.Add(2*policy.Window))
+			if err != nil || wait != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould forget failures outside the window : got %v, %v.", failed, testID, wait, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould forget failures outside the window.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen using a nil limiter.", testID)
+		{
+			var l *lockout.Limiter
+			if wait, err := l.Fail(ctx, "key", time.Now()); err != nil || wait != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould never lock : got %v, %v.", failed, testID, wait, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould never lock.", success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen failing concurrently.", testID)
+		{
+			store := lockout.NewMemoryStore(time.Hour)
+			l := lockout.New(store, policy)
+			now := time.Date(2022, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			const n = 100
+			var wg sync.WaitGroup
+			wg.Add(n)
+			for i := 0; i < n; i++ {
+				go func() {
+					defer wg.Done()
+					l.Fail(ctx, "key", now)
+				}()
+			}
+			wg.Wait()
+
+			rec, _, _ := store.Get(ctx, "key")
+			if rec.Failures != n {
+				t.Fatalf("\t%s\tTest %d:\tShould count every failure : got %d want %d.", failed, testID, rec.Failures, n)
+			}
+			t.Logf("\t%s\tTest %d:\tShould count every failure.", success, testID)
+		}
+
+		testID = 4
+		t.Logf("\tTest %d:\tWhen sweeping stale records.", testID)
+		{
+			store := lockout.NewMemoryStore(time.Hour)
+			l := lockout.New(store, policy)
+			now := time.Date(2022, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			l.Fail(ctx, "old", now)
+			l.Fail(ctx, "new", now.Add(90*time.Minute))
+
+			if n := store.Sweep(now.Add(2 * time.Hour)); n != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould drop the stale record only : got %d.", failed, testID, n)
+			}
+			if _, ok, _ := store.Get(ctx, "new"); !ok {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the recent record.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould drop the stale record only.", success, testID)
+		}
+	}
+}
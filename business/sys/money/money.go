@@ -0,0 +1,108 @@
+// Package money provides support for exact amounts of money, which are kept
+// in cents rather than in binary floating point.
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalid is returned for amounts which aren't numbers with at most two
+// decimal places or don't fit the NUMERIC(14,2) columns storing them.
+var ErrInvalid = errors.New("amount must be a number with at most two decimal places")
+
+// Max is the largest amount, in cents, the database can store.
+const Max Amount = 99999999999999
+
+// Amount is an amount of money in cents. It's stored as NUMERIC and encoded
+// in JSON as a number with two decimal places, e.g. 12.5 is 1250 cents.
+type Amount int64
+
+// Parse converts a decimal number like -12.50 into an Amount.
+func Parse(s string) (Amount, error) {
+	neg := strings.HasPrefix(s, "-")
+	if neg {
+		s = s[1:]
+	}
+
+	units, cents, found := strings.Cut(s, ".")
+	if units == "" || len(cents) > 2 || (found && cents == "") {
+		return 0, ErrInvalid
+	}
+	cents += strings.Repeat("0", 2-len(cents))
+
+	for _, r := range units + cents {
+		if r < '0' || r > '9' {
+			return 0, ErrInvalid
+		}
+	}
+
+	n, err := strconv.ParseInt(units+cents, 10, 64)
+	if err != nil || Amount(n) > Max {
+		return 0, ErrInvalid
+	}
+
+	if neg {
+		n = -n
+	}
+	return Amount(n), nil
+}
+
+// String returns the amount as a decimal number with two decimal places.
+func (a Amount) String() string {
+	sign := ""
+	if a < 0 {
+		sign, a = "-", -a
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, a/100, a%100)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	n, err := Parse(string(data))
+	if err != nil {
+		return err
+	}
+	*a = n
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (a *Amount) Scan(src any) error {
+	var s string
+	switch v := src.(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		*a = Amount(v * 100)
+		return nil
+	case nil:
+		*a = 0
+		return nil
+	default:
+		return errors.Errorf("scanning %T into an amount", src)
+	}
+
+	n, err := Parse(s)
+	if err != nil {
+		return errors.Wrapf(err, "scanning %q", s)
+	}
+	*a = n
+	return nil
+}
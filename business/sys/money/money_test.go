@@ -0,0 +1,130 @@
+package money_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/egorovdmi/financify/business/sys/money"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestParse(t *testing.T) {
+	t.Log("Given the need to keep amounts of money exact.")
+	{
+		valid := []struct {
+			in   string
+			want money.Amount
+			out  string
+		}{
+			{"0", 0, "0.00"},
+			{"12", 1200, "12.00"},
+			{"12.5", 1250, "12.50"},
+			{"-2.05", -205, "-2.05"},
+			{"0.10", 10, "0.10"},
+			{"999999999999.99", money.Max, "999999999999.99"},
+		}
+
+		for testID, tt := range valid {
+			t.Logf("\tTest %d:\tWhen parsing %q.", testID, tt.in)
+			{
+				got, err := money.Parse(tt.in)
+				if err != nil || got != tt.want {
+					t.Fatalf("\t%s\tTest %d:\tShould get the amount in cents : got %d, %v want %d.", failed, testID, got, err, tt.want)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get the amount in cents.", success, testID)
+
+				if got.String() != tt.out {
+					t.Fatalf("\t%s\tTest %d:\tShould print two decimal places : got %q want %q.", failed, testID, got, tt.out)
+				}
+				t.Logf("\t%s\tTest %d:\tShould print two decimal places.", success, testID)
+			}
+		}
+
+		invalid := []string{"", "-", ".5", "1.", "1.005", "1e2", "1,5", "abc", "1000000000000.00"}
+
+		for i, in := range invalid {
+			testID := len(valid) + i
+			t.Logf("\tTest %d:\tWhen parsing %q.", testID, in)
+			{
+				if _, err := money.Parse(in); err != money.ErrInvalid {
+					t.Fatalf("\t%s\tTest %d:\tShould reject the amount : got %v.", failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould reject the amount.", success, testID)
+			}
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	t.Log("Given the need to exchange amounts of money as JSON numbers.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen decoding and encoding an amount.", testID)
+		{
+			var v struct {
+				Amount money.Amount `json:"amount"`
+			}
+			if err := json.Unmarshal([]byte(`{"amount": 0.1}`), &v); err != nil || v.Amount != 10 {
+				t.Fatalf("\t%s\tTest %d:\tShould decode a number : got %d, %v.", failed, testID, v.Amount, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould decode a number.", success, testID)
+
+			v.Amount += 20
+			data, err := json.Marshal(v)
+			if err != nil || string(data) != `{"amount":0.30}` {
+				t.Fatalf("\t%s\tTest %d:\tShould encode the exact sum : got %s, %v.", failed, testID, data, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould encode the exact sum.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen decoding an amount with fractions of a cent.", testID)
+		{
+			var v struct {
+				Amount money.Amount `json:"amount"`
+			}
+			if err := json.Unmarshal([]byte(`{"amount": 0.001}`), &v); err != money.ErrInvalid {
+				t.Fatalf("\t%s\tTest %d:\tShould reject the amount : got %v.", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject the amount.", success, testID)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	t.Log("Given the need to read amounts of money from NUMERIC columns.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen scanning the values a driver returns.", testID)
+		{
+			srcs := []struct {
+				src  any
+				want money.Amount
+			}{
+				{[]byte("-97.50"), -9750},
+				{"3.05", 305},
+				{int64(7), 700},
+				{nil, 0},
+			}
+
+			for _, tt := range srcs {
+				var a money.Amount
+				if err := a.Scan(tt.src); err != nil || a != tt.want {
+					t.Fatalf("\t%s\tTest %d:\tShould scan %v : got %d, %v want %d.", failed, testID, tt.src, a, err, tt.want)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould scan every value.", success, testID)
+
+			var a money.Amount
+			if err := a.Scan(1.5); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT scan a float.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT scan a float.", success, testID)
+		}
+	}
+}
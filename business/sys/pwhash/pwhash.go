@@ -0,0 +1,190 @@
+// Package pwhash provides support for hashing user passwords with bcrypt or
+// argon2id and detecting hashes that should be upgraded.
+package pwhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Set of supported hashing algorithms.
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+)
+
+// ErrMismatch is returned when the password doesn't match the hash.
+var ErrMismatch = errors.New("password does not match")
+
+// Config defines how new hashes are generated. Existing hashes using another
+// algorithm or weaker parameters are reported by NeedsRehash.
+type Config struct {
+	Algorithm  string
+	BcryptCost int
+
+	// Argon2 parameters, memory is in KiB.
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+}
+
+// DefaultConfig is used until the package is configured.
+var DefaultConfig = Config{
+	Algorithm:     Bcrypt,
+	BcryptCost:    bcrypt.DefaultCost,
+	Argon2Time:    1,
+	Argon2Memory:  64 * 1024,
+	Argon2Threads: 4,
+}
+
+// Length of the argon2id salt and key in bytes.
+const (
+	saltLen = 16
+	keyLen  = 32
+)
+
+var b64 = base64.RawStdEncoding
+
+var (
+	mu  sync.RWMutex
+	cfg = DefaultConfig
+)
+
+// Configure replaces the config used for new hashes.
+func Configure(c Config) error {
+	switch c.Algorithm {
+	case Bcrypt:
+		if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+			return errors.Errorf("bcrypt cost %d out of range", c.BcryptCost)
+		}
+	case Argon2id:
+		if c.Argon2Time == 0 || c.Argon2Memory == 0 || c.Argon2Threads == 0 {
+			return errors.New("argon2id parameters must not be zero")
+		}
+	default:
+		return errors.Errorf("unknown algorithm %q", c.Algorithm)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	cfg = c
+	return nil
+}
+
+func config() Config {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return cfg
+}
+
+// Generate hashes the password with the configured algorithm.
+func Generate(password string) ([]byte, error) {
+	c := config()
+
+	if c.Algorithm == Argon2id {
+		salt := make([]byte, saltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, errors.Wrap(err, "reading salt")
+		}
+
+		key := argon2.IDKey([]byte(password), salt, c.Argon2Time, c.Argon2Memory, c.Argon2Threads, keyLen)
+		hash := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, c.Argon2Memory, c.Argon2Time, c.Argon2Threads, b64.EncodeToString(salt), b64.EncodeToString(key))
+
+		return []byte(hash), nil
+	}
+
+	return bcrypt.GenerateFromPassword([]byte(password), c.BcryptCost)
+}
+
+// Compare checks the password against a hash of either algorithm.
+func Compare(hash []byte, password string) error {
+	if !isArgon2id(hash) {
+		if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+			return ErrMismatch
+		}
+		return nil
+	}
+
+	p, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, p.Argon2Time, p.Argon2Memory, p.Argon2Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrMismatch
+	}
+
+	return nil
+}
+
+// NeedsRehash reports whether the hash was generated with another algorithm
+// or weaker parameters than configured.
+func NeedsRehash(hash []byte) bool {
+	c := config()
+
+	if !isArgon2id(hash) {
+		if c.Algorithm != Bcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost(hash)
+		return err != nil || cost < c.BcryptCost
+	}
+
+	if c.Algorithm != Argon2id {
+		return true
+	}
+
+	p, _, _, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return p.Argon2Time < c.Argon2Time || p.Argon2Memory < c.Argon2Memory || p.Argon2Threads < c.Argon2Threads
+}
+
+func isArgon2id(hash []byte) bool {
+	return strings.HasPrefix(string(hash), "$argon2id$")
+}
+
+// parseArgon2id decodes the parameters, salt and key of an encoded hash in
+// the format $argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>.
+func parseArgon2id(hash []byte) (Config, []byte, []byte, error) {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 {
+		return Config{}, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Config{}, nil, nil, errors.New("unsupported argon2id version")
+	}
+
+	p := Config{Algorithm: Argon2id}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Argon2Memory, &p.Argon2Time, &p.Argon2Threads); err != nil {
+		return Config{}, nil, nil, errors.Wrap(err, "parsing argon2id parameters")
+	}
+
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return Config{}, nil, nil, errors.Wrap(err, "decoding argon2id salt")
+	}
+
+	key, err := b64.DecodeString(parts[5])
+	if err != nil {
+		return Config{}, nil, nil, errors.Wrap(err, "decoding argon2id key")
+	}
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,78 @@
+package pwhash_test
+
+import (
+	"testing"
+
+	"github.com/egorovdmi/financify/business/sys/pwhash"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestPwhash(t *testing.T) {
+	t.Cleanup(func() { pwhash.Configure(pwhash.DefaultConfig) })
+
+	t.Log("Given the need to hash passwords and upgrade outdated hashes.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen upgrading from bcrypt to argon2id.", testID)
+		{
+			cfg := pwhash.DefaultConfig
+			cfg.BcryptCost = bcrypt.MinCost
+			if err := pwhash.Configure(cfg); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to configure bcrypt: %v", failed, testID, err)
+			}
+
+			old, err := pwhash.Generate("correct horse")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to hash with bcrypt: %v", failed, testID, err)
+			}
+			if err := pwhash.Compare(old, "correct horse"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould match the bcrypt hash: %v", failed, testID, err)
+			}
+			if pwhash.NeedsRehash(old) {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT rehash with an unchanged config.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to hash with bcrypt.", success, testID)
+
+			cfg.BcryptCost = bcrypt.MinCost + 1
+			pwhash.Configure(cfg)
+			if !pwhash.NeedsRehash(old) {
+				t.Fatalf("\t%s\tTest %d:\tShould rehash when the cost is raised.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould rehash when the cost is raised.", success, testID)
+
+			cfg.Algorithm = pwhash.Argon2id
+			cfg.Argon2Memory = 1024
+			if err := pwhash.Configure(cfg); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to configure argon2id: %v", failed, testID, err)
+			}
+			if !pwhash.NeedsRehash(old) {
+				t.Fatalf("\t%s\tTest %d:\tShould rehash when the algorithm changes.", failed, testID)
+			}
+			if err := pwhash.Compare(old, "correct horse"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould still match the bcrypt hash: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould rehash when the algorithm changes.", success, testID)
+
+			hash, err := pwhash.Generate("correct horse")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to hash with argon2id: %v", failed, testID, err)
+			}
+			if err := pwhash.Compare(hash, "correct horse"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould match the argon2id hash: %v", failed, testID, err)
+			}
+			if err := pwhash.Compare(hash, "battery staple"); err != pwhash.ErrMismatch {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT match another password: %v", failed, testID, err)
+			}
+			if pwhash.NeedsRehash(hash) {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT rehash a current argon2id hash.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to hash with argon2id.", success, testID)
+		}
+	}
+}
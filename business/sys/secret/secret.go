@@ -0,0 +1,33 @@
+// Package secret provides support for random single-use secrets handed out to
+// users, e.g. invitation links, which are only ever stored as a hash.
+package secret
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+// size is the number of random bytes in every secret.
+const size = 32
+
+// New generates a random URL safe secret and returns it with its hash. The
+// secret is handed out to the user and only the hash must be stored.
+func New() (string, string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", errors.Wrap(err, "reading random bytes")
+	}
+
+	s := base64.RawURLEncoding.EncodeToString(b)
+	return s, Hash(s), nil
+}
+
+// Hash returns the hash of the secret suitable for storage and lookups.
+func Hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
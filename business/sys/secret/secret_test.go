@@ -0,0 +1,48 @@
+package secret_test
+
+import (
+	"testing"
+
+	"github.com/egorovdmi/financify/business/sys/secret"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestSecret(t *testing.T) {
+	t.Log("Given the need to hand out secrets and only store their hashes.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen generating a couple of secrets.", testID)
+		{
+			s1, h1, err := secret.New()
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a secret: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to generate a secret.", success, testID)
+
+			if secret.Hash(s1) != h1 {
+				t.Fatalf("\t%s\tTest %d:\tShould get the same hash for the secret.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the same hash for the secret.", success, testID)
+
+			if h1 == s1 {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT store the secret as is.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT store the secret as is.", success, testID)
+
+			s2, h2, err := secret.New()
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a second secret: %v", failed, testID, err)
+			}
+
+			if s1 == s2 || h1 == h2 {
+				t.Fatalf("\t%s\tTest %d:\tShould generate unique secrets.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould generate unique secrets.", success, testID)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package validate
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+)
+
+// PasswordPolicy defines the requirements for user passwords checked by the
+// password tag.
+type PasswordPolicy struct {
+	MinLength int
+
+	// Breached holds lower-cased passwords known from breaches which can't
+	// be used no matter how long they are.
+	Breached map[string]struct{}
+}
+
+// DefaultPasswordPolicy is used until the policy is configured.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength: 8,
+}
+
+var (
+	policyMu sync.RWMutex
+	policy   = DefaultPasswordPolicy
+)
+
+// SetPasswordPolicy replaces the policy used for validating passwords.
+func SetPasswordPolicy(p PasswordPolicy) {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+
+	policy = p
+}
+
+// ReadBreachList reads a list of breached passwords, one per line. Empty
+// lines and lines starting with # are skipped.
+func ReadBreachList(r io.Reader) (map[string]struct{}, error) {
+	breached := make(map[string]struct{})
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		breached[strings.ToLower(line)] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return breached, nil
+}
+
+// CheckPassword validates the password against the policy, reporting the
+// problem for the password field.
+func CheckPassword(password string, email string) error {
+	if msg := passwordProblem(password); msg != "" {
+		return FieldErrors{{Field: "password", Error: "password " + msg}}
+	}
+
+	if email != "" && strings.EqualFold(password, email) {
+		return FieldErrors{{Field: "password", Error: "password must not be the same as the email"}}
+	}
+
+	return nil
+}
+
+// passwordProblem describes why the password violates the policy, it's empty
+// when it doesn't.
+func passwordProblem(password string) string {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+
+	if len([]rune(password)) < policy.MinLength {
+		return fmt.Sprintf("must be at least %d characters in length", policy.MinLength)
+	}
+
+	if _, ok := policy.Breached[strings.ToLower(password)]; ok {
+		return "is known from a data breach, please choose another one"
+	}
+
+	return ""
+}
+
+// registerPassword adds the password and nefold tags to the validator.
+//
+//	password: the value satisfies the password policy.
+//	nefold=Field: the value isn't equal to the other field ignoring case.
+func registerPassword(v *validator.Validate, trans ut.Translator) {
+	v.RegisterValidation("password", func(fl validator.FieldLevel) bool {
+		return passwordProblem(fl.Field().String()) == ""
+	})
+
+	v.RegisterTranslation("password", trans,
+		func(ut ut.Translator) error { return nil },
+		func(ut ut.Translator, fe validator.FieldError) string {
+			return fe.Field() + " " + passwordProblem(fmt.Sprint(fe.Value()))
+		},
+	)
+
+	v.RegisterValidation("nefold", func(fl validator.FieldLevel) bool {
+		other, kind, _, found := fl.GetStructFieldOKAdvanced2(fl.Parent(), fl.Param())
+		if !found || kind != reflect.String {
+			return true
+		}
+		return !strings.EqualFold(fl.Field().String(), other.String())
+	})
+
+	v.RegisterTranslation("nefold", trans,
+		func(ut ut.Translator) error {
+			return ut.Add("nefold", "{0} must not be the same as {1}", false)
+		},
+		func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("nefold", fe.Field(), strings.ToLower(fe.Param()))
+			return t
+		},
+	)
+}
@@ -0,0 +1,58 @@
+package validate_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/egorovdmi/financify/business/sys/validate"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	breached, err := validate.ReadBreachList(strings.NewReader("# top passwords\npassword123\n\nQwertyuiop\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validate.SetPasswordPolicy(validate.PasswordPolicy{MinLength: 10, Breached: breached})
+	t.Cleanup(func() { validate.SetPasswordPolicy(validate.DefaultPasswordPolicy) })
+
+	type signup struct {
+		Email    string `json:"email" validate:"required,email"`
+		Password string `json:"password" validate:"required,password,nefold=Email"`
+	}
+
+	table := []struct {
+		name     string
+		email    string
+		password string
+		valid    bool
+	}{
+		{"a long password", "jane@example.com", "correct horse battery", true},
+		{"a short password", "jane@example.com", "gophers", false},
+		{"a breached password", "jane@example.com", "QWERTYUIOP", false},
+		{"the email as password", "jane.doe@example.com", "Jane.Doe@example.com", false},
+	}
+
+	t.Log("Given the need to enforce the password policy.")
+	{
+		for testID, tt := range table {
+			t.Logf("\tTest %d:\tWhen validating %s.", testID, tt.name)
+			{
+				err := validate.Check(signup{Email: tt.email, Password: tt.password})
+				if (err == nil) != tt.valid {
+					t.Fatalf("\t%s\tTest %d:\tShould get valid=%v : got %v.", failed, testID, tt.valid, err)
+				}
+				if err != nil && validate.GetFieldErrors(err).Fields()["password"] == "" {
+					t.Fatalf("\t%s\tTest %d:\tShould report the password field : got %v.", failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get valid=%v.", success, testID, tt.valid)
+			}
+		}
+	}
+}
@@ -36,6 +36,9 @@ func init() {
 	// Register the english error messages for use.
 	en_translations.RegisterDefaultTranslations(validate, translator)
 
+	// Register the tags enforcing the password policy.
+	registerPassword(validate, translator)
+
 	// Use JSON tag names for errors instead of Go struct names.
 	validate.RegisterTagNameFunc(func(fld reflect.StructField) string {
 		name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
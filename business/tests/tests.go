@@ -5,15 +5,15 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"fmt"
-	"log"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/egorovdmi/financify/business/auth"
+	"github.com/egorovdmi/financify/business/core/session"
 	"github.com/egorovdmi/financify/business/data/dbschema"
-	"github.com/egorovdmi/financify/business/data/user"
 	"github.com/egorovdmi/financify/foundation/database"
+	"github.com/egorovdmi/financify/foundation/logger"
 	"github.com/egorovdmi/financify/foundation/web"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
@@ -34,7 +34,7 @@ var (
 	UserID  = "45b5fbd3-755f-4379-8f07-a58d4a30fa2f"
 )
 
-func NewUnit(t *testing.T) (*log.Logger, *sqlx.DB, func()) {
+func NewUnit(t *testing.T) (*logger.Logger, *sqlx.DB, func()) {
 	c := startContainer(t, dbImage, dbPort, dbArgs...)
 
 	cfg := database.Config{
@@ -81,7 +81,7 @@ func NewUnit(t *testing.T) (*log.Logger, *sqlx.DB, func()) {
 		stopContainer(t, c.ID)
 	}
 
-	log := log.New(os.Stdout, "TEST : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile)
+	log := logger.New(os.Stdout, logger.LevelDebug, logger.FormatText).With("service", "TEST")
 
 	return log, db, teardown
 }
@@ -109,7 +109,7 @@ func IntPointer(i int) *int {
 type Test struct {
 	TraceID string
 	DB      *sqlx.DB
-	Log     *log.Logger
+	Log     *logger.Logger
 	Auth    *auth.Auth
 	KID     string
 
@@ -164,16 +164,11 @@ func (test *Test) Teardown() {
 }
 
 func (test *Test) Token(kid string, email string, pass string) string {
-	userRepo := user.NewUserRepository(test.Log, test.DB)
-	claims, err := userRepo.Authenticate(context.Background(), test.TraceID, email, pass, time.Now())
+	sess := session.NewCore(test.Log, test.DB, test.Auth, session.Lockout{})
+	token, err := sess.Token(context.Background(), test.TraceID, kid, email, pass, "", time.Now())
 	if err != nil {
 		test.t.Fatal(err)
 	}
 
-	token, err := test.Auth.GenerateToken(test.KID, claims)
-	if err != nil {
-		test.t.Fatal(err)
-	}
-
-	return token
+	return token.Token
 }
@@ -2,12 +2,17 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/egorovdmi/financify/foundation/logger"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
 )
 
 type Config struct {
@@ -16,8 +21,15 @@ type Config struct {
 	Host       string
 	Name       string
 	DisableTLS bool
+
+	// Log receives statements slower than SlowQueryThreshold. Slow
+	// statements aren't logged when either is unset.
+	Log                *logger.Logger
+	SlowQueryThreshold time.Duration
 }
 
+// Open constructs a database handle tracing every statement. The connection
+// isn't established until the handle is used.
 func Open(cfg Config) (*sqlx.DB, error) {
 	sslMode := "require"
 	if cfg.DisableTLS {
@@ -36,7 +48,13 @@ func Open(cfg Config) (*sqlx.DB, error) {
 		RawQuery: q.Encode(),
 	}
 
-	return sqlx.Open("postgres", u.String())
+	connector, err := pq.NewConnector(u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	db := sql.OpenDB(Instrument(connector, cfg.Log, cfg.SlowQueryThreshold))
+	return sqlx.NewDb(db, "postgres"), nil
 }
 
 // StatusCheck return nil if it can talk successfully to the DB
@@ -47,25 +65,54 @@ func StatusCheck(ctx context.Context, db *sqlx.DB) error {
 	return db.QueryRowContext(ctx, q).Scan(&tmp)
 }
 
-// Log provides a pretty print version of a query and parameters.
+// Log provides a pretty print version of a query and parameters. Arguments
+// bound to sensitive columns, wrapped with Redact or holding raw bytes are
+// replaced by a placeholder so they never end up in the logs.
 func Log(query string, args ...interface{}) string {
-	for i, arg := range args {
-		n := fmt.Sprintf("$%d", i+1)
+	sensitive := sensitiveParams(query)
+
+	return paramRegex.ReplaceAllStringFunc(query, func(param string) string {
+		n, err := strconv.Atoi(param[1:])
+		if err != nil || n < 1 || n > len(args) {
+			return param
+		}
+		if sensitive[n] {
+			return redacted
+		}
 
-		var a string
-		switch v := arg.(type) {
+		switch v := args[n-1].(type) {
+		case Redacted:
+			return redacted
 		case string:
-			a = fmt.Sprintf("%q", v)
+			return fmt.Sprintf("%q", v)
 		case []byte:
-			a = string(v)
+			return fmt.Sprintf("<%d bytes>", len(v))
 		case []string:
-			a = strings.Join(v, ",")
+			return strings.Join(v, ",")
 		default:
-			a = fmt.Sprintf("%v", v)
+			return fmt.Sprintf("%v", v)
 		}
+	})
+}
+
+// WithinTran runs the passed function inside a transaction. The transaction
+// is committed when the function succeeds and rolled back otherwise.
+func WithinTran(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "begin transaction")
+	}
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return errors.Wrapf(err, "rollback transaction: %v", rbErr)
+		}
+		return err
+	}
 
-		query = strings.Replace(query, n, a, 1)
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "commit transaction")
 	}
 
-	return query
+	return nil
 }
@@ -0,0 +1,129 @@
+package database_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/egorovdmi/financify/foundation/database"
+	"github.com/egorovdmi/financify/foundation/metrics"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestLog(t *testing.T) {
+	const (
+		hash     = "$2a$10$abcdefghijklmnopqrstuv"
+		email    = "john@example.com"
+		token    = "tok-123"
+		password = "gophers"
+	)
+
+	tt := []struct {
+		name  string
+		query string
+		args  []interface{}
+		exp   string
+	}{
+		{
+			name:  "insert",
+			query: `INSERT INTO users (user_id, name, email, password_hash) VALUES ($1, $2, $3, $4)`,
+			args:  []interface{}{"42", "John", email, []byte(hash)},
+			exp:   `INSERT INTO users (user_id, name, email, password_hash) VALUES ("42", "John", ***, ***)`,
+		},
+		{
+			name:  "update",
+			query: `UPDATE users SET "name"=$2, "password_hash"=$3 WHERE user_id=$1`,
+			args:  []interface{}{"42", "John", hash},
+			exp:   `UPDATE users SET "name"="John", "password_hash"=*** WHERE user_id="42"`,
+		},
+		{
+			name:  "where",
+			query: `SELECT * FROM users WHERE u.email = $1 AND token_hash=$2 LIMIT $3`,
+			args:  []interface{}{email, token, 10},
+			exp:   `SELECT * FROM users WHERE u.email = *** AND token_hash=*** LIMIT 10`,
+		},
+		{
+			name:  "redact",
+			query: `SELECT check_password($1, $2)`,
+			args:  []interface{}{"42", database.Redact(password)},
+			exp:   `SELECT check_password("42", ***)`,
+		},
+		{
+			name:  "bytes",
+			query: `UPDATE keys SET body=$1, roles=$2 WHERE id=$10`,
+			args:  []interface{}{[]byte(token), []string{"ADMIN", "USER"}},
+			exp:   `UPDATE keys SET body=<7 bytes>, roles=ADMIN,USER WHERE id=$10`,
+		},
+	}
+
+	t.Log("Given the need to log queries without leaking secrets.")
+	{
+		for testID, tst := range tt {
+			t.Logf("\tTest %d:\tWhen logging the %s query.", testID, tst.name)
+			{
+				got := database.Log(tst.query, tst.args...)
+				if got != tst.exp {
+					t.Fatalf("\t%s\tTest %d:\tShould print the query : got %q want %q.", failed, testID, got, tst.exp)
+				}
+				for _, s := range []string{hash, email, token, password} {
+					if strings.Contains(got, s) {
+						t.Fatalf("\t%s\tTest %d:\tShould NOT print %q : got %q.", failed, testID, s, got)
+					}
+				}
+				t.Logf("\t%s\tTest %d:\tShould print the query without secrets.", success, testID)
+			}
+		}
+
+		testID := len(tt)
+		t.Logf("\tTest %d:\tWhen marking a column as sensitive.", testID)
+		{
+			const q = `UPDATE users SET "phone"=$2 WHERE user_id=$1`
+
+			if got := database.Log(q, "42", "555-0100"); !strings.Contains(got, "555-0100") {
+				t.Fatalf("\t%s\tTest %d:\tShould print values of other columns : got %q.", failed, testID, got)
+			}
+
+			database.MarkSensitive("phone")
+			if got := database.Log(q, "42", "555-0100"); strings.Contains(got, "555-0100") || !strings.Contains(got, `"42"`) {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT print values of the marked column : got %q.", failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT print values of the marked column.", success, testID)
+		}
+	}
+}
+
+func TestRegisterStats(t *testing.T) {
+	t.Log("Given the need to monitor the connection pool.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen registering the pool statistics.", testID)
+		{
+			db, err := sqlx.Open("postgres", "postgres://localhost/none")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to open the database: %s.", failed, testID, err)
+			}
+			defer db.Close()
+			db.SetMaxOpenConns(7)
+
+			reg := metrics.NewRegistry()
+			database.RegisterStats(reg, db)
+
+			var buf bytes.Buffer
+			reg.WriteText(&buf)
+
+			for _, exp := range []string{"db_max_open_connections 7\n", "db_open_connections 0\n", "# TYPE db_wait_count_total counter\n"} {
+				if !strings.Contains(buf.String(), exp) {
+					t.Fatalf("\t%s\tTest %d:\tShould report %q : got %q.", failed, testID, exp, buf.String())
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould report the pool statistics.", success, testID)
+		}
+	}
+}
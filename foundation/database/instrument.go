@@ -0,0 +1,376 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/egorovdmi/financify/foundation/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Instrument wraps the connector so every statement sent through it, inside
+// a transaction or not, gets a span and statements slower than the threshold
+// are logged. Slow statements aren't logged when log is nil or the threshold
+// is zero.
+func Instrument(connector driver.Connector, log *logger.Logger, slowThreshold time.Duration) driver.Connector {
+	return &instrumentedConnector{
+		Connector: connector,
+		ins: &instrumentation{
+			log:           log,
+			slowThreshold: slowThreshold,
+		},
+	}
+}
+
+// instrumentation starts the spans of statements and logs the slow ones.
+type instrumentation struct {
+	log           *logger.Logger
+	slowThreshold time.Duration
+}
+
+// statement is the instrumentation of a single statement.
+type statement struct {
+	ins   *instrumentation
+	ctx   context.Context
+	span  trace.Span
+	query string
+	start time.Time
+}
+
+// start begins the span of a statement.
+func (ins *instrumentation) start(ctx context.Context, op string, query string) *statement {
+	query = Sanitize(query)
+
+	currentSpan := trace.SpanFromContext(ctx)
+	ctx, span := currentSpan.TracerProvider().Tracer("").Start(ctx, "foundation.database."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBStatementKey.String(query),
+			semconv.DBOperationKey.String(operation(query)),
+		),
+	)
+
+	return &statement{
+		ins:   ins,
+		ctx:   ctx,
+		span:  span,
+		query: query,
+		start: time.Now(),
+	}
+}
+
+// end finishes the span of the statement, recording the error and the
+// number of rows, and logs the statement when it was slow. A negative number
+// of rows means it isn't known.
+func (s *statement) end(err error, rowsKey string, rows int64) {
+	defer s.span.End()
+
+	if rows >= 0 {
+		s.span.SetAttributes(attribute.Int64(rowsKey, rows))
+	}
+
+	if err != nil && err != driver.ErrSkip && err != io.EOF {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+
+	d := time.Since(s.start)
+	if s.ins.log == nil || s.ins.slowThreshold <= 0 || d < s.ins.slowThreshold {
+		return
+	}
+
+	s.ins.log.Warn("slow query", "trace_id", s.span.SpanContext().TraceID().String(), "query", s.query,
+		"duration", d, "threshold", s.ins.slowThreshold, "rows", rows)
+}
+
+// Keys of the number of rows a statement affected or returned.
+const (
+	rowsAffectedKey = "db.rows_affected"
+	rowsReturnedKey = "db.rows_returned"
+)
+
+// =============================================================================
+
+type instrumentedConnector struct {
+	driver.Connector
+	ins *instrumentation
+}
+
+func (c *instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn, ins: c.ins}, nil
+}
+
+// instrumentedConn implements the context aware interfaces of a connection,
+// falling back to the plain ones of the wrapped connection like database/sql
+// does.
+type instrumentedConn struct {
+	driver.Conn
+	ins *instrumentation
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	s := c.ins.start(ctx, "exec", query)
+	res, err := execer.ExecContext(s.ctx, query, args)
+	s.end(err, rowsAffectedKey, rowsAffected(res, err))
+	return res, err
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	s := c.ins.start(ctx, "query", query)
+	rows, err := queryer.QueryContext(s.ctx, query, args)
+	if err != nil {
+		s.end(err, rowsReturnedKey, -1)
+		return nil, err
+	}
+	return &instrumentedRows{Rows: rows, stmt: s}, nil
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, ins: c.ins, query: query}, nil
+}
+
+func (c *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// =============================================================================
+
+type instrumentedStmt struct {
+	driver.Stmt
+	ins   *instrumentation
+	query string
+}
+
+func (st *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	s := st.ins.start(ctx, "exec", st.query)
+
+	var res driver.Result
+	var err error
+	if execer, ok := st.Stmt.(driver.StmtExecContext); ok {
+		res, err = execer.ExecContext(s.ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(ctx, args); err == nil {
+			res, err = st.Stmt.Exec(values)
+		}
+	}
+
+	s.end(err, rowsAffectedKey, rowsAffected(res, err))
+	return res, err
+}
+
+func (st *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	s := st.ins.start(ctx, "query", st.query)
+
+	var rows driver.Rows
+	var err error
+	if queryer, ok := st.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(s.ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(ctx, args); err == nil {
+			rows, err = st.Stmt.Query(values)
+		}
+	}
+
+	if err != nil {
+		s.end(err, rowsReturnedKey, -1)
+		return nil, err
+	}
+	return &instrumentedRows{Rows: rows, stmt: s}, nil
+}
+
+// namedValues converts arguments for drivers without context support.
+func namedValues(ctx context.Context, args []driver.NamedValue) ([]driver.Value, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values, nil
+}
+
+// =============================================================================
+
+// instrumentedRows counts the rows read and ends the span of the query when
+// closed. It forwards the optional column type interfaces with the defaults
+// of database/sql.
+type instrumentedRows struct {
+	driver.Rows
+	stmt *statement
+
+	once sync.Once
+	n    int64
+	err  error
+}
+
+func (r *instrumentedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	switch err {
+	case nil:
+		r.n++
+	case io.EOF:
+	default:
+		r.err = err
+	}
+	return err
+}
+
+func (r *instrumentedRows) Close() error {
+	err := r.Rows.Close()
+	r.once.Do(func() {
+		if r.err == nil {
+			r.err = err
+		}
+		r.stmt.end(r.err, rowsReturnedKey, r.n)
+	})
+	return err
+}
+
+func (r *instrumentedRows) HasNextResultSet() bool {
+	if rs, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return rs.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *instrumentedRows) NextResultSet() error {
+	if rs, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return rs.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (r *instrumentedRows) ColumnTypeScanType(index int) reflect.Type {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return ct.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(interface{})).Elem()
+}
+
+func (r *instrumentedRows) ColumnTypeDatabaseTypeName(index int) string {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return ct.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *instrumentedRows) ColumnTypeLength(index int) (int64, bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return ct.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *instrumentedRows) ColumnTypeNullable(index int) (bool, bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return ct.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *instrumentedRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return ct.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
+
+// =============================================================================
+
+// rowsAffected returns the rows affected by a statement, or -1 when unknown.
+func rowsAffected(res driver.Result, err error) int64 {
+	if err != nil || res == nil {
+		return -1
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+var (
+	// literalRegex matches string literals, like 'OWNER'.
+	literalRegex = regexp.MustCompile(`'(?:[^']|'')*'`)
+
+	// spaceRegex matches runs of white space.
+	spaceRegex = regexp.MustCompile(`\s+`)
+)
+
+// sanitizeCache holds the sanitized form of every query seen.
+var sanitizeCache sync.Map
+
+// Sanitize returns the query with string literals replaced by '?' and white
+// space collapsed, so it can be recorded without the values it was written
+// with. Arguments are never part of the query.
+func Sanitize(query string) string {
+	if v, ok := sanitizeCache.Load(query); ok {
+		return v.(string)
+	}
+
+	sanitized := literalRegex.ReplaceAllString(query, "'?'")
+	sanitized = strings.TrimSpace(spaceRegex.ReplaceAllString(sanitized, " "))
+
+	sanitizeCache.Store(query, sanitized)
+	return sanitized
+}
+
+// operation returns the SQL command of the query, like SELECT.
+func operation(query string) string {
+	if i := strings.IndexAny(query, " ("); i > 0 {
+		query = query[:i]
+	}
+	return strings.ToUpper(query)
+}
@@ -0,0 +1,183 @@
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/egorovdmi/financify/foundation/database"
+	"github.com/egorovdmi/financify/foundation/logger"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// fakeConnector hands out connections answering every query with two rows
+// and every statement with three affected rows.
+type fakeConnector struct {
+	delay time.Duration
+	fail  error
+}
+
+func (c fakeConnector) Connect(ctx context.Context) (driver.Conn, error) { return fakeConn(c), nil }
+func (c fakeConnector) Driver() driver.Driver                            { return nil }
+
+type fakeConn fakeConnector
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+func (c fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	time.Sleep(c.delay)
+	if c.fail != nil {
+		return nil, c.fail
+	}
+	return driver.RowsAffected(3), nil
+}
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &fakeRows{n: 2}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct{ n int }
+
+func (r *fakeRows) Columns() []string { return []string{"id"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.n == 0 {
+		return io.EOF
+	}
+	r.n--
+	dest[0] = int64(r.n)
+	return nil
+}
+
+// recorder keeps the spans that ended.
+type recorder struct {
+	mu    sync.Mutex
+	spans []sdktrace.ReadOnlySpan
+}
+
+func (r *recorder) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {}
+func (r *recorder) Shutdown(ctx context.Context) error                       { return nil }
+func (r *recorder) ForceFlush(ctx context.Context) error                     { return nil }
+func (r *recorder) OnEnd(s sdktrace.ReadOnlySpan) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+// attr returns the attribute of the span as a string.
+func attr(s sdktrace.ReadOnlySpan, key string) string {
+	for _, kv := range s.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestInstrument(t *testing.T) {
+	rec := recorder{}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(&rec))
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	defer parent.End()
+
+	var buf bytes.Buffer
+	log := logger.New(&buf, logger.LevelDebug, logger.FormatText)
+
+	t.Log("Given the need to trace the statements sent to the database.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen running statements.", testID)
+		{
+			db := sql.OpenDB(database.Instrument(fakeConnector{}, log, time.Hour))
+			defer db.Close()
+
+			if _, err := db.ExecContext(ctx, "UPDATE users\n\tSET role = 'ADMIN' WHERE id = $1", 1); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to exec: %s.", failed, testID, err)
+			}
+
+			tx, err := db.BeginTx(ctx, nil)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to begin a transaction: %s.", failed, testID, err)
+			}
+			rows, err := tx.QueryContext(ctx, "SELECT id FROM users")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query: %s.", failed, testID, err)
+			}
+			for rows.Next() {
+			}
+			rows.Close()
+			tx.Commit()
+
+			if len(rec.spans) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould get a span per statement : got %d.", failed, testID, len(rec.spans))
+			}
+			t.Logf("\t%s\tTest %d:\tShould get a span per statement.", success, testID)
+
+			exec, query := rec.spans[0], rec.spans[1]
+			if exec.Parent().SpanID() != parent.SpanContext().SpanID() || query.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Fatalf("\t%s\tTest %d:\tShould be children of the span of the request.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be children of the span of the request.", success, testID)
+
+			if got := attr(exec, "db.statement"); got != "UPDATE users SET role = '?' WHERE id = $1" {
+				t.Fatalf("\t%s\tTest %d:\tShould record the sanitized statement : got %q.", failed, testID, got)
+			}
+			if attr(exec, "db.system") != "postgresql" || attr(exec, "db.operation") != "UPDATE" {
+				t.Fatalf("\t%s\tTest %d:\tShould record the system and operation : got %v.", failed, testID, exec.Attributes())
+			}
+			t.Logf("\t%s\tTest %d:\tShould record the sanitized statement.", success, testID)
+
+			if attr(exec, "db.rows_affected") != "3" || attr(query, "db.rows_returned") != "2" {
+				t.Fatalf("\t%s\tTest %d:\tShould record the rows : got %v, %v.", failed, testID, exec.Attributes(), query.Attributes())
+			}
+			t.Logf("\t%s\tTest %d:\tShould record the rows.", success, testID)
+
+			if buf.Len() != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT log fast statements : got %q.", failed, testID, buf.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT log fast statements.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a statement is slow and fails.", testID)
+		{
+			rec.spans = nil
+			boom := errors.New("boom")
+
+			db := sql.OpenDB(database.Instrument(fakeConnector{delay: 10 * time.Millisecond, fail: boom}, log, time.Millisecond))
+			defer db.Close()
+
+			if _, err := db.ExecContext(ctx, "DELETE FROM users WHERE email = 'john@example.com'"); err != boom {
+				t.Fatalf("\t%s\tTest %d:\tShould get the error of the driver : got %v.", failed, testID, err)
+			}
+
+			if len(rec.spans) != 1 || rec.spans[0].Status().Description != "boom" || len(rec.spans[0].Events()) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould record the error in the span.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould record the error in the span.", success, testID)
+
+			got := buf.String()
+			if !strings.Contains(got, "WARN  slow query") || !strings.Contains(got, "trace_id="+parent.SpanContext().TraceID().String()) {
+				t.Fatalf("\t%s\tTest %d:\tShould log the slow statement : got %q.", failed, testID, got)
+			}
+			if strings.Contains(got, "john@example.com") {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT log literals of the slow statement : got %q.", failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould log the slow statement.", success, testID)
+		}
+	}
+}
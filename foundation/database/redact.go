@@ -0,0 +1,130 @@
+package database
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// redacted replaces sensitive values in logged queries.
+const redacted = "***"
+
+// Redacted marks a query argument as sensitive so Log never prints it.
+type Redacted struct {
+	Value interface{}
+}
+
+// Redact marks the query argument as sensitive. Only the value passed to Log
+// needs to be wrapped, the one passed to the database stays as it is.
+func Redact(v interface{}) Redacted {
+	return Redacted{Value: v}
+}
+
+// sensitiveColumns holds the columns whose values Log never prints. Columns
+// ending in _hash are always sensitive.
+var sensitiveColumns = struct {
+	sync.RWMutex
+	m map[string]bool
+}{
+	m: map[string]bool{
+		"email":         true,
+		"password":      true,
+		"secret":        true,
+		"token":         true,
+		"nonce":         true,
+		"code_verifier": true,
+	},
+}
+
+// MarkSensitive adds columns whose values Log never prints.
+func MarkSensitive(columns ...string) {
+	sensitiveColumns.Lock()
+	defer sensitiveColumns.Unlock()
+
+	for _, c := range columns {
+		sensitiveColumns.m[strings.ToLower(c)] = true
+	}
+
+	// Queries seen so far may bind the new columns.
+	paramCache.Range(func(query, _ interface{}) bool {
+		paramCache.Delete(query)
+		return true
+	})
+}
+
+// isSensitive reports whether values of the column must not be printed.
+func isSensitive(column string) bool {
+	column = strings.ToLower(column)
+	if strings.HasSuffix(column, "_hash") {
+		return true
+	}
+
+	sensitiveColumns.RLock()
+	defer sensitiveColumns.RUnlock()
+	return sensitiveColumns.m[column]
+}
+
+var (
+	// paramRegex matches the parameters of a query, like $1.
+	paramRegex = regexp.MustCompile(`\$\d+`)
+
+	// compareRegex matches a column compared to or assigned a parameter,
+	// like "email"=$2 or u.email = $2.
+	compareRegex = regexp.MustCompile(`(?i)"?(\w+)"?\s*(?:=|<>|!=|LIKE|ILIKE)\s*\$(\d+)`)
+
+	// insertRegex matches the columns and values of an insert.
+	insertRegex = regexp.MustCompile(`(?is)INSERT\s+INTO\s+\w+\s*\(([^)]*)\)\s*VALUES\s*\(([^)]*)\)`)
+)
+
+// paramCache holds the sensitive parameters of every query seen.
+var paramCache sync.Map
+
+// sensitiveParams returns the numbers of the parameters of the query that are
+// bound to sensitive columns.
+func sensitiveParams(query string) map[int]bool {
+	if v, ok := paramCache.Load(query); ok {
+		return v.(map[int]bool)
+	}
+
+	params := make(map[int]bool)
+	mark := func(column string, param string) {
+		if !isSensitive(column) {
+			return
+		}
+		if n := paramNumber(param); n > 0 {
+			params[n] = true
+		}
+	}
+
+	for _, m := range compareRegex.FindAllStringSubmatch(query, -1) {
+		mark(m[1], "$"+m[2])
+	}
+
+	for _, m := range insertRegex.FindAllStringSubmatch(query, -1) {
+		columns := strings.Split(m[1], ",")
+		values := strings.Split(m[2], ",")
+		for i := 0; i < len(columns) && i < len(values); i++ {
+			mark(strings.Trim(strings.TrimSpace(columns[i]), `"`), strings.TrimSpace(values[i]))
+		}
+	}
+
+	paramCache.Store(query, params)
+	return params
+}
+
+// paramNumber returns the number of a parameter like $3, or 0 when the value
+// isn't a parameter.
+func paramNumber(param string) int {
+	if !strings.HasPrefix(param, "$") {
+		return 0
+	}
+
+	n := 0
+	for _, r := range param[1:] {
+		if r < '0' || r > '9' {
+			return 0
+		}
+		n = n*10 + int(r-'0')
+	}
+	return n
+}
@@ -0,0 +1,283 @@
+// Package logger provides a leveled logger writing structured records as
+// text or JSON lines.
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Level is the severity of a record. Records below the level of the logger
+// are dropped.
+type Level int
+
+// Set of levels from the least to the most severe.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the name of the level as it appears in records.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+}
+
+// ParseLevel returns the level with the name, ignoring case.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return 0, errors.Errorf("unknown log level %q", name)
+}
+
+// Format is how records are written.
+type Format string
+
+// Set of supported formats.
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+// ParseFormat returns the format with the name, ignoring case.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case FormatText, FormatJSON:
+		return f, nil
+	}
+	return "", errors.Errorf("unknown log format %q", name)
+}
+
+// core is shared by a logger and the loggers derived from it.
+type core struct {
+	mu     sync.Mutex
+	w      io.Writer
+	level  Level
+	format Format
+	now    func() time.Time
+}
+
+// Logger writes records made of a message and key/value pairs. Keys are
+// strings, values are written as JSON values or in their text form. A logger
+// is safe for concurrent use.
+type Logger struct {
+	core   *core
+	fields []interface{}
+}
+
+// New constructs a logger writing records of the level and above to w.
+func New(w io.Writer, level Level, format Format) *Logger {
+	return &Logger{
+		core: &core{
+			w:      w,
+			level:  level,
+			format: format,
+			now:    time.Now,
+		},
+	}
+}
+
+// SetLevel changes the level of the logger and the loggers derived from it.
+func (l *Logger) SetLevel(level Level) {
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+	l.core.level = level
+}
+
+// SetFormat changes the format of the logger and the loggers derived from it.
+func (l *Logger) SetFormat(format Format) {
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+	l.core.format = format
+}
+
+// Enabled reports whether records of the level are written.
+func (l *Logger) Enabled(level Level) bool {
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+	return level >= l.core.level
+}
+
+// With returns a logger adding the key/value pairs to every record.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+
+	return &Logger{
+		core:   l.core,
+		fields: fields,
+	}
+}
+
+// Debug writes a record for diagnosing problems.
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	l.write(LevelDebug, msg, kv)
+}
+
+// Info writes a record of normal operation.
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	l.write(LevelInfo, msg, kv)
+}
+
+// Warn writes a record of something unexpected the program recovered from.
+func (l *Logger) Warn(msg string, kv ...interface{}) {
+	l.write(LevelWarn, msg, kv)
+}
+
+// Error writes a record of a failure.
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	l.write(LevelError, msg, kv)
+}
+
+func (l *Logger) write(level Level, msg string, kv []interface{}) {
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+
+	if level < l.core.level {
+		return
+	}
+
+	fields := l.fields
+	if len(kv) > 0 {
+		fields = append(fields[:len(fields):len(fields)], kv...)
+	}
+
+	var b bytes.Buffer
+	ts := l.core.now().UTC().Format("2006-01-02T15:04:05.000000Z07:00")
+
+	switch l.core.format {
+	case FormatJSON:
+		b.WriteString(`{"ts":`)
+		writeJSON(&b, ts)
+		b.WriteString(`,"level":`)
+		writeJSON(&b, level.String())
+		b.WriteString(`,"msg":`)
+		writeJSON(&b, msg)
+		for i := 0; i < len(fields); i += 2 {
+			b.WriteByte(',')
+			writeJSON(&b, key(fields, i))
+			b.WriteByte(':')
+			writeJSON(&b, value(fields, i))
+		}
+		b.WriteString("}\n")
+
+	default:
+		fmt.Fprintf(&b, "%s %-5s %s", ts, level, msg)
+		for i := 0; i < len(fields); i += 2 {
+			b.WriteByte(' ')
+			b.WriteString(key(fields, i))
+			b.WriteByte('=')
+			b.WriteString(text(value(fields, i)))
+		}
+		b.WriteByte('\n')
+	}
+
+	l.core.w.Write(b.Bytes())
+}
+
+// key returns the key of the pair starting at i. Keys that aren't strings
+// are formatted so the record is still written.
+func key(fields []interface{}, i int) string {
+	if k, ok := fields[i].(string); ok {
+		return k
+	}
+	return fmt.Sprint(fields[i])
+}
+
+// value returns the value of the pair starting at i, which is missing when
+// an odd number of arguments was passed. Values of sensitive keys are
+// replaced by a placeholder.
+func value(fields []interface{}, i int) interface{} {
+	if i+1 >= len(fields) {
+		return "!MISSING"
+	}
+	if sensitive(key(fields, i)) {
+		return redacted
+	}
+
+	switch v := fields[i+1].(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fields[i+1]
+}
+
+// redacted replaces the values of sensitive keys.
+const redacted = "***"
+
+// sensitiveKeys are the parts of keys whose values are never written.
+var sensitiveKeys = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"authorization",
+	"cookie",
+	"hash",
+	"email",
+}
+
+// sensitive reports whether values of the key must not be written.
+func sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSON writes the value as JSON, falling back to its text form.
+func writeJSON(b *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(data)
+}
+
+// text formats the value for a text record, quoting strings that would be
+// ambiguous otherwise.
+func text(v interface{}) string {
+	s, ok := v.(string)
+	if !ok {
+		s = fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
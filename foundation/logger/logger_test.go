@@ -0,0 +1,139 @@
+package logger_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egorovdmi/financify/foundation/logger"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestJSON(t *testing.T) {
+	t.Log("Given the need to write records a log pipeline can parse.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen writing JSON records.", testID)
+		{
+			var buf bytes.Buffer
+			log := logger.New(&buf, logger.LevelInfo, logger.FormatJSON).With("service", "TEST")
+
+			log.Debug("dropped")
+			log.Info("request completed", "trace_id", "abc", "status", 200, "latency", 1500*time.Millisecond, "error", errors.New("boom"))
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if len(lines) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould drop records below the level : got %d records.", failed, testID, len(lines))
+			}
+			t.Logf("\t%s\tTest %d:\tShould drop records below the level.", success, testID)
+
+			var rec map[string]interface{}
+			if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould write valid JSON: %s.", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould write valid JSON.", success, testID)
+
+			exp := map[string]interface{}{
+				"level":    "INFO",
+				"msg":      "request completed",
+				"service":  "TEST",
+				"trace_id": "abc",
+				"status":   float64(200),
+				"latency":  "1.5s",
+				"error":    "boom",
+			}
+			for k, v := range exp {
+				if rec[k] != v {
+					t.Fatalf("\t%s\tTest %d:\tShould write field %s : got %v want %v.", failed, testID, k, rec[k], v)
+				}
+			}
+			if _, ok := rec["ts"]; !ok {
+				t.Fatalf("\t%s\tTest %d:\tShould write a timestamp.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould write every field.", success, testID)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	t.Log("Given the need to write records people can read.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen writing text records.", testID)
+		{
+			var buf bytes.Buffer
+			log := logger.New(&buf, logger.LevelError, logger.FormatText)
+
+			log.Warn("dropped")
+			log.SetLevel(logger.LevelDebug)
+			log.Debug("query", "op", "User.Query", "query", "SELECT * FROM users", "odd")
+
+			got := strings.TrimSpace(buf.String())
+			exp := `DEBUG query op=User.Query query="SELECT * FROM users" odd=!MISSING`
+			if !strings.HasSuffix(got, exp) || strings.Contains(got, "dropped") {
+				t.Fatalf("\t%s\tTest %d:\tShould write the record : got %q want suffix %q.", failed, testID, got, exp)
+			}
+			t.Logf("\t%s\tTest %d:\tShould write the record.", success, testID)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	t.Log("Given the need to keep secrets out of the logs.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen writing values of sensitive keys.", testID)
+		{
+			secrets := []string{"gophers", "$2a$10$abcdef", "tok-123", "Bearer xyz", "john@example.com"}
+
+			for _, format := range []logger.Format{logger.FormatText, logger.FormatJSON} {
+				var buf bytes.Buffer
+				log := logger.New(&buf, logger.LevelDebug, format).With("Authorization", secrets[3])
+
+				log.Info("login", "password", secrets[0], "password_hash", []byte(secrets[1]), "reset_token", secrets[2], "email", secrets[4], "user_id", "42")
+
+				got := buf.String()
+				for _, s := range secrets {
+					if strings.Contains(got, s) {
+						t.Fatalf("\t%s\tTest %d:\tShould NOT write %q as %s : got %q.", failed, testID, s, format, got)
+					}
+				}
+				if !strings.Contains(got, "42") {
+					t.Fatalf("\t%s\tTest %d:\tShould write other values as %s : got %q.", failed, testID, format, got)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould write a placeholder for sensitive values only.", success, testID)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Log("Given the need to configure logging.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen parsing levels and formats.", testID)
+		{
+			if l, err := logger.ParseLevel("WARN"); err != nil || l != logger.LevelWarn {
+				t.Fatalf("\t%s\tTest %d:\tShould parse a level : got %v, %v.", failed, testID, l, err)
+			}
+			if _, err := logger.ParseLevel("verbose"); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT parse an unknown level.", failed, testID)
+			}
+			if f, err := logger.ParseFormat("JSON"); err != nil || f != logger.FormatJSON {
+				t.Fatalf("\t%s\tTest %d:\tShould parse a format : got %v, %v.", failed, testID, f, err)
+			}
+			if _, err := logger.ParseFormat("xml"); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT parse an unknown format.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould parse known names only.", success, testID)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Package mail provides support for sending emails to users.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/egorovdmi/financify/foundation/logger"
+)
+
+// Message represents a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is the behavior required to deliver emails.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer writes a line for every message into the log instead of sending
+// it. Bodies carry secrets like verification tokens, so only the subject and
+// the domain of the recipient are logged. It is meant for runs without a way
+// to deliver emails.
+type LogMailer struct {
+	log *logger.Logger
+}
+
+// NewLogMailer constructs a mailer writing into the log.
+func NewLogMailer(log *logger.Logger) LogMailer {
+	return LogMailer{log: log}
+}
+
+// Send implements the Mailer interface.
+func (m LogMailer) Send(ctx context.Context, msg Message) error {
+	m.log.Info("mail", "to", maskAddress(msg.To), "subject", msg.Subject)
+	return nil
+}
+
+// maskAddress hides the local part of the email address.
+func maskAddress(addr string) string {
+	i := strings.LastIndex(addr, "@")
+	if i < 0 {
+		return "***"
+	}
+	return "***" + addr[i:]
+}
+
+// FileMailer stores every message as a separate file in a directory instead
+// of sending it. It is meant for local runs and tests.
+type FileMailer struct {
+	dir string
+}
+
+// NewFileMailer constructs a mailer storing messages in the directory.
+func NewFileMailer(dir string) FileMailer {
+	return FileMailer{dir: dir}
+}
+
+// unsafeChars matches everything that shouldn't end up in a file name.
+var unsafeChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]`)
+
+// Send implements the Mailer interface.
+func (m FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("creating mail directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), unsafeChars.ReplaceAllString(msg.To, "_"))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(msg.Body)
+
+	if err := os.WriteFile(filepath.Join(m.dir, name), []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("writing message: %w", err)
+	}
+
+	return nil
+}
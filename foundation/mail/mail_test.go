@@ -0,0 +1,95 @@
+package mail_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/egorovdmi/financify/foundation/logger"
+	"github.com/egorovdmi/financify/foundation/mail"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestFileMailer(t *testing.T) {
+	t.Log("Given the need to store emails on disk for local runs.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen sending a single message.", testID)
+		{
+			dir := filepath.Join(t.TempDir(), "mail")
+			m := mail.NewFileMailer(dir)
+
+			msg := mail.Message{
+				To:      "john@example.com",
+				Subject: "Hello",
+				Body:    "Hello, John.",
+			}
+
+			if err := m.Send(context.Background(), msg); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to send a message: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to send a message.", success, testID)
+
+			files, err := os.ReadDir(dir)
+			if err != nil || len(files) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould find a single file with the message: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould find a single file with the message.", success, testID)
+
+			data, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to read the message: %v", failed, testID, err)
+			}
+
+			for _, want := range []string{"To: john@example.com", "Subject: Hello", "Hello, John."} {
+				if !strings.Contains(string(data), want) {
+					t.Fatalf("\t%s\tTest %d:\tShould find %q in the message.", failed, testID, want)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould find the recipient, subject and body in the message.", success, testID)
+		}
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	t.Log("Given the need to log emails without leaking their content.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen sending a message with a token.", testID)
+		{
+			var buf bytes.Buffer
+			m := mail.NewLogMailer(logger.New(&buf, logger.LevelDebug, logger.FormatText))
+
+			const token = "Vx3q9Zt0oP2kLm8nB4cD6eF1gH5jK7lM9nP0qR2sT4u"
+			msg := mail.Message{
+				To:      "john@example.com",
+				Subject: "Reset your password",
+				Body:    "Use the token below to set a new password:\n\n" + token + "\n",
+			}
+
+			if err := m.Send(context.Background(), msg); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to send a message: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to send a message.", success, testID)
+
+			out := buf.String()
+			if !strings.Contains(out, "Reset your password") || !strings.Contains(out, "@example.com") {
+				t.Fatalf("\t%s\tTest %d:\tShould log the subject and the domain of the recipient : got %q.", failed, testID, out)
+			}
+			t.Logf("\t%s\tTest %d:\tShould log the subject and the domain of the recipient.", success, testID)
+
+			if strings.Contains(out, token) || strings.Contains(out, "john") {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT log the body or the recipient : got %q.", failed, testID, out)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT log the body or the recipient.", success, testID)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+// Package metrics provides counters, gauges and histograms exposed in the
+// Prometheus text format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds, in seconds, of the buckets of a
+// latency histogram.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry the application registers its metrics with.
+var Default = NewRegistry()
+
+// Handler serves the metrics of the default registry.
+func Handler() http.Handler {
+	return Default
+}
+
+// collector writes the samples of a metric family.
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds metrics and writes them in the Prometheus text format. A
+// registry is safe for concurrent use.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+// NewRegistry constructs an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]collector),
+	}
+}
+
+// register adds the collector. Registering a name twice is a programming
+// error.
+func (reg *Registry) register(c collector) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if _, exists := reg.collectors[c.name()]; exists {
+		panic(fmt.Sprintf("metrics: %q registered twice", c.name()))
+	}
+	reg.collectors[c.name()] = c
+}
+
+// WriteText writes every metric sorted by name.
+func (reg *Registry) WriteText(w io.Writer) error {
+	reg.mu.Lock()
+	names := make([]string, 0, len(reg.collectors))
+	for name := range reg.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	collectors := make([]collector, len(names))
+	for i, name := range names {
+		collectors[i] = reg.collectors[name]
+	}
+	reg.mu.Unlock()
+
+	var b bytes.Buffer
+	for _, c := range collectors {
+		c.write(&b)
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (reg *Registry) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", ContentType)
+	reg.WriteText(rw)
+}
+
+// =============================================================================
+
+// desc describes a metric family.
+type desc struct {
+	fqName string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) name() string {
+	return d.fqName
+}
+
+// header writes the HELP and TYPE lines of the family.
+func (d desc) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.fqName, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.fqName, d.kind)
+}
+
+// key joins label values into a map key. Values are checked against the
+// labels of the family.
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %q has %d labels, got %d values", d.fqName, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// series holds the label values of a sample.
+type series struct {
+	key    string
+	values []string
+}
+
+// sortedSeries returns the series of the map in order, so output is stable.
+func sortedSeries(m map[string][]string) []series {
+	s := make([]series, 0, len(m))
+	for k, v := range m {
+		s = append(s, series{key: k, values: v})
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i].key < s[j].key })
+	return s
+}
+
+// =============================================================================
+
+// CounterVec is a family of counters partitioned by label values.
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string][]string
+	counts map[string]float64
+}
+
+// NewCounterVec registers a counter family with the labels.
+func (reg *Registry) NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	c := CounterVec{
+		desc:   desc{fqName: name, help: help, kind: "counter", labels: labels},
+		values: make(map[string][]string),
+		counts: make(map[string]float64),
+	}
+	reg.register(&c)
+	return &c
+}
+
+// Inc adds one to the counter with the label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds n to the counter with the label values. Counters only go up, so
+// negative n is ignored.
+func (c *CounterVec) Add(n float64, values ...string) {
+	if n < 0 {
+		return
+	}
+
+	k := c.key(values)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.values[k]; !exists {
+		c.values[k] = append([]string(nil), values...)
+	}
+	c.counts[k] += n
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.header(w)
+	for _, s := range sortedSeries(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.fqName, labels(c.labels, s.values), number(c.counts[s.key]))
+	}
+}
+
+// =============================================================================
+
+// HistogramVec is a family of histograms partitioned by label values.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string][]string
+	hists   map[string]*histogram
+}
+
+// histogram holds the observations of a series. Bucket counts aren't
+// cumulative, they are added up when written.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec registers a histogram family with the bucket upper bounds
+// and labels. DefaultBuckets are used when none are passed.
+func (reg *Registry) NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := HistogramVec{
+		desc:    desc{fqName: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		values:  make(map[string][]string),
+		hists:   make(map[string]*histogram),
+	}
+	reg.register(&h)
+	return &h
+}
+
+// Observe adds the value to the histogram with the label values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	k := h.key(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hist, exists := h.hists[k]
+	if !exists {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.hists[k] = hist
+		h.values[k] = append([]string(nil), values...)
+	}
+
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		hist.counts[i]++
+	}
+	hist.sum += v
+	hist.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(w)
+
+	le := append(h.labels[:len(h.labels):len(h.labels)], "le")
+	for _, s := range sortedSeries(h.values) {
+		hist := h.hists[s.key]
+
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.fqName, labels(le, append(s.values[:len(s.values):len(s.values)], number(upper))), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.fqName, labels(le, append(s.values[:len(s.values):len(s.values)], "+Inf")), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.fqName, labels(h.labels, s.values), number(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.fqName, labels(h.labels, s.values), hist.count)
+	}
+}
+
+// =============================================================================
+
+// funcMetric is a gauge or counter whose value is read when written.
+type funcMetric struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc registers a gauge reporting the value returned by fn.
+func (reg *Registry) NewGaugeFunc(name string, help string, fn func() float64) {
+	reg.register(&funcMetric{
+		desc: desc{fqName: name, help: help, kind: "gauge"},
+		fn:   fn,
+	})
+}
+
+// NewCounterFunc registers a counter reporting the value returned by fn,
+// which must never go down.
+func (reg *Registry) NewCounterFunc(name string, help string, fn func() float64) {
+	reg.register(&funcMetric{
+		desc: desc{fqName: name, help: help, kind: "counter"},
+		fn:   fn,
+	})
+}
+
+func (f *funcMetric) write(w io.Writer) {
+	f.header(w)
+	fmt.Fprintf(w, "%s %s\n", f.fqName, number(f.fn()))
+}
+
+// =============================================================================
+
+// labels formats label pairs like {method="GET",status="200"}.
+func labels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// number formats a sample value.
+func number(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
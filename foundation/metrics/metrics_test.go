@@ -0,0 +1,74 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/egorovdmi/financify/foundation/metrics"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Log("Given the need to expose metrics in the Prometheus text format.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen writing counters, histograms and gauges.", testID)
+		{
+			reg := metrics.NewRegistry()
+
+			requests := reg.NewCounterVec("requests_total", "Handled requests.", "method", "route")
+			latency := reg.NewHistogramVec("latency_seconds", "Request latency.", []float64{0.5, 0.1}, "route")
+			reg.NewGaugeFunc("open_connections", "Open\nconnections.", func() float64 { return 3 })
+
+			requests.Inc("GET", "/v1/users/:id")
+			requests.Add(2, "GET", "/v1/users/:id")
+			requests.Inc("POST", `/v1/"quoted"`)
+			requests.Add(-1, "POST", `/v1/"quoted"`)
+
+			latency.Observe(0.05, "/v1/users")
+			latency.Observe(0.1, "/v1/users")
+			latency.Observe(0.3, "/v1/users")
+			latency.Observe(2, "/v1/users")
+
+			var buf bytes.Buffer
+			if err := reg.WriteText(&buf); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to write the metrics: %s.", failed, testID, err)
+			}
+
+			exp := `# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/v1/users",le="0.1"} 2
+latency_seconds_bucket{route="/v1/users",le="0.5"} 3
+latency_seconds_bucket{route="/v1/users",le="+Inf"} 4
+latency_seconds_sum{route="/v1/users"} 2.45
+latency_seconds_count{route="/v1/users"} 4
+# HELP open_connections Open\nconnections.
+# TYPE open_connections gauge
+open_connections 3
+# HELP requests_total Handled requests.
+# TYPE requests_total counter
+requests_total{method="GET",route="/v1/users/:id"} 3
+requests_total{method="POST",route="/v1/\"quoted\""} 1
+`
+			if got := buf.String(); got != exp {
+				t.Fatalf("\t%s\tTest %d:\tShould write the metrics : got\n%s\nwant\n%s", failed, testID, got, exp)
+			}
+			t.Logf("\t%s\tTest %d:\tShould write the metrics.", success, testID)
+
+			rw := httptest.NewRecorder()
+			reg.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			if rw.Header().Get("Content-Type") != metrics.ContentType || !strings.Contains(rw.Body.String(), "open_connections 3") {
+				t.Fatalf("\t%s\tTest %d:\tShould serve the metrics : got %q, %q.", failed, testID, rw.Header().Get("Content-Type"), rw.Body.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould serve the metrics.", success, testID)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+// Package oidc provides support for logging users in with an OpenID Connect
+// provider using the authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidToken is returned when an ID token fails verification.
+var ErrInvalidToken = errors.New("invalid id token")
+
+// Config contains the client registration at the provider.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Discovery is the subset of the provider metadata used by the flow.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDClaims are the claims of a verified ID token.
+type IDClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// Provider talks to a single OpenID Connect provider.
+type Provider struct {
+	cfg       Config
+	discovery Discovery
+	client    *http.Client
+	parser    *jwt.Parser
+
+	mu   sync.RWMutex
+	keys map[string]*rsa.PublicKey
+}
+
+// New discovers the provider metadata from the issuer's well-known endpoint.
+func New(ctx context.Context, cfg Config, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	p := Provider{
+		cfg:    cfg,
+		client: client,
+		parser: &jwt.Parser{ValidMethods: []string{"RS256"}},
+		keys:   make(map[string]*rsa.PublicKey),
+	}
+
+	wellKnown := strings.TrimSuffix(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &p.discovery); err != nil {
+		return nil, errors.Wrap(err, "discovering provider")
+	}
+
+	if p.discovery.Issuer != cfg.Issuer {
+		return nil, errors.Errorf("issuer mismatch: configured %q, discovered %q", cfg.Issuer, p.discovery.Issuer)
+	}
+
+	return &p, nil
+}
+
+// Issuer returns the identifier of the provider.
+func (p *Provider) Issuer() string {
+	return p.discovery.Issuer
+}
+
+// AuthCodeURL returns the URL of the provider's login page for the flow
+// identified by the state, binding the code to the verifier via PKCE.
+func (p *Provider) AuthCodeURL(state string, nonce string, verifier string) string {
+	v := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(p.discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return p.discovery.AuthorizationEndpoint + sep + v.Encode()
+}
+
+// Exchange trades the authorization code for the raw ID token.
+func (p *Provider) Exchange(ctx context.Context, code string, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, "creating token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "requesting token")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", errors.Errorf("token endpoint returned %d: %s", resp.StatusCode, body)
+	}
+
+	var tr struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", errors.Wrap(err, "decoding token response")
+	}
+
+	if tr.IDToken == "" {
+		return "", errors.New("token response without id_token")
+	}
+
+	return tr.IDToken, nil
+}
+
+// Verify checks the signature of the ID token against the provider's keys,
+// its issuer, audience, expiry and that it was issued for the nonce.
+func (p *Provider) Verify(ctx context.Context, rawIDToken string, nonce string) (IDClaims, error) {
+	var claims IDClaims
+	keyFunc := func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.PublicKey(ctx, kid)
+	}
+
+	token, err := p.parser.ParseWithClaims(rawIDToken, &claims, keyFunc)
+	if err != nil || !token.Valid {
+		return IDClaims{}, errors.Wrap(ErrInvalidToken, fmt.Sprint(err))
+	}
+
+	switch {
+	case !claims.VerifyIssuer(p.discovery.Issuer, true):
+		return IDClaims{}, errors.Wrap(ErrInvalidToken, "issuer mismatch")
+	case !claims.VerifyAudience(p.cfg.ClientID, true):
+		return IDClaims{}, errors.Wrap(ErrInvalidToken, "audience mismatch")
+	case claims.ExpiresAt == nil:
+		return IDClaims{}, errors.Wrap(ErrInvalidToken, "missing expiry")
+	case claims.Nonce != nonce:
+		return IDClaims{}, errors.Wrap(ErrInvalidToken, "nonce mismatch")
+	case claims.Subject == "":
+		return IDClaims{}, errors.Wrap(ErrInvalidToken, "missing subject")
+	}
+
+	return claims, nil
+}
+
+// PublicKey looks up the provider key with the specified id. The key set is
+// fetched again for unknown ids so rotated keys are picked up.
+func (p *Provider) PublicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.RLock()
+	key, ok := p.keys[kid]
+	p.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.discovery.JWKSURI, &jwks); err != nil {
+		return nil, errors.Wrap(err, "fetching key set")
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding modulus of key %q", k.Kid)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding exponent of key %q", k.Kid)
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	key, ok = keys[kid]
+	if !ok {
+		return nil, errors.Errorf("no public key found for the specified kid: %s", kid)
+	}
+
+	return key, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// =============================================================================
+
+// NewVerifier generates a random PKCE code verifier.
+func NewVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "reading random bytes")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge derives the S256 PKCE code challenge of the verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,151 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/egorovdmi/financify/foundation/oidc"
+	"github.com/egorovdmi/financify/foundation/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestProvider(t *testing.T) {
+	fake, err := oidctest.NewProvider("financify", "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(fake.Close)
+
+	fake.Login(oidctest.Identity{Subject: "42", Email: "jane@corp.example.com", EmailVerified: true, Name: "Jane"})
+
+	ctx := context.Background()
+	cfg := oidc.Config{
+		Issuer:       fake.URL,
+		ClientID:     "financify",
+		ClientSecret: "s3cr3t",
+		RedirectURL:  "http://localhost:3000/v1/oidc/callback",
+	}
+
+	// The client mustn't follow the redirect back to the application.
+	browser := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	t.Log("Given the need to log in with an OpenID Connect provider.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen running the authorization code flow.", testID)
+		{
+			p, err := oidc.New(ctx, cfg, nil)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to discover the provider: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to discover the provider.", success, testID)
+
+			verifier, err := oidc.NewVerifier()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := browser.Get(p.AuthCodeURL("state-1", "nonce-1", verifier))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			callback, err := url.Parse(resp.Header.Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if callback.Query().Get("state") != "state-1" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the state back : got %q.", failed, testID, callback.Query().Get("state"))
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the state back.", success, testID)
+
+			code := callback.Query().Get("code")
+			if _, err := p.Exchange(ctx, code, "wrong verifier"); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT exchange the code without the right verifier.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT exchange the code without the right verifier.", success, testID)
+
+			resp, err = browser.Get(p.AuthCodeURL("state-2", "nonce-2", verifier))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			callback, _ = url.Parse(resp.Header.Get("Location"))
+
+			rawIDToken, err := p.Exchange(ctx, callback.Query().Get("code"), verifier)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould exchange the code for an ID token: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould exchange the code for an ID token.", success, testID)
+
+			if _, err := p.Verify(ctx, rawIDToken, "nonce-1"); errors.Cause(err) != oidc.ErrInvalidToken {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept the ID token for another nonce: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT accept the ID token for another nonce.", success, testID)
+
+			claims, err := p.Verify(ctx, rawIDToken, "nonce-2")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould verify the ID token: %v", failed, testID, err)
+			}
+			if claims.Subject != "42" || claims.Email != "jane@corp.example.com" || !claims.EmailVerified {
+				t.Fatalf("\t%s\tTest %d:\tShould get the identity from the ID token : got %+v.", failed, testID, claims)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the identity from the ID token.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen verifying forged ID tokens.", testID)
+		{
+			p, err := oidc.New(ctx, cfg, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			now := time.Now()
+			valid := oidc.IDClaims{
+				RegisteredClaims: jwt.RegisteredClaims{
+					Issuer:    fake.URL,
+					Subject:   "42",
+					Audience:  jwt.ClaimStrings{"financify"},
+					ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+				},
+				Nonce: "nonce",
+			}
+
+			otherAudience := valid
+			otherAudience.Audience = jwt.ClaimStrings{"someone-else"}
+
+			otherIssuer := valid
+			otherIssuer.Issuer = "https://evil.example.com"
+
+			expired := valid
+			expired.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute))
+
+			for name, claims := range map[string]oidc.IDClaims{"another audience": otherAudience, "another issuer": otherIssuer, "an expired token": expired} {
+				raw, err := fake.SignIDToken(claims)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := p.Verify(ctx, raw, "nonce"); errors.Cause(err) != oidc.ErrInvalidToken {
+					t.Fatalf("\t%s\tTest %d:\tShould NOT accept %s: %v", failed, testID, name, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould NOT accept %s.", success, testID, name)
+			}
+		}
+	}
+}
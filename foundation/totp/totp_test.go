@@ -0,0 +1,107 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egorovdmi/financify/foundation/totp"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+// secret is the SHA1 seed used by the test vectors in RFC 6238 appendix B.
+var secret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// The RFC lists 8 digit codes, the last 6 digits are the 6 digit codes.
+	table := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	t.Log("Given the need to generate codes compatible with authenticator apps.")
+	{
+		for testID, tt := range table {
+			t.Logf("\tTest %d:\tWhen generating the code at %d.", testID, tt.unix)
+			{
+				got, err := totp.Code(secret, totp.Step(time.Unix(tt.unix, 0)))
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to generate a code: %v", failed, testID, err)
+				}
+
+				if got != tt.code {
+					t.Fatalf("\t%s\tTest %d:\tShould get the code from the RFC : got %s want %s.", failed, testID, got, tt.code)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get the code from the RFC.", success, testID)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Log("Given the need to validate codes entered by users.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen validating codes around the current time.", testID)
+		{
+			s, err := totp.GenerateSecret()
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a secret: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to generate a secret.", success, testID)
+
+			now := time.Now()
+			code, err := totp.Code(s, totp.Step(now))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a code: %v", failed, testID, err)
+			}
+
+			step, ok := totp.Validate(s, code, now, 1)
+			if !ok || step != totp.Step(now) {
+				t.Fatalf("\t%s\tTest %d:\tShould accept the current code.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept the current code.", success, testID)
+
+			if _, ok := totp.Validate(s, code, now.Add(totp.Period), 1); !ok {
+				t.Fatalf("\t%s\tTest %d:\tShould accept the code one step later.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept the code one step later.", success, testID)
+
+			if _, ok := totp.Validate(s, code, now.Add(3*totp.Period), 1); ok {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept the code three steps later.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT accept the code three steps later.", success, testID)
+
+			if _, ok := totp.Validate(s, "12345", now, 1); ok {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept a code of the wrong length.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT accept a code of the wrong length.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen building the enrollment URI.", testID)
+		{
+			uri := totp.URI("Financify", "john@example.com", "JBSWY3DPEHPK3PXP")
+
+			for _, want := range []string{"otpauth://totp/Financify:john@example.com", "secret=JBSWY3DPEHPK3PXP", "issuer=Financify", "digits=6", "period=30"} {
+				if !strings.Contains(uri, want) {
+					t.Fatalf("\t%s\tTest %d:\tShould find %q in %s.", failed, testID, want, uri)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould build a URI understood by authenticator apps.", success, testID)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Package tracing configures OpenTelemetry with the exporter selected by
+// configuration.
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+// Set of supported exporters.
+const (
+	ExporterZipkin   = "zipkin"
+	ExporterOTLPHTTP = "otlp-http"
+	ExporterOTLPGRPC = "otlp-grpc"
+	ExporterStdout   = "stdout"
+	ExporterNone     = "none"
+)
+
+// Default endpoints of the collectors, used when none is configured.
+const (
+	DefaultZipkinEndpoint   = "http://localhost:9411/api/v2/spans"
+	DefaultOTLPHTTPEndpoint = "http://localhost:4318/v1/traces"
+	DefaultOTLPGRPCEndpoint = "http://localhost:4317"
+)
+
+// ErrUnknownExporter is returned when the configured exporter isn't one of
+// the supported ones.
+var ErrUnknownExporter = errors.New("unknown trace exporter")
+
+// Config describes where and how often spans are exported.
+type Config struct {
+	ServiceName string
+	Exporter    string
+	Endpoint    string
+	Probability float64
+
+	// Stdout is where the stdout exporter writes spans. It defaults to
+	// os.Stdout.
+	Stdout io.Writer
+}
+
+// Start constructs a tracer provider exporting spans as configured and
+// installs it, along with the W3C trace context and baggage propagators, as
+// the global one. With the none exporter spans still get IDs so requests can
+// be correlated in logs, but they are never recorded or sent anywhere.
+func Start(cfg Config) (*trace.TracerProvider, error) {
+	exporter, err := newExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []trace.TracerProviderOption{
+		trace.WithResource(
+			resource.NewWithAttributes(
+				semconv.SchemaURL,
+				semconv.ServiceNameKey.String(cfg.ServiceName),
+				attribute.String("exporter", cfg.Exporter),
+			),
+		),
+	}
+
+	if exporter == nil {
+		opts = append(opts, trace.WithSampler(trace.NeverSample()))
+	} else {
+		opts = append(opts,
+			trace.WithSampler(trace.ParentBased(trace.TraceIDRatioBased(cfg.Probability))),
+			trace.WithBatcher(exporter),
+		)
+	}
+
+	traceProvider := trace.NewTracerProvider(opts...)
+
+	// I can only get this working properly using the singleton :(
+	otel.SetTracerProvider(traceProvider)
+	otel.SetTextMapPropagator(Propagator())
+
+	return traceProvider, nil
+}
+
+// Propagator returns the propagator reading and writing the W3C traceparent,
+// tracestate and baggage headers.
+func Propagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
+
+// newExporter constructs the configured exporter. It returns a nil exporter
+// when tracing is disabled.
+func newExporter(cfg Config) (trace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case ExporterZipkin:
+		endpoint := cfg.Endpoint
+		if endpoint == "" {
+			endpoint = DefaultZipkinEndpoint
+		}
+		exporter, err := zipkin.New(endpoint)
+		if err != nil {
+			return nil, errors.Wrap(err, "creating zipkin exporter")
+		}
+		return exporter, nil
+
+	case ExporterOTLPHTTP:
+		u, err := parseEndpoint(cfg.Endpoint, DefaultOTLPHTTPEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+		if u.Path != "" {
+			opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+		}
+		if u.Scheme == "http" {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			return nil, errors.Wrap(err, "creating otlp http exporter")
+		}
+		return exporter, nil
+
+	case ExporterOTLPGRPC:
+		u, err := parseEndpoint(cfg.Endpoint, DefaultOTLPGRPCEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(u.Host)}
+		if u.Scheme == "http" {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err := otlptracegrpc.New(context.Background(), opts...)
+		if err != nil {
+			return nil, errors.Wrap(err, "creating otlp grpc exporter")
+		}
+		return exporter, nil
+
+	case ExporterStdout:
+		w := cfg.Stdout
+		if w == nil {
+			w = os.Stdout
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(w))
+		if err != nil {
+			return nil, errors.Wrap(err, "creating stdout exporter")
+		}
+		return exporter, nil
+
+	case ExporterNone:
+		return nil, nil
+	}
+
+	return nil, errors.Wrapf(ErrUnknownExporter, "%q", cfg.Exporter)
+}
+
+// parseEndpoint parses the endpoint of an OTLP collector, falling back to
+// the default one. Plain http endpoints are reached without TLS.
+func parseEndpoint(endpoint string, def string) (*url.URL, error) {
+	if endpoint == "" {
+		endpoint = def
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing endpoint %q", endpoint)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.Errorf("endpoint %q must be an http or https URL", endpoint)
+	}
+
+	return u, nil
+}
@@ -0,0 +1,223 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/egorovdmi/financify/foundation/tracing"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+// span is the part of a span written by the stdout exporter the tests look at.
+type span struct {
+	Name        string
+	SpanContext struct {
+		TraceID string
+	}
+	Attributes []struct {
+		Key   string
+		Value struct {
+			Type  string
+			Value interface{}
+		}
+	}
+	Status struct {
+		Code        string
+		Description string
+	}
+}
+
+func TestExporters(t *testing.T) {
+	t.Log("Given the need to export spans to the configured destination.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen exporting to stdout.", testID)
+		{
+			var buf bytes.Buffer
+			tp, err := tracing.Start(tracing.Config{ServiceName: "test", Exporter: tracing.ExporterStdout, Probability: 1, Stdout: &buf})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to start tracing: %s.", failed, testID, err)
+			}
+
+			_, s := tp.Tracer("test").Start(context.Background(), "work")
+			s.SetAttributes(attribute.Int("rows", 3))
+			s.SetStatus(codes.Error, "boom")
+			s.End()
+			tp.Shutdown(context.Background())
+
+			var got span
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould write the span as JSON: %s : got %q.", failed, testID, err, buf.String())
+			}
+			if got.Name != "work" || got.SpanContext.TraceID != s.SpanContext().TraceID().String() || got.Status.Code != "Error" || got.Status.Description != "boom" {
+				t.Fatalf("\t%s\tTest %d:\tShould write the span : got %+v.", failed, testID, got)
+			}
+			if len(got.Attributes) != 1 || got.Attributes[0].Key != "rows" || got.Attributes[0].Value.Value != 3.0 {
+				t.Fatalf("\t%s\tTest %d:\tShould write the attributes : got %+v.", failed, testID, got.Attributes)
+			}
+			t.Logf("\t%s\tTest %d:\tShould write the span.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen exporting to an OTLP collector over HTTP.", testID)
+		{
+			var body []byte
+			var contentType string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentType = r.Header.Get("Content-Type")
+				body, _ = ioutil.ReadAll(r.Body)
+			}))
+			defer srv.Close()
+
+			tp, err := tracing.Start(tracing.Config{ServiceName: "test", Exporter: tracing.ExporterOTLPHTTP, Endpoint: srv.URL, Probability: 1})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to start tracing: %s.", failed, testID, err)
+			}
+
+			ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+			_, child := tp.Tracer("test").Start(ctx, "child")
+			child.End()
+			parent.End()
+			tp.Shutdown(context.Background())
+
+			var req coltracepb.ExportTraceServiceRequest
+			if err := proto.Unmarshal(body, &req); err != nil || contentType != "application/x-protobuf" {
+				t.Fatalf("\t%s\tTest %d:\tShould post protobuf: %v : got %q.", failed, testID, err, contentType)
+			}
+			checkExport(t, testID, &req)
+			t.Logf("\t%s\tTest %d:\tShould post the spans to the collector.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen exporting to an OTLP collector over gRPC.", testID)
+		{
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var col collector
+			srv := grpc.NewServer()
+			coltracepb.RegisterTraceServiceServer(srv, &col)
+			go srv.Serve(lis)
+			defer srv.Stop()
+
+			tp, err := tracing.Start(tracing.Config{ServiceName: "test", Exporter: tracing.ExporterOTLPGRPC, Endpoint: "http://" + lis.Addr().String(), Probability: 1})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to start tracing: %s.", failed, testID, err)
+			}
+
+			ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+			_, child := tp.Tracer("test").Start(ctx, "child")
+			child.End()
+			parent.End()
+			if err := tp.Shutdown(context.Background()); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould export the spans: %s.", failed, testID, err)
+			}
+
+			col.mu.Lock()
+			defer col.mu.Unlock()
+			if len(col.reqs) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould make one export request : got %d.", failed, testID, len(col.reqs))
+			}
+			checkExport(t, testID, col.reqs[0])
+			t.Logf("\t%s\tTest %d:\tShould send the spans to the collector.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen tracing is disabled.", testID)
+		{
+			tp, err := tracing.Start(tracing.Config{ServiceName: "test", Exporter: tracing.ExporterNone, Probability: 1})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to start tracing: %s.", failed, testID, err)
+			}
+
+			_, s := tp.Tracer("test").Start(context.Background(), "work")
+			s.End()
+			if !s.SpanContext().TraceID().IsValid() || s.IsRecording() || s.SpanContext().IsSampled() {
+				t.Fatalf("\t%s\tTest %d:\tShould get IDs for spans that are never recorded : got %v.", failed, testID, s.SpanContext())
+			}
+			t.Logf("\t%s\tTest %d:\tShould get IDs for spans that are never recorded.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the exporter isn't supported.", testID)
+		{
+			if _, err := tracing.Start(tracing.Config{Exporter: "jaeger"}); errors.Cause(err) != tracing.ErrUnknownExporter {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT start with an unknown exporter : got %v.", failed, testID, err)
+			}
+			if _, err := tracing.Start(tracing.Config{Exporter: tracing.ExporterOTLPGRPC, Endpoint: "localhost:4317"}); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT start with an endpoint that isn't a URL.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT start.", success, testID)
+		}
+	}
+}
+
+// checkExport makes sure the request carries the parent and child spans of
+// the test service.
+func checkExport(t *testing.T, testID int, req *coltracepb.ExportTraceServiceRequest) {
+	t.Helper()
+
+	rs := req.GetResourceSpans()
+	if len(rs) != 1 || len(rs[0].GetScopeSpans()) != 1 || len(rs[0].GetScopeSpans()[0].GetSpans()) != 2 {
+		t.Fatalf("\t%s\tTest %d:\tShould group the spans by resource and scope : got %v.", failed, testID, req)
+	}
+
+	var child, parent *tracepb.Span
+	for _, s := range rs[0].GetScopeSpans()[0].GetSpans() {
+		switch s.GetName() {
+		case "child":
+			child = s
+		case "parent":
+			parent = s
+		}
+	}
+	if child == nil || parent == nil || !bytes.Equal(child.GetParentSpanId(), parent.GetSpanId()) || len(parent.GetParentSpanId()) != 0 {
+		t.Fatalf("\t%s\tTest %d:\tShould link the child to its parent : got %v.", failed, testID, req)
+	}
+
+	var service string
+	for _, a := range rs[0].GetResource().GetAttributes() {
+		if a.GetKey() == "service.name" {
+			service = a.GetValue().GetStringValue()
+		}
+	}
+	if service != "test" {
+		t.Fatalf("\t%s\tTest %d:\tShould send the service name : got %q.", failed, testID, service)
+	}
+}
+
+// collector records the export requests it receives over gRPC.
+type collector struct {
+	coltracepb.UnimplementedTraceServiceServer
+
+	mu   sync.Mutex
+	reqs []*coltracepb.ExportTraceServiceRequest
+}
+
+func (c *collector) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.reqs = append(c.reqs, req)
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
@@ -9,11 +9,6 @@ type FieldError struct {
 	Error string `json:"error"`
 }
 
-type ErrorResponse struct {
-	Error  string       `json:"error"`
-	Fields []FieldError `json:"fields,omitempty"`
-}
-
 type Error struct {
 	Err    error
 	Status int
@@ -28,6 +23,30 @@ func (err *Error) Error() string {
 	return err.Err.Error()
 }
 
+// writeError is a failure to send a response, usually because the client went
+// away. The response can't be fixed but the app is fine.
+type writeError struct {
+	err error
+}
+
+// NewWriteError wraps a failure to write a response.
+func NewWriteError(err error) error {
+	return &writeError{err}
+}
+
+func (we *writeError) Error() string {
+	return "writing response: " + we.err.Error()
+}
+
+// IsWriteError reports whether the error is a failure to write a response.
+func IsWriteError(err error) bool {
+	_, ok := errors.Cause(err).(*writeError)
+	return ok
+}
+
+// shutdown is an integrity failure the app can't recover from, like a
+// request missing the values set by the app. It's the only kind of error
+// shutting the app down.
 type shutdown struct {
 	Message string
 }
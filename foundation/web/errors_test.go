@@ -0,0 +1,157 @@
+package web_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/egorovdmi/financify/foundation/metrics"
+	"github.com/egorovdmi/financify/foundation/web"
+	"github.com/pkg/errors"
+)
+
+// brokenWriter fails writing bodies like a connection the client closed.
+type brokenWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (bw brokenWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+// handlerErrors returns how many errors of the kind handlers returned to apps.
+func handlerErrors(t *testing.T, kind string) int {
+	var buf bytes.Buffer
+	metrics.Default.WriteText(&buf)
+
+	prefix := `http_handler_errors_total{kind="` + kind + `"} `
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			n, err := strconv.Atoi(strings.TrimPrefix(line, prefix))
+			if err != nil {
+				t.Fatalf("parsing %q: %s", line, err)
+			}
+			return n
+		}
+	}
+	return 0
+}
+
+func TestHandlerErrors(t *testing.T) {
+	tt := []struct {
+		name     string
+		handler  web.Handler
+		writer   func(rw *httptest.ResponseRecorder) http.ResponseWriter
+		kind     string
+		shutdown bool
+	}{
+		{
+			name: "an integrity failure",
+			handler: func(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+				return errors.Wrap(web.NewShutdownError("values missing"), "checking request")
+			},
+			kind:     "shutdown",
+			shutdown: true,
+		},
+		{
+			name: "a response the client went away from",
+			handler: func(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+				return web.Respond(ctx, rw, struct{ Name string }{"Bill"}, http.StatusOK)
+			},
+			writer: func(rw *httptest.ResponseRecorder) http.ResponseWriter {
+				return brokenWriter{rw}
+			},
+			kind: "write",
+		},
+		{
+			name: "an error no middleware handled",
+			handler: func(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+				return errors.New("boom")
+			},
+			kind: "unhandled",
+		},
+	}
+
+	t.Log("Given the need to keep serving after a request fails.")
+	{
+		for testID, tst := range tt {
+			t.Logf("\tTest %d:\tWhen a handler returns %s.", testID, tst.name)
+			{
+				shutdown := make(chan os.Signal, 1)
+				app := web.NewApp(shutdown)
+				app.Handle(http.MethodGet, "/", tst.handler)
+
+				before := handlerErrors(t, tst.kind)
+
+				rec := httptest.NewRecorder()
+				var rw http.ResponseWriter = rec
+				if tst.writer != nil {
+					rw = tst.writer(rec)
+				}
+				app.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+				var got bool
+				select {
+				case sig := <-shutdown:
+					got = sig == syscall.SIGTERM
+				default:
+				}
+				if got != tst.shutdown {
+					t.Fatalf("\t%s\tTest %d:\tShould shut down only on integrity failures : got %v want %v.", failed, testID, got, tst.shutdown)
+				}
+				t.Logf("\t%s\tTest %d:\tShould shut down only on integrity failures.", success, testID)
+
+				if after := handlerErrors(t, tst.kind); after != before+1 {
+					t.Fatalf("\t%s\tTest %d:\tShould count the error as %s : got %d want %d.", failed, testID, tst.kind, after, before+1)
+				}
+				t.Logf("\t%s\tTest %d:\tShould count the error as %s.", success, testID, tst.kind)
+			}
+		}
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	t.Log("Given the need to tell kinds of errors apart.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen responding to a client that went away.", testID)
+		{
+			ctx := context.WithValue(context.Background(), web.KeyValues, &web.Values{})
+			err := web.Respond(ctx, brokenWriter{httptest.NewRecorder()}, "data", http.StatusOK)
+
+			if !web.IsWriteError(err) || web.IsShutdown(err) {
+				t.Fatalf("\t%s\tTest %d:\tShould get a write error : got %v.", failed, testID, err)
+			}
+			if !web.IsWriteError(errors.Wrap(err, "responding")) {
+				t.Fatalf("\t%s\tTest %d:\tShould get a write error through wrapping.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get a write error.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the request values are missing.", testID)
+		{
+			err := web.Respond(context.Background(), httptest.NewRecorder(), "data", http.StatusOK)
+			if !web.IsShutdown(err) || web.IsWriteError(err) {
+				t.Fatalf("\t%s\tTest %d:\tShould get a shutdown error : got %v.", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get a shutdown error.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a handler fails a request.", testID)
+		{
+			err := web.NewRequestError(errors.New("bad input"), http.StatusBadRequest)
+			if web.IsShutdown(err) || web.IsWriteError(err) {
+				t.Fatalf("\t%s\tTest %d:\tShould get neither a shutdown nor a write error : got %v.", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get neither a shutdown nor a write error.", success, testID)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Tagger is implemented by resources that carry an entity tag identifying
+// their current version. Respond sends the tag in the ETag header.
+type Tagger interface {
+	ETag() string
+}
+
+// NotModified reports if the If-None-Match header of the request lists the
+// entity tag, meaning the copy the client holds is current. Weak tags match
+// too as required for GET requests.
+func NotModified(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	for _, tag := range parseTags(header) {
+		if strings.TrimPrefix(tag, "W/") == quote(etag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IfMatch returns the entity tag the client expects the resource to have
+// from the If-Match header, without quotes. It's empty when the header is
+// missing or accepts any version. Only the first of several listed tags is
+// considered. A weak tag can never match, so it's returned with its prefix to
+// fail the comparison.
+func IfMatch(r *http.Request) string {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return ""
+	}
+
+	tags := parseTags(header)
+	if len(tags) == 0 {
+		return header
+	}
+
+	return strings.Trim(tags[0], `"`)
+}
+
+// parseTags splits the comma separated list of entity tags of a header.
+func parseTags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// quote turns the value into a strong entity tag.
+func quote(etag string) string {
+	return `"` + etag + `"`
+}
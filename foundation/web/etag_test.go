@@ -0,0 +1,117 @@
+package web_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/egorovdmi/financify/foundation/web"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+type tagged struct {
+	Name string `json:"name"`
+}
+
+func (t tagged) ETag() string {
+	return "7"
+}
+
+func TestNotModified(t *testing.T) {
+	table := []struct {
+		header string
+		exp    bool
+	}{
+		{"", false},
+		{`"7"`, true},
+		{`W/"7"`, true},
+		{`"6", "7"`, true},
+		{`"6"`, false},
+		{`7`, false},
+		{`*`, true},
+	}
+
+	t.Log("Given the need to tell if the copy of a client is current.")
+	{
+		for testID, tt := range table {
+			t.Logf("\tTest %d:\tWhen If-None-Match is %q.", testID, tt.header)
+			{
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				if tt.header != "" {
+					r.Header.Set("If-None-Match", tt.header)
+				}
+
+				if got := web.NotModified(r, "7"); got != tt.exp {
+					t.Fatalf("\t%s\tTest %d:\tShould get %v : got %v.", failed, testID, tt.exp, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get %v.", success, testID, tt.exp)
+			}
+		}
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	table := []struct {
+		header string
+		exp    string
+	}{
+		{"", ""},
+		{"*", ""},
+		{`"7"`, "7"},
+		{`"7", "8"`, "7"},
+		{`W/"7"`, `W/"7`},
+	}
+
+	t.Log("Given the need to read the version a client expects.")
+	{
+		for testID, tt := range table {
+			t.Logf("\tTest %d:\tWhen If-Match is %q.", testID, tt.header)
+			{
+				r := httptest.NewRequest(http.MethodPut, "/", nil)
+				if tt.header != "" {
+					r.Header.Set("If-Match", tt.header)
+				}
+
+				if got := web.IfMatch(r); got != tt.exp {
+					t.Fatalf("\t%s\tTest %d:\tShould get %q : got %q.", failed, testID, tt.exp, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get %q.", success, testID, tt.exp)
+			}
+		}
+	}
+}
+
+func TestRespondETag(t *testing.T) {
+	t.Log("Given the need to tag responses with the version of a resource.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen responding with a tagged resource.", testID)
+		{
+			ctx := context.WithValue(context.Background(), web.KeyValues, &web.Values{})
+
+			w := httptest.NewRecorder()
+			if err := web.Respond(ctx, w, &tagged{Name: "wallet"}, http.StatusOK); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to respond: %s.", failed, testID, err)
+			}
+			if got := w.Header().Get("ETag"); got != `"7"` {
+				t.Fatalf("\t%s\tTest %d:\tShould send the ETag header : got %q.", failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould send the ETag header.", success, testID)
+
+			w = httptest.NewRecorder()
+			if err := web.Respond(ctx, w, &tagged{Name: "wallet"}, http.StatusNotModified); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to respond: %s.", failed, testID, err)
+			}
+			if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != `"7"` {
+				t.Fatalf("\t%s\tTest %d:\tShould send a tagged 304 without a body : got %d %q.", failed, testID, w.Code, w.Body.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould send a tagged 304 without a body.", success, testID)
+		}
+	}
+}
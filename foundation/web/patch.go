@@ -0,0 +1,112 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// MergePatchType is the media type of an RFC 7396 merge patch.
+const MergePatchType = "application/merge-patch+json"
+
+// Patch applies the merge patch in the body of the request to the JSON
+// representation of current and returns the patched value once it passes the
+// check. Members set to null in the patch are removed, which leaves the zero
+// value in the result, so required fields are caught by the check.
+//
+// Malformed patches and patches introducing unknown fields are request
+// errors. The error of the check is returned as is.
+func Patch[T any](r *http.Request, current T, check func(any) error) (T, error) {
+	var patched T
+
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil || (mt != MergePatchType && mt != "application/json") {
+			return patched, NewRequestError(errors.Errorf("content type must be %s", MergePatchType), http.StatusUnsupportedMediaType)
+		}
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		return patched, errors.Wrap(err, "reading patch")
+	}
+
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return patched, errors.Wrap(err, "marshaling current value")
+	}
+
+	doc, err = MergePatch(doc, patch)
+	if err != nil {
+		return patched, NewRequestError(err, http.StatusBadRequest)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patched); err != nil {
+		return patched, NewRequestError(errors.Wrap(err, "applying patch"), http.StatusBadRequest)
+	}
+
+	if err := check(patched); err != nil {
+		return patched, err
+	}
+
+	return patched, nil
+}
+
+// MergePatch applies the RFC 7396 merge patch to the JSON document and
+// returns the patched document.
+func MergePatch(doc []byte, patch []byte) ([]byte, error) {
+	var d interface{}
+	if err := unmarshal(doc, &d); err != nil {
+		return nil, errors.Wrap(err, "decoding document")
+	}
+
+	var p interface{}
+	if err := unmarshal(patch, &p); err != nil {
+		return nil, errors.Wrap(err, "decoding patch")
+	}
+
+	return json.Marshal(mergePatch(d, p))
+}
+
+// mergePatch implements the MergePatch function of RFC 7396 section 2.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+			continue
+		}
+		t[name] = mergePatch(t[name], value)
+	}
+
+	return t
+}
+
+// unmarshal decodes a single JSON value keeping numbers as they were sent.
+func unmarshal(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after the JSON value")
+	}
+
+	return nil
+}
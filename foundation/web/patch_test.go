@@ -0,0 +1,123 @@
+package web_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/egorovdmi/financify/foundation/web"
+)
+
+func TestMergePatch(t *testing.T) {
+
+	// The examples of RFC 7396 appendix A.
+	table := []struct {
+		doc   string
+		patch string
+		exp   string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	t.Log("Given the need to apply merge patches.")
+	{
+		for testID, tt := range table {
+			t.Logf("\tTest %d:\tWhen applying %s to %s.", testID, tt.patch, tt.doc)
+			{
+				got, err := web.MergePatch([]byte(tt.doc), []byte(tt.patch))
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to apply the patch: %s.", failed, testID, err)
+				}
+				if string(got) != tt.exp {
+					t.Fatalf("\t%s\tTest %d:\tShould get %s : got %s.", failed, testID, tt.exp, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get %s.", success, testID, tt.exp)
+			}
+		}
+	}
+}
+
+type document struct {
+	Name  string `json:"name"`
+	Notes string `json:"notes"`
+}
+
+func checkDocument(v any) error {
+	if v.(document).Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func TestPatch(t *testing.T) {
+	current := document{Name: "Cash", Notes: "wallet"}
+
+	table := []struct {
+		name        string
+		contentType string
+		patch       string
+		exp         document
+		status      int
+		checkFailed bool
+	}{
+		{"changing a field", web.MergePatchType, `{"name":"Bank"}`, document{Name: "Bank", Notes: "wallet"}, 0, false},
+		{"clearing a field", web.MergePatchType, `{"notes":null}`, document{Name: "Cash"}, 0, false},
+		{"clearing a required field", web.MergePatchType, `{"name":null}`, document{}, 0, true},
+		{"adding an unknown field", web.MergePatchType, `{"id":"1"}`, document{}, http.StatusBadRequest, false},
+		{"sending malformed JSON", web.MergePatchType, `{"name":`, document{}, http.StatusBadRequest, false},
+		{"sending a JSON patch", "application/json-patch+json", `[]`, document{}, http.StatusUnsupportedMediaType, false},
+	}
+
+	t.Log("Given the need to patch values from requests.")
+	{
+		for testID, tt := range table {
+			t.Logf("\tTest %d:\tWhen %s.", testID, tt.name)
+			{
+				r := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(tt.patch))
+				r.Header.Set("Content-Type", tt.contentType)
+
+				got, err := web.Patch(r, current, checkDocument)
+
+				switch {
+				case tt.status != 0:
+					webErr, ok := err.(*web.Error)
+					if !ok || webErr.Status != tt.status {
+						t.Fatalf("\t%s\tTest %d:\tShould get a request error with status %d : got %v.", failed, testID, tt.status, err)
+					}
+					t.Logf("\t%s\tTest %d:\tShould get a request error with status %d.", success, testID, tt.status)
+
+				case tt.checkFailed:
+					if err == nil {
+						t.Fatalf("\t%s\tTest %d:\tShould fail the check.", failed, testID)
+					}
+					t.Logf("\t%s\tTest %d:\tShould fail the check.", success, testID)
+
+				default:
+					if err != nil {
+						t.Fatalf("\t%s\tTest %d:\tShould be able to patch: %s.", failed, testID, err)
+					}
+					if got != tt.exp {
+						t.Fatalf("\t%s\tTest %d:\tShould get %+v : got %+v.", failed, testID, tt.exp, got)
+					}
+					t.Logf("\t%s\tTest %d:\tShould get %+v.", success, testID, tt.exp)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package web
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ProblemContentType is the media type of problem details, RFC 7807.
+const ProblemContentType = "application/problem+json"
+
+// BlankProblem is the type of problems with no more semantics than their
+// status code.
+const BlankProblem = "about:blank"
+
+// Problem describes why a request failed, RFC 7807. Instance holds the ID of
+// the request so clients can refer to it.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Fields   []FieldError `json:"fields,omitempty"`
+}
+
+// ProblemType is a kind of problem errors are reported as. Status is the
+// code of responses reporting it unless the handler picked another one.
+type ProblemType struct {
+	URI    string
+	Title  string
+	Status int
+}
+
+// problemTypes holds the errors registered with a problem type.
+var problemTypes = struct {
+	sync.RWMutex
+	entries []problemEntry
+}{}
+
+type problemEntry struct {
+	err error
+	pt  ProblemType
+}
+
+// RegisterProblem reports the errors, and errors wrapping them, as the
+// problem type. Registering an error again replaces its type.
+func RegisterProblem(pt ProblemType, errs ...error) {
+	problemTypes.Lock()
+	defer problemTypes.Unlock()
+
+next:
+	for _, err := range errs {
+		for i := range problemTypes.entries {
+			if problemTypes.entries[i].err == err {
+				problemTypes.entries[i].pt = pt
+				continue next
+			}
+		}
+		problemTypes.entries = append(problemTypes.entries, problemEntry{err: err, pt: pt})
+	}
+}
+
+// lookupProblem returns the problem type of the first registered error in
+// the chain of err along with that error.
+func lookupProblem(err error) (ProblemType, error, bool) {
+	problemTypes.RLock()
+	defer problemTypes.RUnlock()
+
+	for _, e := range problemTypes.entries {
+		if stderrors.Is(err, e.err) {
+			return e.pt, e.err, true
+		}
+	}
+	return ProblemType{}, nil, false
+}
+
+// NewProblem describes the error as a problem:
+//
+//   - An *Error keeps its status code and fields. Its type comes from the
+//     registry when registered with the same status code, or is about:blank.
+//   - A registered error gets its problem type. The detail is the message
+//     of the registered error, not of the errors wrapping it.
+//   - Any other error is an internal server error without details, so
+//     nothing about the failure leaks to the client.
+func NewProblem(err error) Problem {
+	if webErr, ok := errors.Cause(err).(*Error); ok {
+		p := Problem{
+			Type:   BlankProblem,
+			Title:  http.StatusText(webErr.Status),
+			Status: webErr.Status,
+			Detail: webErr.Err.Error(),
+			Fields: webErr.Fields,
+		}
+		if pt, _, ok := lookupProblem(webErr.Err); ok && pt.Status == webErr.Status {
+			p.Type, p.Title = pt.URI, pt.Title
+		}
+		return p
+	}
+
+	if pt, cause, ok := lookupProblem(err); ok {
+		return Problem{
+			Type:   pt.URI,
+			Title:  pt.Title,
+			Status: pt.Status,
+			Detail: cause.Error(),
+		}
+	}
+
+	return Problem{
+		Type:   BlankProblem,
+		Title:  http.StatusText(http.StatusInternalServerError),
+		Status: http.StatusInternalServerError,
+	}
+}
+
+// RespondProblem sends the problem as an application/problem+json response.
+// The ID of the request is used as the instance.
+func RespondProblem(ctx context.Context, w http.ResponseWriter, p Problem) error {
+	if v, ok := ctx.Value(KeyValues).(*Values); ok && p.Instance == "" {
+		p.Instance = v.RequestID
+	}
+
+	return respond(ctx, w, p, p.Status, ProblemContentType)
+}
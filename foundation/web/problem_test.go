@@ -0,0 +1,65 @@
+package web_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/egorovdmi/financify/foundation/web"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestNewProblem(t *testing.T) {
+	errMissing := errors.New("thing not found")
+	errBroken := errors.New("database is down")
+
+	notFound := web.ProblemType{URI: "/problems/not-found", Title: "Not here.", Status: http.StatusNotFound}
+	web.RegisterProblem(notFound, errMissing)
+
+	fields := []web.FieldError{{Field: "name", Error: "name is a required field"}}
+
+	tt := []struct {
+		name string
+		err  error
+		exp  web.Problem
+	}{
+		{
+			"a registered error", errMissing,
+			web.Problem{Type: notFound.URI, Title: notFound.Title, Status: http.StatusNotFound, Detail: "thing not found"},
+		},
+		{
+			"a wrapped registered error", errors.Wrap(errMissing, "ID: 42"),
+			web.Problem{Type: notFound.URI, Title: notFound.Title, Status: http.StatusNotFound, Detail: "thing not found"},
+		},
+		{
+			"a request error of a registered error", web.NewRequestError(errMissing, http.StatusNotFound),
+			web.Problem{Type: notFound.URI, Title: notFound.Title, Status: http.StatusNotFound, Detail: "thing not found"},
+		},
+		{
+			"a request error with another status", web.NewRequestError(errMissing, http.StatusUnauthorized),
+			web.Problem{Type: web.BlankProblem, Title: "Unauthorized", Status: http.StatusUnauthorized, Detail: "thing not found"},
+		},
+		{
+			"a request error with fields", &web.Error{Err: errors.New("bad data"), Status: http.StatusBadRequest, Fields: fields},
+			web.Problem{Type: web.BlankProblem, Title: "Bad Request", Status: http.StatusBadRequest, Detail: "bad data", Fields: fields},
+		},
+		{
+			"an unknown error", errors.Wrap(errBroken, "querying things"),
+			web.Problem{Type: web.BlankProblem, Title: "Internal Server Error", Status: http.StatusInternalServerError},
+		},
+	}
+
+	t.Log("Given the need to describe errors as problem details.")
+	{
+		for testID, tst := range tt {
+			t.Logf("\tTest %d:\tWhen handling %s.", testID, tst.name)
+			{
+				got := web.NewProblem(tst.err)
+				if diff := cmp.Diff(tst.exp, got); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould get the expected problem. Diff:\n%s", failed, testID, diff)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get the expected problem.", success, testID)
+			}
+		}
+	}
+}
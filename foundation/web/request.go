@@ -13,6 +13,12 @@ func Param(r *http.Request, key string) string {
 	return m[key]
 }
 
+// Route returns the pattern of the route that matched the request, like
+// /v1/users/:id, which unlike the path doesn't vary with its parameters.
+func Route(r *http.Request) string {
+	return httptreemux.ContextRoute(r.Context())
+}
+
 // Decode reads the body of an HTTP request looking for a JSON document. The
 // body is decoded into the provided value.
 //
@@ -4,11 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
-
-	"github.com/pkg/errors"
 )
 
 func Respond(ctx context.Context, w http.ResponseWriter, data interface{}, statusCode int) error {
+	return respond(ctx, w, data, statusCode, "application/json")
+}
+
+// respond marshals the data into a response of the content type.
+func respond(ctx context.Context, w http.ResponseWriter, data interface{}, statusCode int, contentType string) error {
 	// Set the status code for the request logger middleware.
 	v, ok := ctx.Value(KeyValues).(*Values)
 	if !ok {
@@ -16,8 +19,13 @@ func Respond(ctx context.Context, w http.ResponseWriter, data interface{}, statu
 	}
 	v.StatusCode = statusCode
 
+	// Tag the response with the version of the resource it carries.
+	if t, ok := data.(Tagger); ok {
+		w.Header().Set("ETag", quote(t.ETag()))
+	}
+
 	// If there is nothing to marshal then set status code and return
-	if statusCode == http.StatusNoContent {
+	if statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
 		w.WriteHeader(statusCode)
 		return nil
 	}
@@ -28,41 +36,30 @@ func Respond(ctx context.Context, w http.ResponseWriter, data interface{}, statu
 	}
 
 	// Set the content type and headers once we know marshaling has succeeded.
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(statusCode)
 
 	// Send the result code to the response
 	if _, err := w.Write(jsonData); err != nil {
-		return err
+		return NewWriteError(err)
 	}
 
 	return nil
 }
 
-func RespondError(ctx context.Context, w http.ResponseWriter, err error) error {
-	// If the error was of the type *Error, the handler has
-	// a specific status code and error to return.
-	if webErr, ok := errors.Cause(err).(*Error); ok {
-		er := ErrorResponse{
-			Error:  webErr.Err.Error(),
-			Fields: webErr.Fields,
-		}
-
-		if err := Respond(ctx, w, er, webErr.Status); err != nil {
-			return err
-		}
-
-		return nil
-	}
-
-	// If not, the handler sent any regular error value so use 500.
-	er := ErrorResponse{
-		Error: http.StatusText(http.StatusInternalServerError),
-	}
-
-	if err := Respond(ctx, w, er, http.StatusInternalServerError); err != nil {
-		return err
+// Redirect sends the client to the url with the specified redirect status.
+func Redirect(ctx context.Context, w http.ResponseWriter, r *http.Request, url string, statusCode int) error {
+	v, ok := ctx.Value(KeyValues).(*Values)
+	if !ok {
+		return NewShutdownError("tracing value missing from context")
 	}
+	v.StatusCode = statusCode
 
+	http.Redirect(w, r, url, statusCode)
 	return nil
 }
+
+// RespondError sends the error as problem details, see NewProblem.
+func RespondError(ctx context.Context, w http.ResponseWriter, err error) error {
+	return RespondProblem(ctx, w, NewProblem(err))
+}
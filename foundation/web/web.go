@@ -9,7 +9,9 @@ import (
 	"time"
 
 	"github.com/dimfeld/httptreemux/v5"
+	"github.com/egorovdmi/financify/foundation/metrics"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -19,9 +21,19 @@ type ctxKey int
 // KeyValues is how request values are stored/retrieved.
 const KeyValues ctxKey = 1
 
+// handlerErrors counts the errors handlers returned to the app by kind.
+var handlerErrors = metrics.Default.NewCounterVec("http_handler_errors_total",
+	"Errors returned to the app by handlers.", "kind")
+
+// RequestIDHeader is the header carrying the ID of a request, returned on
+// every response so clients can refer to it.
+const RequestIDHeader = "X-Request-ID"
+
 // Values represent state for each request.
 type Values struct {
 	TraceID    string
+	RequestID  string
+	UserID     string
 	Now        time.Time
 	StatusCode int
 }
@@ -29,18 +41,23 @@ type Values struct {
 type Handler func(ctx context.Context, rw http.ResponseWriter, r *http.Request) error
 
 type App struct {
-	mux      *httptreemux.ContextMux
-	otmux    http.Handler
-	shutdown chan os.Signal
-	mw       []Middleware
+	mux            *httptreemux.ContextMux
+	otmux          http.Handler
+	shutdown       chan os.Signal
+	mw             []Middleware
+	trustRequestID bool
 }
 
 func NewApp(shutdown chan os.Signal, mw ...Middleware) *App {
 	mux := httptreemux.NewContextMux()
 
+	// Requests continue the trace of the caller passed in the W3C traceparent
+	// and baggage headers.
+	propagators := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
 	return &App{
 		mux:      mux,
-		otmux:    otelhttp.NewHandler(mux, "request"),
+		otmux:    otelhttp.NewHandler(mux, "request", otelhttp.WithPropagators(propagators)),
 		shutdown: shutdown,
 		mw:       mw,
 	}
@@ -50,6 +67,13 @@ func (a *App) SignalShutdown() {
 	a.shutdown <- syscall.SIGTERM
 }
 
+// TrustRequestID makes the app use the request ID passed by the client in
+// the X-Request-ID header instead of the trace ID. Only enable it behind a
+// proxy that sets or strips the header.
+func (a *App) TrustRequestID() {
+	a.trustRequestID = true
+}
+
 func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.otmux.ServeHTTP(w, r)
 }
@@ -70,16 +94,57 @@ func (a *App) Handle(method string, path string, handler Handler, mw ...Middlewa
 		defer span.End()
 
 		v := Values{
-			TraceID: span.SpanContext().TraceID().String(),
-			Now:     time.Now(),
+			TraceID:   span.SpanContext().TraceID().String(),
+			RequestID: span.SpanContext().TraceID().String(),
+			Now:       time.Now(),
+		}
+		if id := r.Header.Get(RequestIDHeader); a.trustRequestID && validRequestID(id) {
+			v.RequestID = id
 		}
 		ctx = context.WithValue(ctx, KeyValues, &v)
 
+		// Let the client refer to the request and continue its trace.
+		rw.Header().Set(RequestIDHeader, v.RequestID)
+		propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(rw.Header()))
+
+		// Errors left once the middleware ran were not sent to the client.
+		// Only integrity failures take the app down, the others belong to
+		// this request alone.
 		if err := handler(ctx, rw, r); err != nil {
-			a.SignalShutdown()
+			switch {
+			case IsShutdown(err):
+				handlerErrors.Inc("shutdown")
+				a.SignalShutdown()
+			case IsWriteError(err):
+				handlerErrors.Inc("write")
+			default:
+				handlerErrors.Inc("unhandled")
+			}
 			return
 		}
 	}
 
 	a.mux.Handle(method, path, h)
 }
+
+// maxRequestIDLen is the longest request ID accepted from a client.
+const maxRequestIDLen = 128
+
+// validRequestID reports whether a request ID passed by a client is safe to
+// log and return: not empty, not too long and made of letters, digits and
+// the punctuation common in IDs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package web_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/egorovdmi/financify/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestTraceContext(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	var gotTraceID, gotTenant string
+	app := web.NewApp(make(chan os.Signal, 1))
+	app.Handle(http.MethodGet, "/trace", func(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+		gotTraceID = ctx.Value(web.KeyValues).(*web.Values).TraceID
+		gotTenant = baggage.FromContext(ctx).Member("tenant").Value()
+		return web.Respond(ctx, rw, nil, http.StatusNoContent)
+	})
+
+	t.Log("Given the need to continue the trace of the caller.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the request carries W3C trace context headers.", testID)
+		{
+			r := httptest.NewRequest(http.MethodGet, "/trace", nil)
+			r.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+			r.Header.Set("baggage", "tenant=acme")
+			app.ServeHTTP(httptest.NewRecorder(), r)
+
+			if gotTraceID != traceID {
+				t.Fatalf("\t%s\tTest %d:\tShould use the trace ID of the caller : got %q want %q.", failed, testID, gotTraceID, traceID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould use the trace ID of the caller.", success, testID)
+
+			if gotTenant != "acme" {
+				t.Fatalf("\t%s\tTest %d:\tShould pass on the baggage : got %q.", failed, testID, gotTenant)
+			}
+			t.Logf("\t%s\tTest %d:\tShould pass on the baggage.", success, testID)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.NeverSample())))
+
+	newApp := func(trust bool) *web.App {
+		app := web.NewApp(make(chan os.Signal, 1))
+		if trust {
+			app.TrustRequestID()
+		}
+		app.Handle(http.MethodGet, "/fail", func(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+			return web.RespondError(ctx, rw, web.NewRequestError(errors.New("nope"), http.StatusBadRequest))
+		})
+		return app
+	}
+
+	serve := func(app *web.App, requestID string) (*httptest.ResponseRecorder, web.Problem) {
+		r := httptest.NewRequest(http.MethodGet, "/fail", nil)
+		if requestID != "" {
+			r.Header.Set(web.RequestIDHeader, requestID)
+		}
+		rw := httptest.NewRecorder()
+		app.ServeHTTP(rw, r)
+
+		var er web.Problem
+		json.Unmarshal(rw.Body.Bytes(), &er)
+		return rw, er
+	}
+
+	t.Log("Given the need to let clients refer to a request.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the request ID of the client isn't trusted.", testID)
+		{
+			rw, er := serve(newApp(false), "client-id")
+
+			id := rw.Header().Get(web.RequestIDHeader)
+			if len(id) != 32 || id == "client-id" {
+				t.Fatalf("\t%s\tTest %d:\tShould return the trace ID as request ID : got %q.", failed, testID, id)
+			}
+			t.Logf("\t%s\tTest %d:\tShould return the trace ID as request ID.", success, testID)
+
+			if tp := rw.Header().Get("traceparent"); !strings.HasPrefix(tp, "00-"+id+"-") {
+				t.Fatalf("\t%s\tTest %d:\tShould return the trace context : got %q.", failed, testID, tp)
+			}
+			t.Logf("\t%s\tTest %d:\tShould return the trace context.", success, testID)
+
+			if er.Instance != id || er.Detail != "nope" {
+				t.Fatalf("\t%s\tTest %d:\tShould include the request ID in errors : got %+v.", failed, testID, er)
+			}
+			t.Logf("\t%s\tTest %d:\tShould include the request ID in errors.", success, testID)
+
+			if ct := rw.Header().Get("Content-Type"); ct != web.ProblemContentType {
+				t.Fatalf("\t%s\tTest %d:\tShould respond with problem details : got %q.", failed, testID, ct)
+			}
+			t.Logf("\t%s\tTest %d:\tShould respond with problem details.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the request ID of the client is trusted.", testID)
+		{
+			rw, er := serve(newApp(true), "client-id:42")
+			if id := rw.Header().Get(web.RequestIDHeader); id != "client-id:42" || er.Instance != id {
+				t.Fatalf("\t%s\tTest %d:\tShould use the request ID of the client : got %q, %q.", failed, testID, id, er.Instance)
+			}
+			t.Logf("\t%s\tTest %d:\tShould use the request ID of the client.", success, testID)
+
+			for _, bad := range []string{"has space", "new\nline", strings.Repeat("x", 129)} {
+				rw, _ := serve(newApp(true), bad)
+				if id := rw.Header().Get(web.RequestIDHeader); len(id) != 32 {
+					t.Fatalf("\t%s\tTest %d:\tShould NOT use the malformed request ID %q : got %q.", failed, testID, bad, id)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT use malformed request IDs.", success, testID)
+		}
+	}
+}